@@ -0,0 +1,141 @@
+// Command shieldhibp builds a breach index for
+// shieldpasswordverifier.NewBreachVerifier from a Have I Been Pwned
+// SHA-1 dump.
+//
+// The dump is either a directory of range files, as produced by
+// the PwnedPasswordsDownloader (one "PREFIX" or "PREFIX.txt" file per
+// 5-character prefix with "SUFFIX:COUNT" lines), or a single file of
+// "HASH:COUNT" lines ordered by hash.
+//
+// Usage:
+//
+//	shieldhibp -in pwnedpasswords/ -out breach.idx -min-count 10
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.inout.gg/shield/shieldpasswordverifier"
+)
+
+// rangePrefixLength is the length of a range file name prefix.
+const rangePrefixLength = 5
+
+func main() {
+	in := flag.String("in", "", "path to the HIBP dump file or range directory")
+	out := flag.String("out", "", "path to the output index file")
+	minCount := flag.Int("min-count", 1, "skip hashes seen less than min-count times")
+	flag.Parse()
+
+	if *in == "" || *out == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	n, err := build(*in, *out, *minCount)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("wrote %d hashes to %s", n, *out)
+}
+
+func build(in, out string, minCount int) (int64, error) {
+	stat, err := os.Stat(in)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat input: %w", err)
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create index: %w", err)
+	}
+	defer f.Close()
+
+	b, err := shieldpasswordverifier.NewBreachIndexBuilder(f, minCount)
+	if err != nil {
+		return 0, err
+	}
+
+	if stat.IsDir() {
+		err = addRanges(b, in)
+	} else {
+		err = addFile(in, b.AddHashes)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	if err := b.Flush(); err != nil {
+		return 0, err
+	}
+
+	if err := f.Close(); err != nil {
+		return 0, fmt.Errorf("failed to close index: %w", err)
+	}
+
+	return b.Len(), nil
+}
+
+// addRanges adds range files of dir. os.ReadDir returns entries sorted by
+// name, i.e., in the prefix order.
+//
+// Files not named after a 5 hex digit prefix, e.g., a README, are skipped.
+func addRanges(b *shieldpasswordverifier.BreachIndexBuilder, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read input directory: %w", err)
+	}
+
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		prefix := strings.ToUpper(strings.TrimSuffix(e.Name(), filepath.Ext(e.Name())))
+		if !isRangePrefix(prefix) {
+			continue
+		}
+
+		err := addFile(filepath.Join(dir, e.Name()), func(r io.Reader) error {
+			return b.AddRange(prefix, r)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add range %s: %w", e.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// isRangePrefix reports whether s is a 5 hex digit range prefix.
+func isRangePrefix(s string) bool {
+	if len(s) != rangePrefixLength {
+		return false
+	}
+
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789ABCDEF", c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func addFile(path string, add func(io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	return add(f)
+}
@@ -32,6 +32,7 @@ func (r iteratorForCreateRecoveryCodeBatch) Values() ([]interface{}, error) {
 		r.rows[0].ID,
 		r.rows[0].UserID,
 		r.rows[0].RecoveryCodeHash,
+		r.rows[0].RecoveryCodeLookup,
 		r.rows[0].IsConsumable,
 	}, nil
 }
@@ -41,5 +42,5 @@ func (r iteratorForCreateRecoveryCodeBatch) Err() error {
 }
 
 func (q *Queries) CreateRecoveryCodeBatch(ctx context.Context, db DBTX, arg []CreateRecoveryCodeBatchParams) (int64, error) {
-	return db.CopyFrom(ctx, []string{"shield_recovery_codes"}, []string{"id", "user_id", "recovery_code_hash", "is_consumable"}, &iteratorForCreateRecoveryCodeBatch{rows: arg})
+	return db.CopyFrom(ctx, []string{"shield_recovery_codes"}, []string{"id", "user_id", "recovery_code_hash", "recovery_code_lookup", "is_consumable"}, &iteratorForCreateRecoveryCodeBatch{rows: arg})
 }
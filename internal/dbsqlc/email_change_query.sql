@@ -0,0 +1,67 @@
+-- name: UpsertPendingEmailChange :execrows
+INSERT INTO shield_user_email_changes
+  (
+    id,
+    user_id,
+    old_email,
+    new_email,
+    confirm_token_hash,
+    revert_token_hash,
+    expires_at,
+    revert_expires_at
+  )
+SELECT
+  @id,
+  @user_id,
+  @old_email,
+  @new_email,
+  @confirm_token_hash,
+  @revert_token_hash,
+  @expires_at,
+  @revert_expires_at
+WHERE
+  NOT EXISTS (
+    SELECT 1
+    FROM shield_user_email_changes
+    WHERE
+      user_id = @user_id
+      AND confirmed_at IS NOT NULL
+      AND reverted_at IS NULL
+      AND revert_expires_at > NOW()
+  )
+ON CONFLICT (user_id) WHERE confirmed_at IS NULL AND reverted_at IS NULL DO UPDATE
+  SET
+    id = excluded.id,
+    old_email = excluded.old_email,
+    new_email = excluded.new_email,
+    confirm_token_hash = excluded.confirm_token_hash,
+    revert_token_hash = excluded.revert_token_hash,
+    expires_at = excluded.expires_at,
+    revert_expires_at = excluded.revert_expires_at;
+
+-- name: ConfirmEmailChange :one
+UPDATE shield_user_email_changes
+SET confirmed_at = NOW()
+WHERE
+  confirm_token_hash = @confirm_token_hash
+  AND confirmed_at IS NULL
+  AND reverted_at IS NULL
+  AND expires_at > NOW()
+RETURNING *;
+
+-- name: RevertEmailChange :one
+UPDATE shield_user_email_changes
+SET reverted_at = NOW()
+WHERE
+  revert_token_hash = @revert_token_hash
+  AND reverted_at IS NULL
+  AND revert_expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredEmailChanges :execrows
+DELETE FROM shield_user_email_changes
+WHERE revert_expires_at < NOW();
+
+-- name: DeletePendingEmailChangeByID :exec
+DELETE FROM shield_user_email_changes
+WHERE id = @id AND confirmed_at IS NULL AND reverted_at IS NULL;
@@ -0,0 +1,24 @@
+-- name: UpsertUserEmailOTP :exec
+INSERT INTO shield_user_email_otps (id, user_id, code_hash, expires_at)
+VALUES (@id, @user_id, @code_hash, @expires_at)
+ON CONFLICT (user_id) DO UPDATE
+  SET
+    id = excluded.id,
+    code_hash = excluded.code_hash,
+    attempts = 0,
+    expires_at = excluded.expires_at,
+    used_at = NULL;
+
+-- name: IncrementUserEmailOTPAttempts :one
+UPDATE shield_user_email_otps
+SET attempts = attempts + 1
+WHERE user_id = @user_id AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: MarkUserEmailOTPAsUsed :execrows
+UPDATE shield_user_email_otps
+SET used_at = NOW()
+WHERE id = @id AND used_at IS NULL;
+
+-- name: DeleteUserEmailOTP :exec
+DELETE FROM shield_user_email_otps WHERE user_id = @user_id;
@@ -0,0 +1,32 @@
+-- name: FindLoginThrottle :one
+SELECT *
+FROM shield_login_throttles
+WHERE kind = @kind AND subject = @subject
+LIMIT 1;
+
+-- name: RecordLoginFailure :one
+INSERT INTO shield_login_throttles (id, kind, subject, failures)
+VALUES (@id, @kind, @subject, 1)
+ON CONFLICT (kind, subject) DO UPDATE
+  SET
+    failures = CASE
+      WHEN shield_login_throttles.last_failed_at < NOW() - @window_seconds::INTEGER * INTERVAL '1 second'
+        THEN 1
+      ELSE shield_login_throttles.failures + 1
+    END,
+    last_failed_at = NOW()
+RETURNING failures;
+
+-- name: LockLoginThrottle :exec
+UPDATE shield_login_throttles
+SET locked_until = @locked_until
+WHERE kind = @kind AND subject = @subject;
+
+-- name: DeleteLoginThrottle :exec
+DELETE FROM shield_login_throttles WHERE kind = @kind AND subject = @subject;
+
+-- name: DeleteStaleLoginThrottles :execrows
+DELETE FROM shield_login_throttles
+WHERE
+  last_failed_at < NOW() - @window_seconds::INTEGER * INTERVAL '1 second'
+  AND (locked_until IS NULL OR locked_until < NOW());
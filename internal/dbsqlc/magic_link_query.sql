@@ -0,0 +1,16 @@
+-- name: CreateMagicLinkToken :exec
+INSERT INTO shield_magic_link_tokens (id, email, token_hash, expires_at)
+VALUES (@id, @email, @token_hash, @expires_at);
+
+-- name: DeleteUnusedMagicLinkTokensByEmail :exec
+DELETE FROM shield_magic_link_tokens
+WHERE email = @email AND used_at IS NULL;
+
+-- name: ConsumeMagicLinkToken :one
+UPDATE shield_magic_link_tokens
+SET used_at = NOW()
+WHERE token_hash = @token_hash AND used_at IS NULL AND expires_at > NOW()
+RETURNING email;
+
+-- name: DeleteExpiredMagicLinkTokens :execrows
+DELETE FROM shield_magic_link_tokens WHERE expires_at < NOW();
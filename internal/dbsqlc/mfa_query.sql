@@ -1,2 +1,10 @@
 -- name: GetUserMFAs :many
 SELECT * FROM shield_user_mfas WHERE user_id = @user_id;
+
+-- name: CreateUserMFA :exec
+INSERT INTO shield_user_mfas (id, user_id, name)
+VALUES (@id, @user_id, @name)
+ON CONFLICT (user_id, name) DO NOTHING;
+
+-- name: DeleteUserMFA :exec
+DELETE FROM shield_user_mfas WHERE user_id = @user_id AND name = @name;
@@ -11,6 +11,37 @@ import (
 	typeid "go.jetify.com/typeid/v2"
 )
 
+const createUserMFA = `-- name: CreateUserMFA :exec
+INSERT INTO shield_user_mfas (id, user_id, name)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, name) DO NOTHING
+`
+
+type CreateUserMFAParams struct {
+	ID     typeid.TypeID
+	UserID typeid.TypeID
+	Name   string
+}
+
+func (q *Queries) CreateUserMFA(ctx context.Context, db DBTX, arg CreateUserMFAParams) error {
+	_, err := db.Exec(ctx, createUserMFA, arg.ID, arg.UserID, arg.Name)
+	return err
+}
+
+const deleteUserMFA = `-- name: DeleteUserMFA :exec
+DELETE FROM shield_user_mfas WHERE user_id = $1 AND name = $2
+`
+
+type DeleteUserMFAParams struct {
+	UserID typeid.TypeID
+	Name   string
+}
+
+func (q *Queries) DeleteUserMFA(ctx context.Context, db DBTX, arg DeleteUserMFAParams) error {
+	_, err := db.Exec(ctx, deleteUserMFA, arg.UserID, arg.Name)
+	return err
+}
+
 const getUserMFAs = `-- name: GetUserMFAs :many
 SELECT id, created_at, updated_at, name, user_id FROM shield_user_mfas WHERE user_id = $1
 `
@@ -10,25 +10,57 @@ import (
 	typeid "go.jetify.com/typeid/v2"
 )
 
+type ShieldLoginThrottle struct {
+	ID           typeid.TypeID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Kind         string
+	Subject      string
+	Failures     int32
+	LastFailedAt time.Time
+	LockedUntil  *time.Time
+}
+
+type ShieldMagicLinkToken struct {
+	ID        typeid.TypeID
+	CreatedAt time.Time
+	Email     string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+type ShieldPasskeySession struct {
+	ID          typeid.TypeID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Ceremony    string
+	UserID      *typeid.TypeID
+	SessionData []byte
+	ExpiresAt   time.Time
+}
+
 type ShieldPasswordResetToken struct {
 	ID        typeid.TypeID
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	IsUsed    bool
-	Token     string
+	TokenHash string
 	ExpiresAt time.Time
 	UserID    typeid.TypeID
 }
 
 type ShieldRecoveryCode struct {
-	ID               typeid.TypeID
-	CreatedAt        time.Time
-	UpdatedAt        time.Time
-	UserID           typeid.TypeID
-	RecoveryCodeHash string
-	IsConsumable     bool
-	EvictedBy        *typeid.TypeID
-	EvictedAt        time.Time
+	ID                 typeid.TypeID
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	UserID             typeid.TypeID
+	RecoveryCodeHash   string
+	IsConsumable       bool
+	EvictedBy          *typeid.TypeID
+	EvictedAt          time.Time
+	ConsumedAt         *time.Time
+	RecoveryCodeLookup *string
 }
 
 type ShieldUser struct {
@@ -47,6 +79,33 @@ type ShieldUserCredential struct {
 	UserID               typeid.TypeID
 	UserCredentialKey    string
 	UserCredentialSecret string
+	RotatedAt            time.Time
+}
+
+type ShieldUserEmailChange struct {
+	ID               typeid.TypeID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	UserID           typeid.TypeID
+	OldEmail         string
+	NewEmail         string
+	ConfirmTokenHash string
+	RevertTokenHash  string
+	ExpiresAt        time.Time
+	RevertExpiresAt  time.Time
+	ConfirmedAt      *time.Time
+	RevertedAt       *time.Time
+}
+
+type ShieldUserEmailOtp struct {
+	ID        typeid.TypeID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    typeid.TypeID
+	CodeHash  []byte
+	Attempts  int32
+	ExpiresAt time.Time
+	UsedAt    *time.Time
 }
 
 type ShieldUserEmailVerificationToken struct {
@@ -54,9 +113,10 @@ type ShieldUserEmailVerificationToken struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	IsUsed    bool
-	Token     string
+	TokenHash string
 	Email     string
 	UserID    typeid.TypeID
+	ExpiresAt time.Time
 }
 
 type ShieldUserMfa struct {
@@ -67,6 +127,35 @@ type ShieldUserMfa struct {
 	UserID    typeid.TypeID
 }
 
+type ShieldUserPasskey struct {
+	ID               typeid.TypeID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	LastUsedAt       *time.Time
+	UserID           typeid.TypeID
+	Name             string
+	CredentialID     []byte
+	PublicKey        []byte
+	AttestationType  string
+	Attestation      []byte
+	Transports       []string
+	Aaguid           []byte
+	SignCount        int64
+	CloneWarning     bool
+	Attachment       string
+	IsUserPresent    bool
+	IsUserVerified   bool
+	IsBackupEligible bool
+	IsBackupState    bool
+}
+
+type ShieldUserPasswordHistory struct {
+	ID           typeid.TypeID
+	CreatedAt    time.Time
+	UserID       typeid.TypeID
+	PasswordHash string
+}
+
 type ShieldUserSession struct {
 	ID            typeid.TypeID
 	CreatedAt     time.Time
@@ -75,6 +164,18 @@ type ShieldUserSession struct {
 	UserID        typeid.TypeID
 	EvictedBy     *typeid.TypeID
 	IsMfaRequired bool
+	MfaAttempts   int32
+}
+
+type ShieldUserTotp struct {
+	ID              typeid.TypeID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	UserID          typeid.TypeID
+	EncryptedSecret []byte
+	IsConfirmed     bool
+	ConfirmedAt     *time.Time
+	LastUsedStep    int64
 }
 
 type ShieldWorkspace struct {
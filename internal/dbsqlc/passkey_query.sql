@@ -1,15 +1,86 @@
--- name: CreateUserPasskeyCredential :exec
-INSERT INTO shield_user_credentials
-  (id, name, user_id, user_credential_key, user_credential_secret)
+-- name: FindUserPasskeysByUserID :many
+SELECT *
+FROM shield_user_passkeys
+WHERE user_id = @user_id
+ORDER BY created_at;
+
+-- name: CreateUserPasskey :exec
+INSERT INTO shield_user_passkeys
+  (
+    id,
+    user_id,
+    name,
+    credential_id,
+    public_key,
+    attestation_type,
+    attestation,
+    transports,
+    aaguid,
+    sign_count,
+    attachment,
+    is_user_present,
+    is_user_verified,
+    is_backup_eligible,
+    is_backup_state
+  )
 VALUES
-  (@id, 'passkey', @user_id, @user_credential_key, @user_credential_secret);
-
--- name: FindUserWithPasskeyCredentialByEmail :one
-SELECT u.*, credential.user_credential_secret::JSON AS user_credential
-FROM
-  shield_users AS u
-  JOIN shield_user_credentials AS credential
-    ON credential.user_id = u.id
-    AND credential.name = 'passkey'
-    AND credential.user_credential_key = @email
-WHERE u.email = @email;
+  (
+    @id,
+    @user_id,
+    @name,
+    @credential_id,
+    @public_key,
+    @attestation_type,
+    @attestation,
+    @transports,
+    @aaguid,
+    @sign_count,
+    @attachment,
+    @is_user_present,
+    @is_user_verified,
+    @is_backup_eligible,
+    @is_backup_state
+  );
+
+-- name: UpdateUserPasskeyOnLogin :exec
+UPDATE shield_user_passkeys
+SET
+  sign_count = @sign_count,
+  clone_warning = @clone_warning,
+  is_user_present = @is_user_present,
+  is_user_verified = @is_user_verified,
+  is_backup_state = @is_backup_state,
+  last_used_at = NOW()
+WHERE user_id = @user_id AND credential_id = @credential_id;
+
+-- name: RenameUserPasskey :execrows
+UPDATE shield_user_passkeys
+SET name = @name
+WHERE id = @id AND user_id = @user_id;
+
+-- name: DeleteUserPasskey :execrows
+DELETE FROM shield_user_passkeys
+WHERE id = @id AND user_id = @user_id;
+
+-- name: CreatePasskeySession :exec
+INSERT INTO shield_passkey_sessions
+  (id, ceremony, user_id, session_data, expires_at)
+VALUES
+  (@id, @ceremony, @user_id, @session_data, @expires_at);
+
+-- name: ConsumePasskeySession :one
+DELETE FROM shield_passkey_sessions
+WHERE id = @id AND ceremony = @ceremony AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredPasskeySessions :exec
+DELETE FROM shield_passkey_sessions WHERE expires_at < NOW();
+
+-- name: ConsumeUserPasskeySessionByChallenge :one
+DELETE FROM shield_passkey_sessions
+WHERE
+  user_id = @user_id
+  AND ceremony = @ceremony
+  AND session_data ->> 'challenge' = @challenge::TEXT
+  AND expires_at > NOW()
+RETURNING *;
@@ -12,60 +12,292 @@ import (
 	typeid "go.jetify.com/typeid/v2"
 )
 
-const createUserPasskeyCredential = `-- name: CreateUserPasskeyCredential :exec
-INSERT INTO shield_user_credentials
-  (id, name, user_id, user_credential_key, user_credential_secret)
-VALUES
-  ($1, 'passkey', $2, $3, $4)
+const consumePasskeySession = `-- name: ConsumePasskeySession :one
+DELETE FROM shield_passkey_sessions
+WHERE id = $1 AND ceremony = $2 AND expires_at > NOW()
+RETURNING id, created_at, updated_at, ceremony, user_id, session_data, expires_at
 `
 
-type CreateUserPasskeyCredentialParams struct {
-	ID                   typeid.TypeID
-	UserID               typeid.TypeID
-	UserCredentialKey    string
-	UserCredentialSecret string
+type ConsumePasskeySessionParams struct {
+	ID       typeid.TypeID
+	Ceremony string
 }
 
-func (q *Queries) CreateUserPasskeyCredential(ctx context.Context, db DBTX, arg CreateUserPasskeyCredentialParams) error {
-	_, err := db.Exec(ctx, createUserPasskeyCredential,
-		arg.ID,
-		arg.UserID,
-		arg.UserCredentialKey,
-		arg.UserCredentialSecret,
+func (q *Queries) ConsumePasskeySession(ctx context.Context, db DBTX, arg ConsumePasskeySessionParams) (ShieldPasskeySession, error) {
+	row := db.QueryRow(ctx, consumePasskeySession, arg.ID, arg.Ceremony)
+	var i ShieldPasskeySession
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Ceremony,
+		&i.UserID,
+		&i.SessionData,
+		&i.ExpiresAt,
 	)
-	return err
+	return i, err
 }
 
-const findUserWithPasskeyCredentialByEmail = `-- name: FindUserWithPasskeyCredentialByEmail :one
-SELECT u.id, u.created_at, u.updated_at, u.email, u.is_email_verified, credential.user_credential_secret::JSON AS user_credential
-FROM
-  shield_users AS u
-  JOIN shield_user_credentials AS credential
-    ON credential.user_id = u.id
-    AND credential.name = 'passkey'
-    AND credential.user_credential_key = $1
-WHERE u.email = $1
+const consumeUserPasskeySessionByChallenge = `-- name: ConsumeUserPasskeySessionByChallenge :one
+DELETE FROM shield_passkey_sessions
+WHERE
+  user_id = $1
+  AND ceremony = $2
+  AND session_data ->> 'challenge' = $3::TEXT
+  AND expires_at > NOW()
+RETURNING id, created_at, updated_at, ceremony, user_id, session_data, expires_at
 `
 
-type FindUserWithPasskeyCredentialByEmailRow struct {
-	ID              typeid.TypeID
-	CreatedAt       time.Time
-	UpdatedAt       time.Time
-	Email           string
-	IsEmailVerified bool
-	UserCredential  []byte
+type ConsumeUserPasskeySessionByChallengeParams struct {
+	UserID    *typeid.TypeID
+	Ceremony  string
+	Challenge string
 }
 
-func (q *Queries) FindUserWithPasskeyCredentialByEmail(ctx context.Context, db DBTX, email string) (FindUserWithPasskeyCredentialByEmailRow, error) {
-	row := db.QueryRow(ctx, findUserWithPasskeyCredentialByEmail, email)
-	var i FindUserWithPasskeyCredentialByEmailRow
+func (q *Queries) ConsumeUserPasskeySessionByChallenge(ctx context.Context, db DBTX, arg ConsumeUserPasskeySessionByChallengeParams) (ShieldPasskeySession, error) {
+	row := db.QueryRow(ctx, consumeUserPasskeySessionByChallenge, arg.UserID, arg.Ceremony, arg.Challenge)
+	var i ShieldPasskeySession
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
-		&i.Email,
-		&i.IsEmailVerified,
-		&i.UserCredential,
+		&i.Ceremony,
+		&i.UserID,
+		&i.SessionData,
+		&i.ExpiresAt,
 	)
 	return i, err
 }
+
+const createPasskeySession = `-- name: CreatePasskeySession :exec
+INSERT INTO shield_passkey_sessions
+  (id, ceremony, user_id, session_data, expires_at)
+VALUES
+  ($1, $2, $3, $4, $5)
+`
+
+type CreatePasskeySessionParams struct {
+	ID          typeid.TypeID
+	Ceremony    string
+	UserID      *typeid.TypeID
+	SessionData []byte
+	ExpiresAt   time.Time
+}
+
+func (q *Queries) CreatePasskeySession(ctx context.Context, db DBTX, arg CreatePasskeySessionParams) error {
+	_, err := db.Exec(ctx, createPasskeySession,
+		arg.ID,
+		arg.Ceremony,
+		arg.UserID,
+		arg.SessionData,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const createUserPasskey = `-- name: CreateUserPasskey :exec
+INSERT INTO shield_user_passkeys
+  (
+    id,
+    user_id,
+    name,
+    credential_id,
+    public_key,
+    attestation_type,
+    attestation,
+    transports,
+    aaguid,
+    sign_count,
+    attachment,
+    is_user_present,
+    is_user_verified,
+    is_backup_eligible,
+    is_backup_state
+  )
+VALUES
+  (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    $7,
+    $8,
+    $9,
+    $10,
+    $11,
+    $12,
+    $13,
+    $14,
+    $15
+  )
+`
+
+type CreateUserPasskeyParams struct {
+	ID               typeid.TypeID
+	UserID           typeid.TypeID
+	Name             string
+	CredentialID     []byte
+	PublicKey        []byte
+	AttestationType  string
+	Attestation      []byte
+	Transports       []string
+	Aaguid           []byte
+	SignCount        int64
+	Attachment       string
+	IsUserPresent    bool
+	IsUserVerified   bool
+	IsBackupEligible bool
+	IsBackupState    bool
+}
+
+func (q *Queries) CreateUserPasskey(ctx context.Context, db DBTX, arg CreateUserPasskeyParams) error {
+	_, err := db.Exec(ctx, createUserPasskey,
+		arg.ID,
+		arg.UserID,
+		arg.Name,
+		arg.CredentialID,
+		arg.PublicKey,
+		arg.AttestationType,
+		arg.Attestation,
+		arg.Transports,
+		arg.Aaguid,
+		arg.SignCount,
+		arg.Attachment,
+		arg.IsUserPresent,
+		arg.IsUserVerified,
+		arg.IsBackupEligible,
+		arg.IsBackupState,
+	)
+	return err
+}
+
+const deleteExpiredPasskeySessions = `-- name: DeleteExpiredPasskeySessions :exec
+DELETE FROM shield_passkey_sessions WHERE expires_at < NOW()
+`
+
+func (q *Queries) DeleteExpiredPasskeySessions(ctx context.Context, db DBTX) error {
+	_, err := db.Exec(ctx, deleteExpiredPasskeySessions)
+	return err
+}
+
+const deleteUserPasskey = `-- name: DeleteUserPasskey :execrows
+DELETE FROM shield_user_passkeys
+WHERE id = $1 AND user_id = $2
+`
+
+type DeleteUserPasskeyParams struct {
+	ID     typeid.TypeID
+	UserID typeid.TypeID
+}
+
+func (q *Queries) DeleteUserPasskey(ctx context.Context, db DBTX, arg DeleteUserPasskeyParams) (int64, error) {
+	result, err := db.Exec(ctx, deleteUserPasskey, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const findUserPasskeysByUserID = `-- name: FindUserPasskeysByUserID :many
+SELECT id, created_at, updated_at, last_used_at, user_id, name, credential_id, public_key, attestation_type, attestation, transports, aaguid, sign_count, clone_warning, attachment, is_user_present, is_user_verified, is_backup_eligible, is_backup_state
+FROM shield_user_passkeys
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (q *Queries) FindUserPasskeysByUserID(ctx context.Context, db DBTX, userID typeid.TypeID) ([]ShieldUserPasskey, error) {
+	rows, err := db.Query(ctx, findUserPasskeysByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ShieldUserPasskey
+	for rows.Next() {
+		var i ShieldUserPasskey
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.LastUsedAt,
+			&i.UserID,
+			&i.Name,
+			&i.CredentialID,
+			&i.PublicKey,
+			&i.AttestationType,
+			&i.Attestation,
+			&i.Transports,
+			&i.Aaguid,
+			&i.SignCount,
+			&i.CloneWarning,
+			&i.Attachment,
+			&i.IsUserPresent,
+			&i.IsUserVerified,
+			&i.IsBackupEligible,
+			&i.IsBackupState,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const renameUserPasskey = `-- name: RenameUserPasskey :execrows
+UPDATE shield_user_passkeys
+SET name = $1
+WHERE id = $2 AND user_id = $3
+`
+
+type RenameUserPasskeyParams struct {
+	Name   string
+	ID     typeid.TypeID
+	UserID typeid.TypeID
+}
+
+func (q *Queries) RenameUserPasskey(ctx context.Context, db DBTX, arg RenameUserPasskeyParams) (int64, error) {
+	result, err := db.Exec(ctx, renameUserPasskey, arg.Name, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateUserPasskeyOnLogin = `-- name: UpdateUserPasskeyOnLogin :exec
+UPDATE shield_user_passkeys
+SET
+  sign_count = $1,
+  clone_warning = $2,
+  is_user_present = $3,
+  is_user_verified = $4,
+  is_backup_state = $5,
+  last_used_at = NOW()
+WHERE user_id = $6 AND credential_id = $7
+`
+
+type UpdateUserPasskeyOnLoginParams struct {
+	SignCount      int64
+	CloneWarning   bool
+	IsUserPresent  bool
+	IsUserVerified bool
+	IsBackupState  bool
+	UserID         typeid.TypeID
+	CredentialID   []byte
+}
+
+func (q *Queries) UpdateUserPasskeyOnLogin(ctx context.Context, db DBTX, arg UpdateUserPasskeyOnLoginParams) error {
+	_, err := db.Exec(ctx, updateUserPasskeyOnLogin,
+		arg.SignCount,
+		arg.CloneWarning,
+		arg.IsUserPresent,
+		arg.IsUserVerified,
+		arg.IsBackupState,
+		arg.UserID,
+		arg.CredentialID,
+	)
+	return err
+}
@@ -0,0 +1,22 @@
+-- name: CreateUserPasswordHistory :exec
+INSERT INTO shield_user_password_histories (id, user_id, password_hash)
+VALUES (@id, @user_id, @password_hash);
+
+-- name: FindRecentUserPasswordHistoryHashes :many
+SELECT password_hash
+FROM shield_user_password_histories
+WHERE user_id = @user_id
+ORDER BY created_at DESC
+LIMIT @size;
+
+-- name: PruneUserPasswordHistory :execrows
+DELETE FROM shield_user_password_histories
+WHERE
+  user_id = @user_id
+  AND id NOT IN (
+    SELECT id
+    FROM shield_user_password_histories
+    WHERE user_id = @user_id
+    ORDER BY created_at DESC
+    LIMIT @retention
+  );
@@ -6,7 +6,9 @@ WITH
     VALUES
       (@id, 'password', @user_id, @user_credential_key, @user_credential_secret)
     ON CONFLICT (name, user_credential_key) DO UPDATE
-      SET user_credential_secret = @user_credential_secret
+      SET
+        user_credential_secret = @user_credential_secret,
+        rotated_at = CURRENT_TIMESTAMP
     RETURNING id
   )
 SELECT *
@@ -32,6 +34,17 @@ FROM
     AND credential.user_credential_key = shield_user.email
 WHERE shield_user.id = @user_id;
 
+-- name: FindUserWithPasswordCredentialByUserIDForUpdate :one
+SELECT shield_user.*, credential.user_credential_secret AS password_hash
+FROM
+  shield_users AS shield_user
+  LEFT JOIN shield_user_credentials AS credential
+    ON credential.user_id = shield_user.id
+    AND credential.name = 'password'
+    AND credential.user_credential_key = shield_user.email
+WHERE shield_user.id = @user_id
+FOR UPDATE OF shield_user;
+
 -- name: ChangePasswordCredentialEmailByUserID :exec
 UPDATE shield_user_credentials
 SET user_credential_key = @email
@@ -41,29 +54,41 @@ WHERE user_id = @user_id AND name = 'password';
 WITH
   token AS (
     INSERT INTO shield_password_reset_tokens
-      (id, user_id, token, expires_at, is_used)
+      (id, user_id, token_hash, expires_at, is_used)
     VALUES
-      (@id, @user_id, @token, @expires_at, FALSE)
-    ON CONFLICT (user_id, is_used) DO UPDATE
-      SET expires_at = greatest(
-        excluded.expires_at,
-        shield_password_reset_tokens.expires_at
-      )
-    RETURNING token, id, expires_at
+      (@id, @user_id, @token_hash, @expires_at, FALSE)
+    ON CONFLICT (user_id) WHERE is_used = FALSE DO UPDATE
+      SET
+        token_hash = excluded.token_hash,
+        expires_at = excluded.expires_at
+    RETURNING id, expires_at
   )
 SELECT *
 FROM token;
 
--- name: FindPasswordResetToken :one
+-- name: FindPasswordResetTokenByHash :one
 SELECT *
 FROM shield_password_reset_tokens
-WHERE token = @token
-LIMIT 1 AND expires_at > now();
+WHERE token_hash = @token_hash AND expires_at > NOW()
+LIMIT 1;
 
--- name: MarkPasswordResetTokenAsUsed :exec
+-- name: MarkPasswordResetTokenAsUsed :execrows
 UPDATE shield_password_reset_tokens
 SET is_used = TRUE
-WHERE token = @token;
+WHERE id = @id AND is_used = FALSE;
 
 -- name: DeleteExpiredPasswordResetTokens :exec
 DELETE FROM shield_password_reset_tokens WHERE expires_at < now() RETURNING id;
+
+-- name: UpdatePasswordCredentialSecretByUserID :execrows
+UPDATE shield_user_credentials
+SET user_credential_secret = @new_user_credential_secret
+WHERE
+  user_id = @user_id
+  AND name = 'password'
+  AND user_credential_secret = @old_user_credential_secret;
+
+-- name: FindPasswordCredentialRotatedAtByUserID :one
+SELECT rotated_at
+FROM shield_user_credentials
+WHERE user_id = @user_id AND name = 'password';
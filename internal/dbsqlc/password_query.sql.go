@@ -37,22 +37,35 @@ func (q *Queries) DeleteExpiredPasswordResetTokens(ctx context.Context, db DBTX)
 	return err
 }
 
-const findPasswordResetToken = `-- name: FindPasswordResetToken :one
-SELECT id, created_at, updated_at, is_used, token, expires_at, user_id
+const findPasswordCredentialRotatedAtByUserID = `-- name: FindPasswordCredentialRotatedAtByUserID :one
+SELECT rotated_at
+FROM shield_user_credentials
+WHERE user_id = $1 AND name = 'password'
+`
+
+func (q *Queries) FindPasswordCredentialRotatedAtByUserID(ctx context.Context, db DBTX, userID typeid.TypeID) (time.Time, error) {
+	row := db.QueryRow(ctx, findPasswordCredentialRotatedAtByUserID, userID)
+	var rotated_at time.Time
+	err := row.Scan(&rotated_at)
+	return rotated_at, err
+}
+
+const findPasswordResetTokenByHash = `-- name: FindPasswordResetTokenByHash :one
+SELECT id, created_at, updated_at, is_used, token_hash, expires_at, user_id
 FROM shield_password_reset_tokens
-WHERE token = $1
-LIMIT 1 AND expires_at > now()
+WHERE token_hash = $1 AND expires_at > NOW()
+LIMIT 1
 `
 
-func (q *Queries) FindPasswordResetToken(ctx context.Context, db DBTX, token string) (ShieldPasswordResetToken, error) {
-	row := db.QueryRow(ctx, findPasswordResetToken, token)
+func (q *Queries) FindPasswordResetTokenByHash(ctx context.Context, db DBTX, tokenHash string) (ShieldPasswordResetToken, error) {
+	row := db.QueryRow(ctx, findPasswordResetTokenByHash, tokenHash)
 	var i ShieldPasswordResetToken
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.IsUsed,
-		&i.Token,
+		&i.TokenHash,
 		&i.ExpiresAt,
 		&i.UserID,
 	)
@@ -127,15 +140,76 @@ func (q *Queries) FindUserWithPasswordCredentialByUserID(ctx context.Context, db
 	return i, err
 }
 
-const markPasswordResetTokenAsUsed = `-- name: MarkPasswordResetTokenAsUsed :exec
+const findUserWithPasswordCredentialByUserIDForUpdate = `-- name: FindUserWithPasswordCredentialByUserIDForUpdate :one
+SELECT shield_user.id, shield_user.created_at, shield_user.updated_at, shield_user.email, shield_user.is_email_verified, credential.user_credential_secret AS password_hash
+FROM
+  shield_users AS shield_user
+  LEFT JOIN shield_user_credentials AS credential
+    ON credential.user_id = shield_user.id
+    AND credential.name = 'password'
+    AND credential.user_credential_key = shield_user.email
+WHERE shield_user.id = $1
+FOR UPDATE OF shield_user
+`
+
+type FindUserWithPasswordCredentialByUserIDForUpdateRow struct {
+	ID              typeid.TypeID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	IsEmailVerified bool
+	PasswordHash    *string
+}
+
+func (q *Queries) FindUserWithPasswordCredentialByUserIDForUpdate(ctx context.Context, db DBTX, userID typeid.TypeID) (FindUserWithPasswordCredentialByUserIDForUpdateRow, error) {
+	row := db.QueryRow(ctx, findUserWithPasswordCredentialByUserIDForUpdate, userID)
+	var i FindUserWithPasswordCredentialByUserIDForUpdateRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.IsEmailVerified,
+		&i.PasswordHash,
+	)
+	return i, err
+}
+
+const markPasswordResetTokenAsUsed = `-- name: MarkPasswordResetTokenAsUsed :execrows
 UPDATE shield_password_reset_tokens
 SET is_used = TRUE
-WHERE token = $1
+WHERE id = $1 AND is_used = FALSE
 `
 
-func (q *Queries) MarkPasswordResetTokenAsUsed(ctx context.Context, db DBTX, token string) error {
-	_, err := db.Exec(ctx, markPasswordResetTokenAsUsed, token)
-	return err
+func (q *Queries) MarkPasswordResetTokenAsUsed(ctx context.Context, db DBTX, id typeid.TypeID) (int64, error) {
+	result, err := db.Exec(ctx, markPasswordResetTokenAsUsed, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updatePasswordCredentialSecretByUserID = `-- name: UpdatePasswordCredentialSecretByUserID :execrows
+UPDATE shield_user_credentials
+SET user_credential_secret = $1
+WHERE
+  user_id = $2
+  AND name = 'password'
+  AND user_credential_secret = $3
+`
+
+type UpdatePasswordCredentialSecretByUserIDParams struct {
+	NewUserCredentialSecret string
+	UserID                  typeid.TypeID
+	OldUserCredentialSecret string
+}
+
+func (q *Queries) UpdatePasswordCredentialSecretByUserID(ctx context.Context, db DBTX, arg UpdatePasswordCredentialSecretByUserIDParams) (int64, error) {
+	result, err := db.Exec(ctx, updatePasswordCredentialSecretByUserID, arg.NewUserCredentialSecret, arg.UserID, arg.OldUserCredentialSecret)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
 const upsertPasswordCredentialByUserID = `-- name: UpsertPasswordCredentialByUserID :exec
@@ -146,7 +220,9 @@ WITH
     VALUES
       ($1, 'password', $2, $3, $4)
     ON CONFLICT (name, user_credential_key) DO UPDATE
-      SET user_credential_secret = $4
+      SET
+        user_credential_secret = $4,
+        rotated_at = CURRENT_TIMESTAMP
     RETURNING id
   )
 SELECT id
@@ -174,29 +250,27 @@ const upsertPasswordResetToken = `-- name: UpsertPasswordResetToken :one
 WITH
   token AS (
     INSERT INTO shield_password_reset_tokens
-      (id, user_id, token, expires_at, is_used)
+      (id, user_id, token_hash, expires_at, is_used)
     VALUES
       ($1, $2, $3, $4, FALSE)
-    ON CONFLICT (user_id, is_used) DO UPDATE
-      SET expires_at = greatest(
-        excluded.expires_at,
-        shield_password_reset_tokens.expires_at
-      )
-    RETURNING token, id, expires_at
+    ON CONFLICT (user_id) WHERE is_used = FALSE DO UPDATE
+      SET
+        token_hash = excluded.token_hash,
+        expires_at = excluded.expires_at
+    RETURNING id, expires_at
   )
-SELECT token, id, expires_at
+SELECT id, expires_at
 FROM token
 `
 
 type UpsertPasswordResetTokenParams struct {
 	ID        typeid.TypeID
 	UserID    typeid.TypeID
-	Token     string
+	TokenHash string
 	ExpiresAt time.Time
 }
 
 type UpsertPasswordResetTokenRow struct {
-	Token     string
 	ID        string
 	ExpiresAt time.Time
 }
@@ -205,10 +279,10 @@ func (q *Queries) UpsertPasswordResetToken(ctx context.Context, db DBTX, arg Ups
 	row := db.QueryRow(ctx, upsertPasswordResetToken,
 		arg.ID,
 		arg.UserID,
-		arg.Token,
+		arg.TokenHash,
 		arg.ExpiresAt,
 	)
 	var i UpsertPasswordResetTokenRow
-	err := row.Scan(&i.Token, &i.ID, &i.ExpiresAt)
+	err := row.Scan(&i.ID, &i.ExpiresAt)
 	return i, err
 }
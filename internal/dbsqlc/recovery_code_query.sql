@@ -1,8 +1,8 @@
 -- name: CreateRecoveryCodeBatch :copyfrom
 INSERT INTO shield_recovery_codes
-  (id, user_id, recovery_code_hash, is_consumable)
+  (id, user_id, recovery_code_hash, recovery_code_lookup, is_consumable)
 VALUES
-  (@id, @user_id, @recovery_code_hash, @is_consumable);
+  (@id, @user_id, @recovery_code_hash, @recovery_code_lookup, @is_consumable);
 
 -- name: EvictUnconsumedRecoveryCodeBatch :exec
 UPDATE shield_recovery_codes
@@ -10,3 +10,41 @@ SET
   evicted_by = @evicted_by,
   evicted_at = NOW()
 WHERE user_id = @user_id AND is_consumable = TRUE;
+
+-- name: FindUsableRecoveryCodesByUserID :many
+SELECT id, recovery_code_hash, is_consumable
+FROM shield_recovery_codes
+WHERE user_id = @user_id AND evicted_at IS NULL AND consumed_at IS NULL;
+
+-- name: FindUsableLegacyRecoveryCodesByUserID :many
+SELECT id, recovery_code_hash, is_consumable
+FROM shield_recovery_codes
+WHERE
+  user_id = @user_id
+  AND recovery_code_lookup IS NULL
+  AND evicted_at IS NULL
+  AND consumed_at IS NULL;
+
+-- name: FindUsableRecoveryCodeByLookup :one
+SELECT id, recovery_code_hash, is_consumable
+FROM shield_recovery_codes
+WHERE
+  user_id = @user_id
+  AND recovery_code_lookup = @recovery_code_lookup
+  AND evicted_at IS NULL
+  AND consumed_at IS NULL
+LIMIT 1;
+
+-- name: ConsumeRecoveryCode :execrows
+UPDATE shield_recovery_codes
+SET consumed_at = NOW()
+WHERE id = @id AND evicted_at IS NULL AND consumed_at IS NULL;
+
+-- name: CountRemainingRecoveryCodes :one
+SELECT COUNT(*)
+FROM shield_recovery_codes
+WHERE
+  user_id = @user_id
+  AND is_consumable = TRUE
+  AND evicted_at IS NULL
+  AND consumed_at IS NULL;
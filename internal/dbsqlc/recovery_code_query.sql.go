@@ -11,11 +11,43 @@ import (
 	typeid "go.jetify.com/typeid/v2"
 )
 
+const consumeRecoveryCode = `-- name: ConsumeRecoveryCode :execrows
+UPDATE shield_recovery_codes
+SET consumed_at = NOW()
+WHERE id = $1 AND evicted_at IS NULL AND consumed_at IS NULL
+`
+
+func (q *Queries) ConsumeRecoveryCode(ctx context.Context, db DBTX, id typeid.TypeID) (int64, error) {
+	result, err := db.Exec(ctx, consumeRecoveryCode, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const countRemainingRecoveryCodes = `-- name: CountRemainingRecoveryCodes :one
+SELECT COUNT(*)
+FROM shield_recovery_codes
+WHERE
+  user_id = $1
+  AND is_consumable = TRUE
+  AND evicted_at IS NULL
+  AND consumed_at IS NULL
+`
+
+func (q *Queries) CountRemainingRecoveryCodes(ctx context.Context, db DBTX, userID typeid.TypeID) (int64, error) {
+	row := db.QueryRow(ctx, countRemainingRecoveryCodes, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 type CreateRecoveryCodeBatchParams struct {
-	ID               typeid.TypeID
-	UserID           typeid.TypeID
-	RecoveryCodeHash string
-	IsConsumable     bool
+	ID                 typeid.TypeID
+	UserID             typeid.TypeID
+	RecoveryCodeHash   string
+	RecoveryCodeLookup *string
+	IsConsumable       bool
 }
 
 const evictUnconsumedRecoveryCodeBatch = `-- name: EvictUnconsumedRecoveryCodeBatch :exec
@@ -35,3 +67,100 @@ func (q *Queries) EvictUnconsumedRecoveryCodeBatch(ctx context.Context, db DBTX,
 	_, err := db.Exec(ctx, evictUnconsumedRecoveryCodeBatch, arg.EvictedBy, arg.UserID)
 	return err
 }
+
+const findUsableLegacyRecoveryCodesByUserID = `-- name: FindUsableLegacyRecoveryCodesByUserID :many
+SELECT id, recovery_code_hash, is_consumable
+FROM shield_recovery_codes
+WHERE
+  user_id = $1
+  AND recovery_code_lookup IS NULL
+  AND evicted_at IS NULL
+  AND consumed_at IS NULL
+`
+
+type FindUsableLegacyRecoveryCodesByUserIDRow struct {
+	ID               typeid.TypeID
+	RecoveryCodeHash string
+	IsConsumable     bool
+}
+
+func (q *Queries) FindUsableLegacyRecoveryCodesByUserID(ctx context.Context, db DBTX, userID typeid.TypeID) ([]FindUsableLegacyRecoveryCodesByUserIDRow, error) {
+	rows, err := db.Query(ctx, findUsableLegacyRecoveryCodesByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FindUsableLegacyRecoveryCodesByUserIDRow
+	for rows.Next() {
+		var i FindUsableLegacyRecoveryCodesByUserIDRow
+		if err := rows.Scan(&i.ID, &i.RecoveryCodeHash, &i.IsConsumable); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const findUsableRecoveryCodeByLookup = `-- name: FindUsableRecoveryCodeByLookup :one
+SELECT id, recovery_code_hash, is_consumable
+FROM shield_recovery_codes
+WHERE
+  user_id = $1
+  AND recovery_code_lookup = $2
+  AND evicted_at IS NULL
+  AND consumed_at IS NULL
+LIMIT 1
+`
+
+type FindUsableRecoveryCodeByLookupParams struct {
+	UserID             typeid.TypeID
+	RecoveryCodeLookup *string
+}
+
+type FindUsableRecoveryCodeByLookupRow struct {
+	ID               typeid.TypeID
+	RecoveryCodeHash string
+	IsConsumable     bool
+}
+
+func (q *Queries) FindUsableRecoveryCodeByLookup(ctx context.Context, db DBTX, arg FindUsableRecoveryCodeByLookupParams) (FindUsableRecoveryCodeByLookupRow, error) {
+	row := db.QueryRow(ctx, findUsableRecoveryCodeByLookup, arg.UserID, arg.RecoveryCodeLookup)
+	var i FindUsableRecoveryCodeByLookupRow
+	err := row.Scan(&i.ID, &i.RecoveryCodeHash, &i.IsConsumable)
+	return i, err
+}
+
+const findUsableRecoveryCodesByUserID = `-- name: FindUsableRecoveryCodesByUserID :many
+SELECT id, recovery_code_hash, is_consumable
+FROM shield_recovery_codes
+WHERE user_id = $1 AND evicted_at IS NULL AND consumed_at IS NULL
+`
+
+type FindUsableRecoveryCodesByUserIDRow struct {
+	ID               typeid.TypeID
+	RecoveryCodeHash string
+	IsConsumable     bool
+}
+
+func (q *Queries) FindUsableRecoveryCodesByUserID(ctx context.Context, db DBTX, userID typeid.TypeID) ([]FindUsableRecoveryCodesByUserIDRow, error) {
+	rows, err := db.Query(ctx, findUsableRecoveryCodesByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []FindUsableRecoveryCodesByUserIDRow
+	for rows.Next() {
+		var i FindUsableRecoveryCodesByUserIDRow
+		if err := rows.Scan(&i.ID, &i.RecoveryCodeHash, &i.IsConsumable); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
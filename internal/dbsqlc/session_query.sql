@@ -35,3 +35,23 @@ SET
   evicted_by = @evicted_by
 WHERE user_id = @user_id AND id != ANY (@session_ids::TEXT[])
 RETURNING id;
+
+-- name: FindPendingMFASessionByID :one
+SELECT *
+FROM shield_user_sessions
+WHERE id = @id AND is_mfa_required = TRUE AND expires_at > NOW()
+LIMIT 1;
+
+-- name: IncrementSessionMFAAttempts :one
+UPDATE shield_user_sessions
+SET mfa_attempts = mfa_attempts + 1
+WHERE id = @id AND is_mfa_required = TRUE AND expires_at > NOW()
+RETURNING mfa_attempts;
+
+-- name: CompleteSessionMFA :execrows
+UPDATE shield_user_sessions
+SET is_mfa_required = FALSE
+WHERE id = @id AND is_mfa_required = TRUE AND expires_at > NOW();
+
+-- name: DeleteSessionByID :exec
+DELETE FROM shield_user_sessions WHERE id = @id;
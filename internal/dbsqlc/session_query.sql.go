@@ -13,7 +13,7 @@ import (
 )
 
 const allActiveSessions = `-- name: AllActiveSessions :many
-SELECT id, created_at, updated_at, expires_at, user_id, evicted_by, is_mfa_required
+SELECT id, created_at, updated_at, expires_at, user_id, evicted_by, is_mfa_required, mfa_attempts
 FROM shield_user_sessions
 WHERE user_id = $1 AND expires_at > NOW()
 `
@@ -35,6 +35,7 @@ func (q *Queries) AllActiveSessions(ctx context.Context, db DBTX, userID typeid.
 			&i.UserID,
 			&i.EvictedBy,
 			&i.IsMfaRequired,
+			&i.MfaAttempts,
 		); err != nil {
 			return nil, err
 		}
@@ -46,6 +47,20 @@ func (q *Queries) AllActiveSessions(ctx context.Context, db DBTX, userID typeid.
 	return items, nil
 }
 
+const completeSessionMFA = `-- name: CompleteSessionMFA :execrows
+UPDATE shield_user_sessions
+SET is_mfa_required = FALSE
+WHERE id = $1 AND is_mfa_required = TRUE AND expires_at > NOW()
+`
+
+func (q *Queries) CompleteSessionMFA(ctx context.Context, db DBTX, id typeid.TypeID) (int64, error) {
+	result, err := db.Exec(ctx, completeSessionMFA, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const createUserSession = `-- name: CreateUserSession :one
 INSERT INTO shield_user_sessions (id, user_id, expires_at, is_mfa_required)
 VALUES ($1, $2, $3, $4)
@@ -71,6 +86,15 @@ func (q *Queries) CreateUserSession(ctx context.Context, db DBTX, arg CreateUser
 	return id, err
 }
 
+const deleteSessionByID = `-- name: DeleteSessionByID :exec
+DELETE FROM shield_user_sessions WHERE id = $1
+`
+
+func (q *Queries) DeleteSessionByID(ctx context.Context, db DBTX, id typeid.TypeID) error {
+	_, err := db.Exec(ctx, deleteSessionByID, id)
+	return err
+}
+
 const expireAllSessionsByUserID = `-- name: ExpireAllSessionsByUserID :many
 UPDATE shield_user_sessions
 SET
@@ -154,7 +178,7 @@ func (q *Queries) ExpireSomeSessionsByUserID(ctx context.Context, db DBTX, arg E
 }
 
 const findActiveSessionByID = `-- name: FindActiveSessionByID :one
-SELECT id, created_at, updated_at, expires_at, user_id, evicted_by, is_mfa_required
+SELECT id, created_at, updated_at, expires_at, user_id, evicted_by, is_mfa_required, mfa_attempts
 FROM shield_user_sessions
 WHERE id = $1 AND expires_at > NOW()
 LIMIT 1
@@ -171,6 +195,44 @@ func (q *Queries) FindActiveSessionByID(ctx context.Context, db DBTX, id typeid.
 		&i.UserID,
 		&i.EvictedBy,
 		&i.IsMfaRequired,
+		&i.MfaAttempts,
 	)
 	return i, err
 }
+
+const findPendingMFASessionByID = `-- name: FindPendingMFASessionByID :one
+SELECT id, created_at, updated_at, expires_at, user_id, evicted_by, is_mfa_required, mfa_attempts
+FROM shield_user_sessions
+WHERE id = $1 AND is_mfa_required = TRUE AND expires_at > NOW()
+LIMIT 1
+`
+
+func (q *Queries) FindPendingMFASessionByID(ctx context.Context, db DBTX, id typeid.TypeID) (ShieldUserSession, error) {
+	row := db.QueryRow(ctx, findPendingMFASessionByID, id)
+	var i ShieldUserSession
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ExpiresAt,
+		&i.UserID,
+		&i.EvictedBy,
+		&i.IsMfaRequired,
+		&i.MfaAttempts,
+	)
+	return i, err
+}
+
+const incrementSessionMFAAttempts = `-- name: IncrementSessionMFAAttempts :one
+UPDATE shield_user_sessions
+SET mfa_attempts = mfa_attempts + 1
+WHERE id = $1 AND is_mfa_required = TRUE AND expires_at > NOW()
+RETURNING mfa_attempts
+`
+
+func (q *Queries) IncrementSessionMFAAttempts(ctx context.Context, db DBTX, id typeid.TypeID) (int32, error) {
+	row := db.QueryRow(ctx, incrementSessionMFAAttempts, id)
+	var mfa_attempts int32
+	err := row.Scan(&mfa_attempts)
+	return mfa_attempts, err
+}
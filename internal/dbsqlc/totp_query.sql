@@ -0,0 +1,31 @@
+-- name: UpsertUnconfirmedUserTOTP :execrows
+INSERT INTO shield_user_totps (id, user_id, encrypted_secret)
+VALUES (@id, @user_id, @encrypted_secret)
+ON CONFLICT (user_id) DO UPDATE
+  SET encrypted_secret = excluded.encrypted_secret
+  WHERE shield_user_totps.is_confirmed = FALSE;
+
+-- name: FindUserTOTPByUserID :one
+SELECT *
+FROM shield_user_totps
+WHERE user_id = @user_id
+LIMIT 1;
+
+-- name: ConfirmUserTOTP :execrows
+UPDATE shield_user_totps
+SET
+  is_confirmed = TRUE,
+  confirmed_at = NOW(),
+  last_used_step = @last_used_step
+WHERE user_id = @user_id AND is_confirmed = FALSE;
+
+-- name: UseUserTOTPStep :execrows
+UPDATE shield_user_totps
+SET last_used_step = @last_used_step
+WHERE
+  user_id = @user_id
+  AND is_confirmed = TRUE
+  AND last_used_step < @last_used_step;
+
+-- name: DeleteUserTOTP :exec
+DELETE FROM shield_user_totps WHERE user_id = @user_id;
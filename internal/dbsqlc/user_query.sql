@@ -8,25 +8,46 @@ SELECT * FROM shield_users WHERE id = @id LIMIT 1;
 -- name: FindUserByEmail :one
 SELECT * FROM shield_users WHERE email = @email LIMIT 1;
 
--- name: ChangeUserEmailByID :exec
+-- name: ChangeUserEmailByID :execrows
 UPDATE shield_users
-SET email = @email
+SET
+  email = @new_email,
+  is_email_verified = @is_email_verified
+WHERE id = @id AND email = @old_email;
+
+-- name: MarkUserEmailAsVerifiedByID :exec
+UPDATE shield_users
+SET is_email_verified = TRUE
 WHERE id = @id;
 
+-- name: MarkUserEmailAsVerifiedByIDAndEmail :execrows
+UPDATE shield_users
+SET is_email_verified = TRUE
+WHERE id = @id AND email = @email;
+
 -- name: UpsertEmailVerificationToken :one
 WITH
   token AS (
     INSERT INTO shield_user_email_verification_tokens
-      (id, user_id, token, is_used)
+      (id, user_id, email, token_hash, expires_at, is_used)
     VALUES
-      (@id, @user_id, @token, @expires_at, FALSE)
-    ON CONFLICT (user_id, is_used) DO NOTHING
-    RETURNING token, id
+      (@id, @user_id, @email, @token_hash, @expires_at, FALSE)
+    ON CONFLICT (user_id) WHERE is_used = FALSE DO UPDATE
+      SET
+        email = excluded.email,
+        token_hash = excluded.token_hash,
+        expires_at = excluded.expires_at
+    RETURNING id, expires_at
   )
 SELECT *
 FROM token;
 
--- name: MarkUserEmailVerificationTokenAsUsed :exec
+-- name: ConsumeEmailVerificationToken :one
 UPDATE shield_user_email_verification_tokens
 SET is_used = TRUE
-WHERE token = @token;
+WHERE token_hash = @token_hash AND is_used = FALSE AND expires_at > NOW()
+RETURNING user_id, email;
+
+-- name: DeleteExpiredEmailVerificationTokens :execrows
+DELETE FROM shield_user_email_verification_tokens
+WHERE expires_at < NOW();
@@ -7,24 +7,56 @@ package dbsqlc
 
 import (
 	"context"
+	"time"
 
 	typeid "go.jetify.com/typeid/v2"
 )
 
-const changeUserEmailByID = `-- name: ChangeUserEmailByID :exec
+const changeUserEmailByID = `-- name: ChangeUserEmailByID :execrows
 UPDATE shield_users
-SET email = $1
-WHERE id = $2
+SET
+  email = $1,
+  is_email_verified = $2
+WHERE id = $3 AND email = $4
 `
 
 type ChangeUserEmailByIDParams struct {
-	Email string
-	ID    typeid.TypeID
+	NewEmail        string
+	IsEmailVerified bool
+	ID              typeid.TypeID
+	OldEmail        string
 }
 
-func (q *Queries) ChangeUserEmailByID(ctx context.Context, db DBTX, arg ChangeUserEmailByIDParams) error {
-	_, err := db.Exec(ctx, changeUserEmailByID, arg.Email, arg.ID)
-	return err
+func (q *Queries) ChangeUserEmailByID(ctx context.Context, db DBTX, arg ChangeUserEmailByIDParams) (int64, error) {
+	result, err := db.Exec(ctx, changeUserEmailByID,
+		arg.NewEmail,
+		arg.IsEmailVerified,
+		arg.ID,
+		arg.OldEmail,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const consumeEmailVerificationToken = `-- name: ConsumeEmailVerificationToken :one
+UPDATE shield_user_email_verification_tokens
+SET is_used = TRUE
+WHERE token_hash = $1 AND is_used = FALSE AND expires_at > NOW()
+RETURNING user_id, email
+`
+
+type ConsumeEmailVerificationTokenRow struct {
+	UserID typeid.TypeID
+	Email  string
+}
+
+func (q *Queries) ConsumeEmailVerificationToken(ctx context.Context, db DBTX, tokenHash string) (ConsumeEmailVerificationTokenRow, error) {
+	row := db.QueryRow(ctx, consumeEmailVerificationToken, tokenHash)
+	var i ConsumeEmailVerificationTokenRow
+	err := row.Scan(&i.UserID, &i.Email)
+	return i, err
 }
 
 const createUser = `-- name: CreateUser :exec
@@ -42,6 +74,19 @@ func (q *Queries) CreateUser(ctx context.Context, db DBTX, arg CreateUserParams)
 	return err
 }
 
+const deleteExpiredEmailVerificationTokens = `-- name: DeleteExpiredEmailVerificationTokens :execrows
+DELETE FROM shield_user_email_verification_tokens
+WHERE expires_at < NOW()
+`
+
+func (q *Queries) DeleteExpiredEmailVerificationTokens(ctx context.Context, db DBTX) (int64, error) {
+	result, err := db.Exec(ctx, deleteExpiredEmailVerificationTokens)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const findUserByEmail = `-- name: FindUserByEmail :one
 SELECT id, created_at, updated_at, email, is_email_verified FROM shield_users WHERE email = $1 LIMIT 1
 `
@@ -76,51 +121,76 @@ func (q *Queries) FindUserByID(ctx context.Context, db DBTX, id typeid.TypeID) (
 	return i, err
 }
 
-const markUserEmailVerificationTokenAsUsed = `-- name: MarkUserEmailVerificationTokenAsUsed :exec
-UPDATE shield_user_email_verification_tokens
-SET is_used = TRUE
-WHERE token = $1
+const markUserEmailAsVerifiedByID = `-- name: MarkUserEmailAsVerifiedByID :exec
+UPDATE shield_users
+SET is_email_verified = TRUE
+WHERE id = $1
 `
 
-func (q *Queries) MarkUserEmailVerificationTokenAsUsed(ctx context.Context, db DBTX, token string) error {
-	_, err := db.Exec(ctx, markUserEmailVerificationTokenAsUsed, token)
+func (q *Queries) MarkUserEmailAsVerifiedByID(ctx context.Context, db DBTX, id typeid.TypeID) error {
+	_, err := db.Exec(ctx, markUserEmailAsVerifiedByID, id)
 	return err
 }
 
+const markUserEmailAsVerifiedByIDAndEmail = `-- name: MarkUserEmailAsVerifiedByIDAndEmail :execrows
+UPDATE shield_users
+SET is_email_verified = TRUE
+WHERE id = $1 AND email = $2
+`
+
+type MarkUserEmailAsVerifiedByIDAndEmailParams struct {
+	ID    typeid.TypeID
+	Email string
+}
+
+func (q *Queries) MarkUserEmailAsVerifiedByIDAndEmail(ctx context.Context, db DBTX, arg MarkUserEmailAsVerifiedByIDAndEmailParams) (int64, error) {
+	result, err := db.Exec(ctx, markUserEmailAsVerifiedByIDAndEmail, arg.ID, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const upsertEmailVerificationToken = `-- name: UpsertEmailVerificationToken :one
 WITH
   token AS (
     INSERT INTO shield_user_email_verification_tokens
-      (id, user_id, token, is_used)
+      (id, user_id, email, token_hash, expires_at, is_used)
     VALUES
-      ($1, $2, $3, $4, FALSE)
-    ON CONFLICT (user_id, is_used) DO NOTHING
-    RETURNING token, id
+      ($1, $2, $3, $4, $5, FALSE)
+    ON CONFLICT (user_id) WHERE is_used = FALSE DO UPDATE
+      SET
+        email = excluded.email,
+        token_hash = excluded.token_hash,
+        expires_at = excluded.expires_at
+    RETURNING id, expires_at
   )
-SELECT token, id
+SELECT id, expires_at
 FROM token
 `
 
 type UpsertEmailVerificationTokenParams struct {
 	ID        typeid.TypeID
 	UserID    typeid.TypeID
-	Token     string
-	ExpiresAt bool
+	Email     string
+	TokenHash string
+	ExpiresAt time.Time
 }
 
 type UpsertEmailVerificationTokenRow struct {
-	Token string
-	ID    string
+	ID        string
+	ExpiresAt time.Time
 }
 
 func (q *Queries) UpsertEmailVerificationToken(ctx context.Context, db DBTX, arg UpsertEmailVerificationTokenParams) (UpsertEmailVerificationTokenRow, error) {
 	row := db.QueryRow(ctx, upsertEmailVerificationToken,
 		arg.ID,
 		arg.UserID,
-		arg.Token,
+		arg.Email,
+		arg.TokenHash,
 		arg.ExpiresAt,
 	)
 	var i UpsertEmailVerificationTokenRow
-	err := row.Scan(&i.Token, &i.ID)
+	err := row.Scan(&i.ID, &i.ExpiresAt)
 	return i, err
 }
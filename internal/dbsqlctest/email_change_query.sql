@@ -0,0 +1,3 @@
+-- name: TestFindPendingEmailChangesByUserID :many
+SELECT * FROM shield_user_email_changes
+WHERE user_id = @user_id AND confirmed_at IS NULL AND reverted_at IS NULL;
@@ -0,0 +1,9 @@
+-- name: TestFindUserEmailOTPByUserID :one
+SELECT * FROM shield_user_email_otps WHERE user_id = @user_id LIMIT 1;
+
+-- name: TestExpireUserEmailOTP :exec
+UPDATE shield_user_email_otps
+SET
+  created_at = created_at - INTERVAL '1 day',
+  expires_at = created_at - INTERVAL '1 hour'
+WHERE user_id = @user_id;
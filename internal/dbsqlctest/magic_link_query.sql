@@ -0,0 +1,6 @@
+-- name: TestExpireMagicLinkTokensByEmail :exec
+UPDATE shield_magic_link_tokens
+SET
+  created_at = created_at - INTERVAL '1 day',
+  expires_at = created_at - INTERVAL '1 hour'
+WHERE email = @email;
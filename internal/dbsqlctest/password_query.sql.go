@@ -16,7 +16,7 @@ INSERT INTO shield_user_credentials
   (id, name, user_id, user_credential_key, user_credential_secret)
 VALUES
   ($1, 'password', $2, $3, $4)
-RETURNING id, created_at, updated_at, name, user_id, user_credential_key, user_credential_secret
+RETURNING id, created_at, updated_at, name, user_id, user_credential_key, user_credential_secret, rotated_at
 `
 
 type TestCreatePasswordParams struct {
@@ -42,6 +42,7 @@ func (q *Queries) TestCreatePassword(ctx context.Context, db DBTX, arg TestCreat
 		&i.UserID,
 		&i.UserCredentialKey,
 		&i.UserCredentialSecret,
+		&i.RotatedAt,
 	)
 	return i, err
 }
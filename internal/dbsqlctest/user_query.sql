@@ -8,3 +8,8 @@ SELECT * FROM shield_users;
 INSERT INTO shield_users (id, email, is_email_verified)
 VALUES (@id, @email, @is_email_verified)
 RETURNING *;
+
+-- name: TestExpireEmailVerificationTokensByUserID :exec
+UPDATE shield_user_email_verification_tokens
+SET expires_at = NOW() - INTERVAL '1 hour'
+WHERE user_id = @user_id;
@@ -36,6 +36,17 @@ func (q *Queries) TestCreateUser(ctx context.Context, db DBTX, arg TestCreateUse
 	return i, err
 }
 
+const testExpireEmailVerificationTokensByUserID = `-- name: TestExpireEmailVerificationTokensByUserID :exec
+UPDATE shield_user_email_verification_tokens
+SET expires_at = NOW() - INTERVAL '1 hour'
+WHERE user_id = $1
+`
+
+func (q *Queries) TestExpireEmailVerificationTokensByUserID(ctx context.Context, db DBTX, userID typeid.TypeID) error {
+	_, err := db.Exec(ctx, testExpireEmailVerificationTokensByUserID, userID)
+	return err
+}
+
 const testFindAllUsers = `-- name: TestFindAllUsers :many
 SELECT id, created_at, updated_at, email, is_email_verified FROM shield_users
 `
@@ -0,0 +1,28 @@
+-- migration: 20261017090000_passkey_session.sql
+
+CREATE UNLOGGED TABLE IF NOT EXISTS shield_passkey_sessions (
+  id VARCHAR(64) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  ceremony VARCHAR(255) NOT NULL,
+  user_id VARCHAR(64) NOT NULL,
+  session_data JSONB NOT NULL,
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  PRIMARY KEY (id),
+  FOREIGN KEY (user_id) REFERENCES shield_users (id)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE,
+  CHECK (ceremony IN ('login', 'registration')),
+  CHECK (expires_at > created_at)
+);
+
+DROP TRIGGER IF EXISTS shield_trigger_autoupdate_updated_at_shield_passkey_sessions ON shield_passkey_sessions;
+CREATE TRIGGER shield_trigger_autoupdate_updated_at_shield_passkey_sessions
+BEFORE UPDATE ON shield_passkey_sessions
+FOR EACH ROW
+EXECUTE FUNCTION shield_fn_autoupdate_updated_at();
+
+---- create above / drop below ----
+
+DROP TRIGGER IF EXISTS shield_trigger_autoupdate_updated_at_shield_passkey_sessions ON shield_passkey_sessions;
+DROP TABLE IF EXISTS shield_passkey_sessions;
@@ -0,0 +1,41 @@
+-- migration: 20261017100000_passkey.sql
+
+CREATE TABLE IF NOT EXISTS shield_user_passkeys (
+  id VARCHAR(64) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  last_used_at TIMESTAMP WITH TIME ZONE NULL DEFAULT NULL,
+  user_id VARCHAR(64) NOT NULL,
+  name VARCHAR(255) NOT NULL,
+  credential_id BYTEA NOT NULL,
+  public_key BYTEA NOT NULL,
+  attestation_type VARCHAR(255) NOT NULL,
+  attestation JSONB NOT NULL,
+  transports VARCHAR(255)[] NOT NULL DEFAULT '{}',
+  aaguid BYTEA NOT NULL,
+  sign_count BIGINT NOT NULL DEFAULT 0,
+  clone_warning BOOLEAN NOT NULL DEFAULT FALSE,
+  attachment VARCHAR(255) NOT NULL DEFAULT '',
+  is_user_present BOOLEAN NOT NULL DEFAULT FALSE,
+  is_user_verified BOOLEAN NOT NULL DEFAULT FALSE,
+  is_backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+  is_backup_state BOOLEAN NOT NULL DEFAULT FALSE,
+  PRIMARY KEY (id),
+  UNIQUE (credential_id),
+  FOREIGN KEY (user_id) REFERENCES shield_users (id)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE
+);
+
+CREATE INDEX sup_user_id_idx ON shield_user_passkeys (user_id);
+
+DROP TRIGGER IF EXISTS shield_trigger_autoupdate_updated_at_shield_user_passkeys ON shield_user_passkeys;
+CREATE TRIGGER shield_trigger_autoupdate_updated_at_shield_user_passkeys
+BEFORE UPDATE ON shield_user_passkeys
+FOR EACH ROW
+EXECUTE FUNCTION shield_fn_autoupdate_updated_at();
+
+---- create above / drop below ----
+
+DROP TRIGGER IF EXISTS shield_trigger_autoupdate_updated_at_shield_user_passkeys ON shield_user_passkeys;
+DROP TABLE IF EXISTS shield_user_passkeys;
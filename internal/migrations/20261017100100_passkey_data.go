@@ -0,0 +1,230 @@
+package migrations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jackc/pgx/v5"
+
+	"go.inout.gg/shield/internal/tid"
+)
+
+// Moves passkeys stored as a single JSON-encoded list of credentials
+// in shield_user_credentials to shield_user_passkeys, one row per credential.
+
+//nolint:gochecknoinits
+func init() {
+	Registry.Up(up20261017100100)
+	Registry.Down(down20261017100100)
+}
+
+func up20261017100100(ctx context.Context, conn *pgx.Conn) error {
+	rows, err := conn.Query(ctx, `
+SELECT user_id, user_credential_secret
+FROM shield_user_credentials
+WHERE name = 'passkey'`)
+	if err != nil {
+		return fmt.Errorf("shield: failed to query passkey credentials: %w", err)
+	}
+
+	type row struct {
+		userID      string
+		credentials []webauthn.Credential
+	}
+
+	var legacy []row
+
+	for rows.Next() {
+		var (
+			r      row
+			secret string
+		)
+
+		if err := rows.Scan(&r.userID, &secret); err != nil {
+			return fmt.Errorf("shield: failed to scan passkey credential: %w", err)
+		}
+
+		if err := json.Unmarshal([]byte(secret), &r.credentials); err != nil {
+			return fmt.Errorf("shield: failed to decode passkey credential: %w", err)
+		}
+
+		legacy = append(legacy, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("shield: failed to query passkey credentials: %w", err)
+	}
+
+	for _, r := range legacy {
+		for _, c := range r.credentials {
+			attestation, err := json.Marshal(c.Attestation)
+			if err != nil {
+				return fmt.Errorf("shield: failed to encode passkey attestation: %w", err)
+			}
+
+			transports := make([]string, len(c.Transport))
+			for i, t := range c.Transport {
+				transports[i] = string(t)
+			}
+
+			if _, err := conn.Exec(ctx, `
+INSERT INTO shield_user_passkeys
+  (
+    id,
+    user_id,
+    name,
+    credential_id,
+    public_key,
+    attestation_type,
+    attestation,
+    transports,
+    aaguid,
+    sign_count,
+    clone_warning,
+    attachment,
+    is_user_present,
+    is_user_verified,
+    is_backup_eligible,
+    is_backup_state
+  )
+VALUES
+  ($1, $2, 'Passkey', $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)`,
+				tid.MustPasskeyID().String(),
+				r.userID,
+				c.ID,
+				c.PublicKey,
+				c.AttestationType,
+				attestation,
+				transports,
+				c.Authenticator.AAGUID,
+				int64(c.Authenticator.SignCount),
+				c.Authenticator.CloneWarning,
+				string(c.Authenticator.Attachment),
+				c.Flags.UserPresent,
+				c.Flags.UserVerified,
+				c.Flags.BackupEligible,
+				c.Flags.BackupState,
+			); err != nil {
+				return fmt.Errorf("shield: failed to move passkey credential: %w", err)
+			}
+		}
+	}
+
+	if _, err := conn.Exec(ctx, `DELETE FROM shield_user_credentials WHERE name = 'passkey'`); err != nil {
+		return fmt.Errorf("shield: failed to delete passkey credentials: %w", err)
+	}
+
+	return nil
+}
+
+func down20261017100100(ctx context.Context, conn *pgx.Conn) error {
+	rows, err := conn.Query(ctx, `
+SELECT
+  p.user_id,
+  u.email,
+  p.credential_id,
+  p.public_key,
+  p.attestation_type,
+  p.attestation,
+  p.transports,
+  p.aaguid,
+  p.sign_count,
+  p.clone_warning,
+  p.attachment,
+  p.is_user_present,
+  p.is_user_verified,
+  p.is_backup_eligible,
+  p.is_backup_state
+FROM
+  shield_user_passkeys AS p
+  JOIN shield_users AS u ON u.id = p.user_id
+ORDER BY p.user_id, p.created_at`)
+	if err != nil {
+		return fmt.Errorf("shield: failed to query passkeys: %w", err)
+	}
+
+	type row struct {
+		userID      string
+		email       string
+		credentials []webauthn.Credential
+	}
+
+	var grouped []*row
+
+	for rows.Next() {
+		var (
+			userID, email, attachment string
+			attestation               []byte
+			transports                []string
+			signCount                 int64
+			c                         webauthn.Credential
+		)
+
+		if err := rows.Scan(
+			&userID,
+			&email,
+			&c.ID,
+			&c.PublicKey,
+			&c.AttestationType,
+			&attestation,
+			&transports,
+			&c.Authenticator.AAGUID,
+			&signCount,
+			&c.Authenticator.CloneWarning,
+			&attachment,
+			&c.Flags.UserPresent,
+			&c.Flags.UserVerified,
+			&c.Flags.BackupEligible,
+			&c.Flags.BackupState,
+		); err != nil {
+			return fmt.Errorf("shield: failed to scan passkey: %w", err)
+		}
+
+		if err := json.Unmarshal(attestation, &c.Attestation); err != nil {
+			return fmt.Errorf("shield: failed to decode passkey attestation: %w", err)
+		}
+
+		c.Authenticator.SignCount = uint32(signCount) //nolint:gosec
+		c.Authenticator.Attachment = protocol.AuthenticatorAttachment(attachment)
+
+		for _, t := range transports {
+			c.Transport = append(c.Transport, protocol.AuthenticatorTransport(t))
+		}
+
+		if len(grouped) == 0 || grouped[len(grouped)-1].userID != userID {
+			grouped = append(grouped, &row{userID: userID, email: email, credentials: nil})
+		}
+
+		last := grouped[len(grouped)-1]
+		last.credentials = append(last.credentials, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("shield: failed to query passkeys: %w", err)
+	}
+
+	for _, r := range grouped {
+		secret, err := json.Marshal(r.credentials)
+		if err != nil {
+			return fmt.Errorf("shield: failed to encode passkey credentials: %w", err)
+		}
+
+		if _, err := conn.Exec(ctx, `
+INSERT INTO shield_user_credentials
+  (id, name, user_id, user_credential_key, user_credential_secret)
+VALUES
+  ($1, 'passkey', $2, $3, $4)`,
+			tid.MustCredentialID().String(),
+			r.userID,
+			r.email,
+			string(secret),
+		); err != nil {
+			return fmt.Errorf("shield: failed to restore passkey credential: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,10 @@
+-- migration: 20261017110000_passkey_discoverable.sql
+
+-- Discoverable (usernameless) logins are started without knowing the user.
+ALTER TABLE shield_passkey_sessions ALTER COLUMN user_id DROP NOT NULL;
+
+---- create above / drop below ----
+
+DELETE FROM shield_passkey_sessions WHERE user_id IS NULL;
+
+ALTER TABLE shield_passkey_sessions ALTER COLUMN user_id SET NOT NULL;
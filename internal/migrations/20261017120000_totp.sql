@@ -0,0 +1,29 @@
+-- migration: 20261017120000_totp.sql
+
+CREATE TABLE IF NOT EXISTS shield_user_totps (
+  id VARCHAR(64) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  user_id VARCHAR(64) NOT NULL,
+  encrypted_secret BYTEA NOT NULL,
+  is_confirmed BOOLEAN NOT NULL DEFAULT FALSE,
+  confirmed_at TIMESTAMP WITH TIME ZONE NULL DEFAULT NULL,
+  -- the last accepted time step, used to reject replayed codes.
+  last_used_step BIGINT NOT NULL DEFAULT 0,
+  PRIMARY KEY (id),
+  UNIQUE (user_id),
+  FOREIGN KEY (user_id) REFERENCES shield_users (id)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE
+);
+
+DROP TRIGGER IF EXISTS shield_trigger_autoupdate_updated_at_shield_user_totps ON shield_user_totps;
+CREATE TRIGGER shield_trigger_autoupdate_updated_at_shield_user_totps
+BEFORE UPDATE ON shield_user_totps
+FOR EACH ROW
+EXECUTE FUNCTION shield_fn_autoupdate_updated_at();
+
+---- create above / drop below ----
+
+DROP TRIGGER IF EXISTS shield_trigger_autoupdate_updated_at_shield_user_totps ON shield_user_totps;
+DROP TABLE IF EXISTS shield_user_totps;
@@ -0,0 +1,26 @@
+-- migration: 20261017130000_mfa_challenge.sql
+
+-- Number of failed second factor verifications of a partially issued session.
+ALTER TABLE shield_user_sessions
+ADD COLUMN mfa_attempts INTEGER NOT NULL DEFAULT 0;
+
+-- Passkeys can be used as a second factor.
+ALTER TABLE shield_passkey_sessions
+DROP CONSTRAINT IF EXISTS shield_passkey_sessions_ceremony_check;
+
+ALTER TABLE shield_passkey_sessions
+ADD CONSTRAINT shield_passkey_sessions_ceremony_check
+CHECK (ceremony IN ('login', 'registration', 'mfa'));
+
+---- create above / drop below ----
+
+DELETE FROM shield_passkey_sessions WHERE ceremony = 'mfa';
+
+ALTER TABLE shield_passkey_sessions
+DROP CONSTRAINT IF EXISTS shield_passkey_sessions_ceremony_check;
+
+ALTER TABLE shield_passkey_sessions
+ADD CONSTRAINT shield_passkey_sessions_ceremony_check
+CHECK (ceremony IN ('login', 'registration'));
+
+ALTER TABLE shield_user_sessions DROP COLUMN mfa_attempts;
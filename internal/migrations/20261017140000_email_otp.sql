@@ -0,0 +1,29 @@
+-- migration: 20261017140000_email_otp.sql
+
+CREATE UNLOGGED TABLE IF NOT EXISTS shield_user_email_otps (
+  id VARCHAR(64) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  user_id VARCHAR(64) NOT NULL,
+  code_hash BYTEA NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  used_at TIMESTAMP WITH TIME ZONE NULL DEFAULT NULL,
+  PRIMARY KEY (id),
+  UNIQUE (user_id),
+  FOREIGN KEY (user_id) REFERENCES shield_users (id)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE,
+  CHECK (expires_at > created_at)
+);
+
+DROP TRIGGER IF EXISTS shield_trigger_autoupdate_updated_at_shield_user_email_otps ON shield_user_email_otps;
+CREATE TRIGGER shield_trigger_autoupdate_updated_at_shield_user_email_otps
+BEFORE UPDATE ON shield_user_email_otps
+FOR EACH ROW
+EXECUTE FUNCTION shield_fn_autoupdate_updated_at();
+
+---- create above / drop below ----
+
+DROP TRIGGER IF EXISTS shield_trigger_autoupdate_updated_at_shield_user_email_otps ON shield_user_email_otps;
+DROP TABLE IF EXISTS shield_user_email_otps;
@@ -0,0 +1,8 @@
+-- migration: 20261017150000_recovery_code_consumption.sql
+
+ALTER TABLE shield_recovery_codes
+ADD COLUMN consumed_at TIMESTAMP WITH TIME ZONE NULL DEFAULT NULL;
+
+---- create above / drop below ----
+
+ALTER TABLE shield_recovery_codes DROP COLUMN consumed_at;
@@ -0,0 +1,16 @@
+-- migration: 20261017160000_recovery_code_lookup.sql
+
+-- Deterministic hashes of recovery codes, allowing to find a code without
+-- verifying it against every stored hash.
+ALTER TABLE shield_recovery_codes
+ADD COLUMN recovery_code_lookup VARCHAR(255) NULL DEFAULT NULL;
+
+CREATE INDEX src_user_id_recovery_code_lookup_idx
+ON shield_recovery_codes (user_id, recovery_code_lookup)
+WHERE recovery_code_lookup IS NOT NULL;
+
+---- create above / drop below ----
+
+DROP INDEX IF EXISTS src_user_id_recovery_code_lookup_idx;
+
+ALTER TABLE shield_recovery_codes DROP COLUMN recovery_code_lookup;
@@ -0,0 +1,13 @@
+-- migration: 20261017170000_password_rotation.sql
+
+-- Time the credential secret was last set by the user. Unlike updated_at,
+-- it's not affected by re-hashing the secret or changing the credential key,
+-- so it can be used to expire passwords.
+ALTER TABLE shield_user_credentials
+ADD COLUMN rotated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+UPDATE shield_user_credentials SET rotated_at = updated_at;
+
+---- create above / drop below ----
+
+ALTER TABLE shield_user_credentials DROP COLUMN rotated_at;
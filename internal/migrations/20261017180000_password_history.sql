@@ -0,0 +1,21 @@
+-- migration: 20261017180000_password_history.sql
+
+-- Previous password hashes of users, used to prevent password reuse.
+CREATE TABLE IF NOT EXISTS shield_user_password_histories (
+  id VARCHAR(64) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  user_id VARCHAR(64) NOT NULL,
+  password_hash VARCHAR(4095) NOT NULL,
+  PRIMARY KEY (id),
+  FOREIGN KEY (user_id) REFERENCES shield_users (id)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE
+);
+
+CREATE INDEX supwh_user_id_created_at_idx
+ON shield_user_password_histories (user_id, created_at DESC);
+
+---- create above / drop below ----
+
+DROP INDEX IF EXISTS supwh_user_id_created_at_idx;
+DROP TABLE IF EXISTS shield_user_password_histories;
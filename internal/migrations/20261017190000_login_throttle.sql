@@ -0,0 +1,27 @@
+-- migration: 20261017190000_login_throttle.sql
+
+-- Failed login attempts tracked per subject, e.g., a login email or a client IP.
+CREATE TABLE IF NOT EXISTS shield_login_throttles (
+  id VARCHAR(64) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  kind VARCHAR(16) NOT NULL,
+  subject VARCHAR(255) NOT NULL,
+  failures INTEGER NOT NULL DEFAULT 0,
+  last_failed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  locked_until TIMESTAMP WITH TIME ZONE NULL DEFAULT NULL,
+  PRIMARY KEY (id),
+  UNIQUE (kind, subject),
+  CHECK (kind IN ('user', 'ip'))
+);
+
+DROP TRIGGER IF EXISTS shield_trigger_autoupdate_updated_at_shield_login_throttles ON shield_login_throttles;
+CREATE TRIGGER shield_trigger_autoupdate_updated_at_shield_login_throttles
+BEFORE UPDATE ON shield_login_throttles
+FOR EACH ROW
+EXECUTE FUNCTION shield_fn_autoupdate_updated_at();
+
+---- create above / drop below ----
+
+DROP TRIGGER IF EXISTS shield_trigger_autoupdate_updated_at_shield_login_throttles ON shield_login_throttles;
+DROP TABLE IF EXISTS shield_login_throttles;
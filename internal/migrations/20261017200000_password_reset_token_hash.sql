@@ -0,0 +1,42 @@
+-- migration: 20261017200000_password_reset_token_hash.sql
+
+-- Password reset tokens are stored as hex-encoded SHA-256 digests, so that
+-- read access to the database doesn't allow to reset passwords.
+-- Expired tokens violate the CHECK (expires_at > CURRENT_TIMESTAMP) on
+-- update and are useless anyway.
+DELETE FROM shield_password_reset_tokens
+WHERE expires_at <= CURRENT_TIMESTAMP;
+
+ALTER TABLE shield_password_reset_tokens
+ALTER COLUMN token TYPE VARCHAR(64);
+
+UPDATE shield_password_reset_tokens
+SET token = encode(sha256(convert_to(token, 'UTF8')), 'hex');
+
+ALTER TABLE shield_password_reset_tokens
+RENAME COLUMN token TO token_hash;
+
+-- Allow a single pending token per user, while keeping any number of used
+-- ones.
+ALTER TABLE shield_password_reset_tokens
+DROP CONSTRAINT IF EXISTS shield_password_reset_tokens_user_id_is_used_key;
+
+CREATE UNIQUE INDEX sprt_user_id_pending_idx
+ON shield_password_reset_tokens (user_id)
+WHERE is_used = FALSE;
+
+---- create above / drop below ----
+
+DROP INDEX IF EXISTS sprt_user_id_pending_idx;
+
+-- Digests cannot be converted back to tokens.
+DELETE FROM shield_password_reset_tokens;
+
+ALTER TABLE shield_password_reset_tokens
+RENAME COLUMN token_hash TO token;
+
+ALTER TABLE shield_password_reset_tokens
+ALTER COLUMN token TYPE VARCHAR(16);
+
+ALTER TABLE shield_password_reset_tokens
+ADD CONSTRAINT shield_password_reset_tokens_user_id_is_used_key UNIQUE (user_id, is_used);
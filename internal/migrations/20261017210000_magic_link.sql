@@ -0,0 +1,22 @@
+-- migration: 20261017210000_magic_link.sql
+
+-- Single-use passwordless login tokens bound to an email, the user might
+-- not exist yet. Only SHA-256 digests of the tokens are stored.
+CREATE UNLOGGED TABLE IF NOT EXISTS shield_magic_link_tokens (
+  id VARCHAR(64) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  email VARCHAR(255) NOT NULL,
+  token_hash VARCHAR(64) NOT NULL,
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  used_at TIMESTAMP WITH TIME ZONE NULL DEFAULT NULL,
+  PRIMARY KEY (id),
+  UNIQUE (token_hash),
+  CHECK (expires_at > created_at)
+);
+
+CREATE INDEX smlt_email_idx ON shield_magic_link_tokens (email);
+
+---- create above / drop below ----
+
+DROP INDEX IF EXISTS smlt_email_idx;
+DROP TABLE IF EXISTS shield_magic_link_tokens;
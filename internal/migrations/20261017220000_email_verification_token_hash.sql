@@ -0,0 +1,43 @@
+-- migration: 20261017220000_email_verification_token_hash.sql
+
+-- Email verification tokens are stored as hex-encoded SHA-256 digests and
+-- expire. Tokens have never been issued before, so existing rows are
+-- discarded rather than converted.
+DELETE FROM shield_user_email_verification_tokens;
+
+ALTER TABLE shield_user_email_verification_tokens
+ALTER COLUMN token TYPE VARCHAR(64);
+
+ALTER TABLE shield_user_email_verification_tokens
+RENAME COLUMN token TO token_hash;
+
+ALTER TABLE shield_user_email_verification_tokens
+ADD COLUMN expires_at TIMESTAMP WITH TIME ZONE NOT NULL;
+
+-- Allow a single pending token per user, while keeping any number of used
+-- ones.
+ALTER TABLE shield_user_email_verification_tokens
+DROP CONSTRAINT IF EXISTS shield_user_email_verification_tokens_email_is_used_key;
+
+CREATE UNIQUE INDEX suevt_user_id_pending_idx
+ON shield_user_email_verification_tokens (user_id)
+WHERE is_used = FALSE;
+
+---- create above / drop below ----
+
+DROP INDEX IF EXISTS suevt_user_id_pending_idx;
+
+-- Digests cannot be converted back to tokens.
+DELETE FROM shield_user_email_verification_tokens;
+
+ALTER TABLE shield_user_email_verification_tokens
+DROP COLUMN IF EXISTS expires_at;
+
+ALTER TABLE shield_user_email_verification_tokens
+RENAME COLUMN token_hash TO token;
+
+ALTER TABLE shield_user_email_verification_tokens
+ALTER COLUMN token TYPE VARCHAR(16);
+
+ALTER TABLE shield_user_email_verification_tokens
+ADD CONSTRAINT shield_user_email_verification_tokens_email_is_used_key UNIQUE (email, is_used);
@@ -0,0 +1,42 @@
+-- migration: 20261017230000_email_change.sql
+
+-- Email changes pending confirmation from the new address. Once confirmed,
+-- the change can still be reverted from the old address until
+-- revert_expires_at. Only SHA-256 digests of the tokens are stored.
+CREATE TABLE IF NOT EXISTS shield_user_email_changes (
+  id VARCHAR(64) NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  user_id VARCHAR(64) NOT NULL,
+  old_email VARCHAR(255) NOT NULL,
+  new_email VARCHAR(255) NOT NULL,
+  confirm_token_hash VARCHAR(64) NOT NULL,
+  revert_token_hash VARCHAR(64) NOT NULL,
+  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  revert_expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  confirmed_at TIMESTAMP WITH TIME ZONE NULL DEFAULT NULL,
+  reverted_at TIMESTAMP WITH TIME ZONE NULL DEFAULT NULL,
+  PRIMARY KEY (id),
+  UNIQUE (confirm_token_hash),
+  UNIQUE (revert_token_hash),
+  FOREIGN KEY (user_id) REFERENCES shield_users (id)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE
+);
+
+-- Allow a single pending change per user.
+CREATE UNIQUE INDEX suec_user_id_pending_idx
+ON shield_user_email_changes (user_id)
+WHERE confirmed_at IS NULL AND reverted_at IS NULL;
+
+DROP TRIGGER IF EXISTS shield_trigger_autoupdate_updated_at_shield_user_email_changes ON shield_user_email_changes;
+CREATE TRIGGER shield_trigger_autoupdate_updated_at_shield_user_email_changes
+BEFORE UPDATE ON shield_user_email_changes
+FOR EACH ROW
+EXECUTE FUNCTION shield_fn_autoupdate_updated_at();
+
+---- create above / drop below ----
+
+DROP TRIGGER IF EXISTS shield_trigger_autoupdate_updated_at_shield_user_email_changes ON shield_user_email_changes;
+DROP INDEX IF EXISTS suec_user_id_pending_idx;
+DROP TABLE IF EXISTS shield_user_email_changes;
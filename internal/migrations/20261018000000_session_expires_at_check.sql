@@ -0,0 +1,15 @@
+-- migration: 20261018000000_session_expires_at_check.sql
+
+-- Sessions are expired by setting expires_at to the current time, which
+-- the CHECK (expires_at > CURRENT_TIMESTAMP) rejects, failing e.g. the
+-- expiration of all sessions of a user.
+ALTER TABLE shield_user_sessions
+DROP CONSTRAINT IF EXISTS shield_user_sessions_expires_at_check;
+
+---- create above / drop below ----
+
+DELETE FROM shield_user_sessions
+WHERE expires_at <= CURRENT_TIMESTAMP;
+
+ALTER TABLE shield_user_sessions
+ADD CONSTRAINT shield_user_sessions_expires_at_check CHECK (expires_at > CURRENT_TIMESTAMP);
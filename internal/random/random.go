@@ -2,6 +2,7 @@ package random
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 )
@@ -30,3 +31,12 @@ func SecureHexString(l int) (string, error) {
 
 	return hex.EncodeToString(bytes), nil
 }
+
+// HashToken returns the hex-encoded SHA-256 digest of the token tokStr.
+//
+// Only digests of tokens are stored in the database, so that read access
+// to it doesn't allow to use them. The plaintext token is sent to the user.
+func HashToken(tokStr string) string {
+	sum := sha256.Sum256([]byte(tokStr))
+	return hex.EncodeToString(sum[:])
+}
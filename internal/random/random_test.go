@@ -0,0 +1,15 @@
+package random
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashToken(t *testing.T) {
+	t.Parallel()
+
+	// echo -n token | sha256sum
+	assert.Equal(t, "3c469e9d6c5875d37a43f353d4f88e61fcf812c66eee3457465a40b0da4153e0", HashToken("token"))
+	assert.NotEqual(t, HashToken("token"), HashToken("token2"))
+}
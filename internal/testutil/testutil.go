@@ -0,0 +1,148 @@
+// Package testutil provides helpers for tests running against a database.
+package testutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+	"go.jetify.com/typeid/v2"
+
+	"go.inout.gg/shield"
+	"go.inout.gg/shield/internal/dbsqlctest"
+	"go.inout.gg/shield/internal/tid"
+	"go.inout.gg/shield/shieldmigrate"
+	"go.inout.gg/shield/shieldsession"
+)
+
+// migrationLockID is the ID of the advisory lock held while migrating, as
+// test packages run in parallel against the same database.
+const migrationLockID = 7_340_213
+
+//nolint:gochecknoglobals
+var migrate = sync.OnceValue(func() error {
+	ctx := context.Background()
+
+	conn, err := pgx.Connect(ctx, os.Getenv("DATABASE_URI"))
+	if err != nil {
+		return fmt.Errorf("testutil: failed to connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID); err != nil {
+		return fmt.Errorf("testutil: failed to acquire migration lock: %w", err)
+	}
+
+	defer func() { _, _ = conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID) }()
+
+	return shieldmigrate.New().Up(ctx, conn, nil)
+})
+
+// NewPool returns a connection pool to the test database with all
+// migrations applied.
+//
+// The database is configured with the DATABASE_URI environment variable,
+// the test is skipped if it's not set.
+func NewPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	uri := os.Getenv("DATABASE_URI")
+	if uri == "" {
+		t.Skip("testutil: DATABASE_URI is not set")
+	}
+
+	require.NoError(t, migrate())
+
+	pool, err := pgxpool.New(t.Context(), uri)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	return pool
+}
+
+// Email returns a unique email, so that tests sharing a database don't
+// conflict.
+func Email() string {
+	return tid.MustUserID().Suffix() + "@example.com"
+}
+
+// CreateUser creates a user with the given email.
+func CreateUser(t *testing.T, pool *pgxpool.Pool, email string, verified bool) dbsqlctest.ShieldUser {
+	t.Helper()
+
+	user, err := dbsqlctest.New().TestCreateUser(t.Context(), pool, dbsqlctest.TestCreateUserParams{
+		ID:              tid.MustUserID(),
+		Email:           email,
+		IsEmailVerified: verified,
+	})
+	require.NoError(t, err)
+
+	return user
+}
+
+// CreatePassword creates a password credential of the user with
+// the given password hash.
+func CreatePassword(t *testing.T, pool *pgxpool.Pool, user dbsqlctest.ShieldUser, passwordHash string) {
+	t.Helper()
+
+	_, err := dbsqlctest.New().TestCreatePassword(t.Context(), pool, dbsqlctest.TestCreatePasswordParams{
+		ID:                   tid.MustCredentialID(),
+		UserID:               user.ID,
+		UserCredentialKey:    user.Email,
+		UserCredentialSecret: passwordHash,
+	})
+	require.NoError(t, err)
+}
+
+// authenticator authenticates every request with the session sess.
+type authenticator[S any] struct{ sess shieldsession.Session[S] }
+
+func (a *authenticator[S]) Issue(http.ResponseWriter, *http.Request, shield.User[struct{}]) (shieldsession.Session[S], error) {
+	return a.sess, nil
+}
+
+func (a *authenticator[S]) Authenticate(http.ResponseWriter, *http.Request) (shieldsession.Session[S], error) {
+	return a.sess, nil
+}
+
+func (a *authenticator[S]) ExpireSessions(context.Context, pgx.Tx) error {
+	return errors.ErrUnsupported
+}
+
+// errorHandler fails the test on any error.
+type errorHandler struct{ t *testing.T }
+
+func (e errorHandler) ServeHTTP(_ http.ResponseWriter, _ *http.Request, err error) {
+	e.t.Errorf("testutil: unexpected error: %v", err)
+}
+
+// SessionContext returns a context carrying a session of the user with
+// the given userID, as if the request passed the shieldsession.Middleware.
+func SessionContext[S any](t *testing.T, userID typeid.TypeID) context.Context {
+	t.Helper()
+
+	//nolint:exhaustruct
+	auth := &authenticator[S]{sess: shieldsession.Session[S]{
+		ID:        tid.MustSessionID(),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}}
+
+	var ctx context.Context
+
+	next := http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) { ctx = r.Context() })
+	r := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil)
+	shieldsession.Middleware[struct{}, S](auth, errorHandler{t}, nil)(next).ServeHTTP(httptest.NewRecorder(), r)
+	require.NotNil(t, ctx)
+
+	return ctx
+}
@@ -16,6 +16,16 @@ var (
 	PrefixSession                   = prefix("sess") //nolint:gochecknoglobals
 	PrefixRecoveryKey               = prefix("rk")   //nolint:gochecknoglobals
 	PrefixPasswordReset             = prefix("prk")  //nolint:gochecknoglobals
+	PrefixPasswordHistory           = prefix("pwh")  //nolint:gochecknoglobals
+	PrefixLoginThrottle             = prefix("lth")  //nolint:gochecknoglobals
+	PrefixMagicLink                 = prefix("ml")   //nolint:gochecknoglobals
+	PrefixEmailVerification         = prefix("ev")   //nolint:gochecknoglobals
+	PrefixEmailChange               = prefix("ec")   //nolint:gochecknoglobals
+	PrefixPasskey                   = prefix("pk")   //nolint:gochecknoglobals
+	PrefixPasskeySession            = prefix("pks")  //nolint:gochecknoglobals
+	PrefixMFA                       = prefix("mfa")  //nolint:gochecknoglobals
+	PrefixTOTP                      = prefix("totp") //nolint:gochecknoglobals
+	PrefixEmailOTP                  = prefix("eotp") //nolint:gochecknoglobals
 	PrefixWorkspace                 = prefix("ws")   //nolint:gochecknoglobals
 	PrefixWorkspaceInvitation       = prefix("wsi")  //nolint:gochecknoglobals
 	PrefixWorkspaceMember           = prefix("wsm")  //nolint:gochecknoglobals
@@ -27,6 +37,16 @@ func MustCredentialID() typeid.TypeID          { return Must(PrefixCredential) }
 func MustSessionID() typeid.TypeID             { return Must(PrefixSession) }
 func MustRecoveryKeyID() typeid.TypeID         { return Must(PrefixRecoveryKey) }
 func MustPasswordResetID() typeid.TypeID       { return Must(PrefixPasswordReset) }
+func MustPasswordHistoryID() typeid.TypeID     { return Must(PrefixPasswordHistory) }
+func MustLoginThrottleID() typeid.TypeID       { return Must(PrefixLoginThrottle) }
+func MustMagicLinkID() typeid.TypeID           { return Must(PrefixMagicLink) }
+func MustEmailVerificationID() typeid.TypeID   { return Must(PrefixEmailVerification) }
+func MustEmailChangeID() typeid.TypeID         { return Must(PrefixEmailChange) }
+func MustPasskeyID() typeid.TypeID             { return Must(PrefixPasskey) }
+func MustPasskeySessionID() typeid.TypeID      { return Must(PrefixPasskeySession) }
+func MustMFAID() typeid.TypeID                 { return Must(PrefixMFA) }
+func MustTOTPID() typeid.TypeID                { return Must(PrefixTOTP) }
+func MustEmailOTPID() typeid.TypeID            { return Must(PrefixEmailOTP) }
 func MustWorkspaceID() typeid.TypeID           { return Must(PrefixWorkspace) }
 func MustWorkspaceInvitationID() typeid.TypeID { return Must(PrefixWorkspaceInvitation) }
 func MustWorkspaceMemberID() typeid.TypeID     { return Must(PrefixWorkspaceMember) }
@@ -27,6 +27,10 @@ const (
 	MFAPasskey = "mfa_passkey"
 	MFAEmail   = "mfa_email"
 	MFAOTP     = "mfa_otp"
+
+	// MFARecoveryCode is a fallback second factor. Unlike other MFAs it's
+	// never enabled on its own and is available to every user with MFA.
+	MFARecoveryCode = "mfa_recovery_code"
 )
 
 var (
@@ -0,0 +1,287 @@
+package shieldemailotp
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.inout.gg/foundations/dbsql"
+	"go.inout.gg/foundations/debug"
+	"go.jetify.com/typeid/v2"
+
+	"go.inout.gg/shield"
+	"go.inout.gg/shield/internal/dbsqlc"
+	"go.inout.gg/shield/internal/sliceutil"
+	"go.inout.gg/shield/internal/tid"
+	"go.inout.gg/shield/shieldsender"
+	"go.inout.gg/shield/shieldsession"
+)
+
+const (
+	DefaultCodeLength  = 6
+	DefaultExpiresIn   = 10 * time.Minute
+	DefaultMaxAttempts = 5
+)
+
+var (
+	// ErrCodeIncorrect is returned when the code is invalid, expired,
+	// already used or has run out of attempts.
+	ErrCodeIncorrect = errors.New("shield/emailotp: code incorrect")
+
+	// ErrNotEnrolled is returned when the user has no email MFA enabled.
+	ErrNotEnrolled = errors.New("shield/emailotp: not enrolled")
+)
+
+// EmailOTPMessagePayload is the payload of the email one-time code message.
+type EmailOTPMessagePayload struct {
+	ExpiresAt time.Time
+	Code      string
+}
+
+// Config is the configuration for the email one-time code handler.
+type Config struct {
+	Logger *slog.Logger // optional
+
+	// CodeLength is the number of digits in a code.
+	//
+	// Defaults to DefaultCodeLength.
+	CodeLength int // optional
+
+	// ExpiresIn sets for how long a sent code is valid.
+	//
+	// Defaults to DefaultExpiresIn.
+	ExpiresIn time.Duration // optional
+
+	// MaxAttempts is the number of verifications allowed for a single code.
+	//
+	// Defaults to DefaultMaxAttempts.
+	MaxAttempts int // optional
+}
+
+func (c *Config) defaults() {
+	c.Logger = cmp.Or(c.Logger, shield.DefaultLogger)
+	c.CodeLength = cmp.Or(c.CodeLength, DefaultCodeLength)
+	c.ExpiresIn = cmp.Or(c.ExpiresIn, DefaultExpiresIn)
+	c.MaxAttempts = cmp.Or(c.MaxAttempts, DefaultMaxAttempts)
+}
+
+func (c *Config) assert() {
+	debug.Assert(c.Logger != nil, "Logger must be set")
+	debug.Assert(c.CodeLength >= 6 && c.CodeLength <= 10, "CodeLength must be between 6 and 10")
+	debug.Assert(c.ExpiresIn > 0, "ExpiresIn must be positive")
+	debug.Assert(c.MaxAttempts > 0, "MaxAttempts must be positive")
+}
+
+// Handler manages the email one-time code second factor of users.
+type Handler[S any] struct {
+	pool   *pgxpool.Pool
+	sender shieldsender.Sender
+	config *Config
+}
+
+func NewHandler[S any](
+	pool *pgxpool.Pool,
+	sender shieldsender.Sender,
+	config *Config,
+) *Handler[S] {
+	config.defaults()
+	config.assert()
+
+	h := Handler[S]{
+		pool:   pool,
+		sender: sender,
+		config: config,
+	}
+
+	debug.Assert(h.pool != nil, "pool must be set")
+	debug.Assert(h.sender != nil, "sender must be set")
+
+	return &h
+}
+
+// HandleEnroll enables the email one-time code factor for the signed-in user.
+//
+// The session is expected to be provided via a passed ctx context.
+func (h *Handler[S]) HandleEnroll(ctx context.Context) error {
+	sess, err := shieldsession.FromContext[S](ctx)
+	if err != nil {
+		return fmt.Errorf(
+			"shield/emailotp: failed to retrieve session from the context: %w",
+			err,
+		)
+	}
+
+	if err := dbsqlc.New().CreateUserMFA(ctx, h.pool, dbsqlc.CreateUserMFAParams{
+		ID:     tid.MustMFAID(),
+		UserID: sess.UserID,
+		Name:   shield.MFAEmail,
+	}); err != nil {
+		return fmt.Errorf("shield/emailotp: failed to create MFA factor: %w", err)
+	}
+
+	return nil
+}
+
+// HandleUnenroll disables the email one-time code factor for
+// the signed-in user.
+//
+// The session is expected to be provided via a passed ctx context.
+func (h *Handler[S]) HandleUnenroll(ctx context.Context) error {
+	sess, err := shieldsession.FromContext[S](ctx)
+	if err != nil {
+		return fmt.Errorf(
+			"shield/emailotp: failed to retrieve session from the context: %w",
+			err,
+		)
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("shield/emailotp: failed to begin transaction: %w", err)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	q := dbsqlc.New()
+
+	if err := q.DeleteUserEmailOTP(ctx, tx, sess.UserID); err != nil {
+		return fmt.Errorf("shield/emailotp: failed to delete code: %w", err)
+	}
+
+	if err := q.DeleteUserMFA(ctx, tx, dbsqlc.DeleteUserMFAParams{
+		UserID: sess.UserID,
+		Name:   shield.MFAEmail,
+	}); err != nil {
+		return fmt.Errorf("shield/emailotp: failed to delete MFA factor: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("shield/emailotp: failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// HandleSendCode sends a new one-time code to the email address of the user
+// with the given userID, e.g., a user with a pending MFA challenge.
+//
+// A previously sent code is invalidated.
+func (h *Handler[S]) HandleSendCode(ctx context.Context, userID typeid.TypeID) error {
+	q := dbsqlc.New()
+
+	user, err := q.FindUserByID(ctx, h.pool, userID)
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			return shield.ErrUserNotFound
+		}
+
+		return fmt.Errorf("shield/emailotp: failed to find user: %w", err)
+	}
+
+	mfas, err := q.GetUserMFAs(ctx, h.pool, userID)
+	if err != nil {
+		return fmt.Errorf("shield/emailotp: failed to get user MFAs: %w", err)
+	}
+
+	names := sliceutil.Map(mfas, func(m dbsqlc.ShieldUserMfa) string { return m.Name })
+	if !slices.Contains(names, shield.MFAEmail) {
+		return ErrNotEnrolled
+	}
+
+	code, err := generateCode(h.config.CodeLength)
+	if err != nil {
+		return err
+	}
+
+	id := tid.MustEmailOTPID()
+	expiresAt := time.Now().Add(h.config.ExpiresIn)
+
+	if err := q.UpsertUserEmailOTP(ctx, h.pool, dbsqlc.UpsertUserEmailOTPParams{
+		ID:        id,
+		UserID:    userID,
+		CodeHash:  hashCode(id, code),
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		return fmt.Errorf("shield/emailotp: failed to store code: %w", err)
+	}
+
+	if err := h.sender.Send(ctx, shieldsender.Message{
+		Email: user.Email,
+		Key:   shieldsender.MessageKeyEmailOTP,
+		Payload: EmailOTPMessagePayload{
+			ExpiresAt: expiresAt,
+			Code:      code,
+		},
+	}); err != nil {
+		return fmt.Errorf("shield/emailotp: failed to send code: %w", err)
+	}
+
+	return nil
+}
+
+// Verify checks the one-time code of the user with the given userID and
+// marks it as used.
+func (h *Handler[S]) Verify(
+	ctx context.Context,
+	userID typeid.TypeID,
+	code string,
+) error {
+	q := dbsqlc.New()
+
+	// The attempt is recorded before comparison, so that concurrent
+	// requests can't exceed the limit.
+	otp, err := q.IncrementUserEmailOTPAttempts(ctx, h.pool, userID)
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			d("no pending code for user=%v", userID)
+			return ErrCodeIncorrect
+		}
+
+		return fmt.Errorf("shield/emailotp: failed to find code: %w", err)
+	}
+
+	if int(otp.Attempts) > h.config.MaxAttempts {
+		d("code=%v has run out of attempts", otp.ID)
+		return ErrCodeIncorrect
+	}
+
+	if subtle.ConstantTimeCompare(hashCode(otp.ID, code), otp.CodeHash) != 1 {
+		return ErrCodeIncorrect
+	}
+
+	n, err := q.MarkUserEmailOTPAsUsed(ctx, h.pool, otp.ID)
+	if err != nil {
+		return fmt.Errorf("shield/emailotp: failed to mark code as used: %w", err)
+	}
+
+	if n == 0 {
+		return ErrCodeIncorrect
+	}
+
+	return nil
+}
+
+// generateCode returns a securely random numeric code of length l.
+func generateCode(l int) (string, error) {
+	n, err := rand.Int(rand.Reader, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(l)), nil))
+	if err != nil {
+		return "", fmt.Errorf("shield/emailotp: failed to generate code: %w", err)
+	}
+
+	return fmt.Sprintf("%0*d", l, n), nil
+}
+
+// hashCode hashes the code salted with the ID of the code row.
+func hashCode(id typeid.TypeID, code string) []byte {
+	sum := sha256.Sum256([]byte(id.String() + ":" + code))
+	return sum[:]
+}
@@ -0,0 +1,197 @@
+package shieldemailotp
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"go.inout.gg/shield/internal/dbsqlctest"
+	"go.inout.gg/shield/internal/mocks/mocks"
+	"go.inout.gg/shield/internal/testutil"
+	"go.inout.gg/shield/internal/tid"
+	"go.inout.gg/shield/shieldsender"
+)
+
+// newHandler returns a handler along with an enrolled user and a function
+// sending a code to the user and returning the sent code.
+func newHandler(
+	t *testing.T,
+	pool *pgxpool.Pool,
+	config *Config,
+) (*Handler[struct{}], dbsqlctest.ShieldUser, func() string) {
+	t.Helper()
+
+	sender := mocks.NewMockSender(gomock.NewController(t))
+	h := NewHandler[struct{}](pool, sender, config)
+
+	user := testutil.CreateUser(t, pool, testutil.Email(), true)
+	require.NoError(t, h.HandleEnroll(testutil.SessionContext[struct{}](t, user.ID)))
+
+	sendCode := func() string {
+		t.Helper()
+
+		var code string
+
+		sender.EXPECT().
+			Send(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, msg shieldsender.Message) error {
+				assert.Equal(t, user.Email, msg.Email)
+				assert.Equal(t, shieldsender.MessageKeyEmailOTP, msg.Key)
+
+				payload, ok := msg.Payload.(EmailOTPMessagePayload)
+				require.True(t, ok)
+
+				code = payload.Code
+
+				return nil
+			})
+
+		require.NoError(t, h.HandleSendCode(t.Context(), user.ID))
+
+		return code
+	}
+
+	return h, user, sendCode
+}
+
+// wrongCode returns a code of the same length that differs from code.
+func wrongCode(code string) string {
+	if code[0] == '0' {
+		return "1" + code[1:]
+	}
+
+	return "0" + code[1:]
+}
+
+func TestHandleSendCode(t *testing.T) {
+	t.Parallel()
+
+	t.Run("not enrolled", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+
+		//nolint:exhaustruct
+		h := NewHandler[struct{}](pool, mocks.NewMockSender(gomock.NewController(t)), &Config{})
+		user := testutil.CreateUser(t, pool, testutil.Email(), true)
+
+		require.ErrorIs(t, h.HandleSendCode(t.Context(), user.ID), ErrNotEnrolled)
+	})
+
+	t.Run("stores salted hash", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+
+		//nolint:exhaustruct
+		_, user, sendCode := newHandler(t, pool, &Config{})
+
+		code := sendCode()
+		assert.Len(t, code, DefaultCodeLength)
+
+		otp, err := dbsqlctest.New().TestFindUserEmailOTPByUserID(t.Context(), pool, user.ID)
+		require.NoError(t, err)
+
+		unsalted := sha256.Sum256([]byte(code))
+		assert.Equal(t, hashCode(otp.ID, code), otp.CodeHash)
+		assert.NotEqual(t, unsalted[:], otp.CodeHash)
+	})
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	t.Run("single use", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+
+		//nolint:exhaustruct
+		h, user, sendCode := newHandler(t, pool, &Config{})
+
+		code := sendCode()
+		require.NoError(t, h.Verify(t.Context(), user.ID, code))
+		require.ErrorIs(t, h.Verify(t.Context(), user.ID, code), ErrCodeIncorrect)
+	})
+
+	t.Run("incorrect code", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+
+		//nolint:exhaustruct
+		h, user, sendCode := newHandler(t, pool, &Config{})
+
+		code := sendCode()
+		require.ErrorIs(t, h.Verify(t.Context(), user.ID, wrongCode(code)), ErrCodeIncorrect)
+		require.ErrorIs(t, h.Verify(t.Context(), user.ID, ""), ErrCodeIncorrect)
+		require.NoError(t, h.Verify(t.Context(), user.ID, code))
+	})
+
+	t.Run("attempt limit", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+
+		//nolint:exhaustruct
+		h, user, sendCode := newHandler(t, pool, &Config{MaxAttempts: 2})
+
+		code := sendCode()
+		require.ErrorIs(t, h.Verify(t.Context(), user.ID, wrongCode(code)), ErrCodeIncorrect)
+		require.ErrorIs(t, h.Verify(t.Context(), user.ID, wrongCode(code)), ErrCodeIncorrect)
+		require.ErrorIs(t, h.Verify(t.Context(), user.ID, code), ErrCodeIncorrect)
+
+		// A new code resets the attempts.
+		code = sendCode()
+		require.NoError(t, h.Verify(t.Context(), user.ID, code))
+	})
+
+	t.Run("expired code", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+
+		//nolint:exhaustruct
+		h, user, sendCode := newHandler(t, pool, &Config{})
+
+		code := sendCode()
+		require.NoError(t, dbsqlctest.New().TestExpireUserEmailOTP(t.Context(), pool, user.ID))
+
+		require.ErrorIs(t, h.Verify(t.Context(), user.ID, code), ErrCodeIncorrect)
+	})
+
+	t.Run("superseded code", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+
+		//nolint:exhaustruct
+		h, user, sendCode := newHandler(t, pool, &Config{})
+
+		oldCode := sendCode()
+		code := sendCode()
+
+		if oldCode != code {
+			require.ErrorIs(t, h.Verify(t.Context(), user.ID, oldCode), ErrCodeIncorrect)
+		}
+
+		require.NoError(t, h.Verify(t.Context(), user.ID, code))
+	})
+}
+
+func TestHashCode(t *testing.T) {
+	t.Parallel()
+
+	id := tid.MustEmailOTPID()
+
+	assert.Equal(t, hashCode(id, "123456"), hashCode(id, "123456"))
+	assert.NotEqual(t, hashCode(id, "123456"), hashCode(id, "123457"))
+
+	// The same code of another row has another hash.
+	assert.NotEqual(t, hashCode(id, "123456"), hashCode(tid.MustEmailOTPID(), "123456"))
+}
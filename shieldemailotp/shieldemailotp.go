@@ -0,0 +1,10 @@
+// Package shieldemailotp implements an email one-time code second factor.
+//
+// A short numeric code is sent to the user's email address on demand and
+// is valid for a short period of time and a limited number of attempts.
+package shieldemailotp
+
+import "go.inout.gg/foundations/debug"
+
+//nolint:gochecknoglobals
+var d = debug.Debuglog("shield/emailotp")
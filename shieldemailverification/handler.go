@@ -0,0 +1,244 @@
+package shieldemailverification
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.inout.gg/foundations/dbsql"
+	"go.inout.gg/foundations/debug"
+	"go.jetify.com/typeid/v2"
+
+	"go.inout.gg/shield"
+	"go.inout.gg/shield/internal/dbsqlc"
+	"go.inout.gg/shield/internal/random"
+	"go.inout.gg/shield/internal/tid"
+	"go.inout.gg/shield/shieldsender"
+	"go.inout.gg/shield/shieldsession"
+)
+
+const (
+	DefaultTokenLength = 32
+	DefaultExpiresIn   = 24 * time.Hour
+)
+
+var (
+	// ErrTokenInvalid is returned when the verification token doesn't exist,
+	// has expired, has already been used or was sent to an email address
+	// the user no longer has.
+	ErrTokenInvalid = errors.New("shield/emailverification: token invalid")
+
+	// ErrEmailAlreadyVerified is returned when a token is requested for
+	// an already verified email.
+	ErrEmailAlreadyVerified = errors.New("shield/emailverification: email already verified")
+
+	// ErrEmailNotVerified is returned when a user with an unverified email
+	// accesses a guarded resource.
+	ErrEmailNotVerified = errors.New("shield/emailverification: email not verified")
+)
+
+// EmailVerificationMessagePayload is the payload of the email verification
+// message.
+type EmailVerificationMessagePayload struct {
+	ExpiresAt time.Time
+	Token     string
+}
+
+// Config is the configuration for the email verification handler.
+type Config struct {
+	Logger *slog.Logger // optional
+
+	// TokenLength is the number of random bytes in a token.
+	//
+	// Defaults to DefaultTokenLength.
+	TokenLength int // optional
+
+	// ExpiresIn sets for how long a sent token is valid.
+	//
+	// Defaults to DefaultExpiresIn.
+	ExpiresIn time.Duration // optional
+}
+
+func (c *Config) defaults() {
+	c.Logger = cmp.Or(c.Logger, shield.DefaultLogger)
+	c.TokenLength = cmp.Or(c.TokenLength, DefaultTokenLength)
+	c.ExpiresIn = cmp.Or(c.ExpiresIn, DefaultExpiresIn)
+}
+
+func (c *Config) assert() {
+	debug.Assert(c.Logger != nil, "Logger must be set")
+	debug.Assert(c.TokenLength >= 16, "TokenLength must be at least 16")
+	debug.Assert(c.ExpiresIn > 0, "ExpiresIn must be positive")
+}
+
+// Handler sends and confirms email verification tokens.
+type Handler[S any] struct {
+	pool   *pgxpool.Pool
+	sender shieldsender.Sender
+	config *Config
+}
+
+func NewHandler[S any](
+	pool *pgxpool.Pool,
+	sender shieldsender.Sender,
+	config *Config,
+) *Handler[S] {
+	if config == nil {
+		//nolint:exhaustruct
+		config = &Config{}
+	}
+
+	config.defaults()
+	config.assert()
+
+	h := Handler[S]{
+		pool:   pool,
+		sender: sender,
+		config: config,
+	}
+
+	debug.Assert(h.pool != nil, "pool must be set")
+	debug.Assert(h.sender != nil, "sender must be set")
+
+	return &h
+}
+
+// HandleSendToken sends a verification token to the email address of
+// the user with the given userID, e.g., right after the registration.
+//
+// A previously sent token is invalidated.
+func (h *Handler[S]) HandleSendToken(ctx context.Context, userID typeid.TypeID) error {
+	user, err := dbsqlc.New().FindUserByID(ctx, h.pool, userID)
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			return shield.ErrUserNotFound
+		}
+
+		return fmt.Errorf("shield/emailverification: failed to find user: %w", err)
+	}
+
+	if user.IsEmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+
+	tokStr, err := random.SecureHexString(h.config.TokenLength)
+	if err != nil {
+		return fmt.Errorf("shield/emailverification: failed to generate token: %w", err)
+	}
+
+	tok, err := dbsqlc.New().UpsertEmailVerificationToken(ctx, h.pool, dbsqlc.UpsertEmailVerificationTokenParams{
+		ID:        tid.MustEmailVerificationID(),
+		UserID:    user.ID,
+		Email:     user.Email,
+		TokenHash: random.HashToken(tokStr),
+		ExpiresAt: time.Now().Add(h.config.ExpiresIn),
+	})
+	if err != nil {
+		return fmt.Errorf("shield/emailverification: failed to store token: %w", err)
+	}
+
+	if err := h.sender.Send(ctx, shieldsender.Message{
+		Email: user.Email,
+		Key:   shieldsender.MessageKeyEmailVerification,
+		Payload: EmailVerificationMessagePayload{
+			ExpiresAt: tok.ExpiresAt,
+			Token:     tokStr,
+		},
+	}); err != nil {
+		return fmt.Errorf("shield/emailverification: failed to send token: %w", err)
+	}
+
+	return nil
+}
+
+// HandleResendToken sends a new verification token to the signed-in user.
+//
+// The session is expected to be provided via a passed ctx context.
+func (h *Handler[S]) HandleResendToken(ctx context.Context) error {
+	sess, err := shieldsession.FromContext[S](ctx)
+	if err != nil {
+		return fmt.Errorf(
+			"shield/emailverification: failed to retrieve session from the context: %w",
+			err,
+		)
+	}
+
+	return h.HandleSendToken(ctx, sess.UserID)
+}
+
+// HandleConfirm confirms the verification token tokStr and marks the email
+// of the user it was sent to as verified.
+//
+// The token is valid only for the email address it was sent to, so that
+// a token sent before an email change can't verify the new address.
+//
+// No session is required, as the token can be opened on another device.
+func (h *Handler[S]) HandleConfirm(ctx context.Context, tokStr string) error {
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("shield/emailverification: failed to begin transaction: %w", err)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	q := dbsqlc.New()
+
+	tok, err := q.ConsumeEmailVerificationToken(ctx, tx, random.HashToken(tokStr))
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			return ErrTokenInvalid
+		}
+
+		return fmt.Errorf("shield/emailverification: failed to consume token: %w", err)
+	}
+
+	n, err := q.MarkUserEmailAsVerifiedByIDAndEmail(ctx, tx, dbsqlc.MarkUserEmailAsVerifiedByIDAndEmailParams{
+		ID:    tok.UserID,
+		Email: tok.Email,
+	})
+	if err != nil {
+		return fmt.Errorf("shield/emailverification: failed to verify email: %w", err)
+	}
+
+	if n == 0 {
+		d("email of user=%v has changed since the token was sent", tok.UserID)
+		return ErrTokenInvalid
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("shield/emailverification: failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// IsVerified reports whether the email of the user with the given userID
+// is verified.
+func (h *Handler[S]) IsVerified(ctx context.Context, userID typeid.TypeID) (bool, error) {
+	user, err := dbsqlc.New().FindUserByID(ctx, h.pool, userID)
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			return false, shield.ErrUserNotFound
+		}
+
+		return false, fmt.Errorf("shield/emailverification: failed to find user: %w", err)
+	}
+
+	return user.IsEmailVerified, nil
+}
+
+// HandleDeleteExpiredTokens deletes expired tokens.
+//
+// It's intended to be run periodically.
+func (h *Handler[S]) HandleDeleteExpiredTokens(ctx context.Context) (int64, error) {
+	n, err := dbsqlc.New().DeleteExpiredEmailVerificationTokens(ctx, h.pool)
+	if err != nil {
+		return 0, fmt.Errorf("shield/emailverification: failed to delete expired tokens: %w", err)
+	}
+
+	return n, nil
+}
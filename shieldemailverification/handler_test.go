@@ -0,0 +1,145 @@
+package shieldemailverification
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"go.inout.gg/shield/internal/dbsqlc"
+	"go.inout.gg/shield/internal/dbsqlctest"
+	"go.inout.gg/shield/internal/mocks/mocks"
+	"go.inout.gg/shield/internal/testutil"
+	"go.inout.gg/shield/shieldsender"
+)
+
+// newHandler returns a handler along with a function sending a token to
+// the given user and returning the sent token.
+func newHandler(t *testing.T, pool *pgxpool.Pool) (*Handler[struct{}], func(dbsqlctest.ShieldUser) string) {
+	t.Helper()
+
+	sender := mocks.NewMockSender(gomock.NewController(t))
+	h := NewHandler[struct{}](pool, sender, nil)
+
+	sendToken := func(user dbsqlctest.ShieldUser) string {
+		t.Helper()
+
+		var tokStr string
+
+		sender.EXPECT().
+			Send(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, msg shieldsender.Message) error {
+				assert.Equal(t, user.Email, msg.Email)
+				assert.Equal(t, shieldsender.MessageKeyEmailVerification, msg.Key)
+
+				payload, ok := msg.Payload.(EmailVerificationMessagePayload)
+				require.True(t, ok)
+
+				tokStr = payload.Token
+
+				return nil
+			})
+
+		require.NoError(t, h.HandleSendToken(t.Context(), user.ID))
+
+		return tokStr
+	}
+
+	return h, sendToken
+}
+
+// isVerified reports whether the email of the user is verified.
+func isVerified(t *testing.T, pool *pgxpool.Pool, user dbsqlctest.ShieldUser) bool {
+	t.Helper()
+
+	user, err := dbsqlctest.New().TestFindUserByID(t.Context(), pool, user.ID)
+	require.NoError(t, err)
+
+	return user.IsEmailVerified
+}
+
+func TestHandleSendToken(t *testing.T) {
+	t.Parallel()
+
+	t.Run("already verified", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		h, _ := newHandler(t, pool)
+		user := testutil.CreateUser(t, pool, testutil.Email(), true)
+
+		require.ErrorIs(t, h.HandleSendToken(t.Context(), user.ID), ErrEmailAlreadyVerified)
+	})
+}
+
+func TestHandleConfirm(t *testing.T) {
+	t.Parallel()
+
+	t.Run("token reuse", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		h, sendToken := newHandler(t, pool)
+		user := testutil.CreateUser(t, pool, testutil.Email(), false)
+
+		tokStr := sendToken(user)
+
+		require.NoError(t, h.HandleConfirm(t.Context(), tokStr))
+		assert.True(t, isVerified(t, pool, user))
+
+		require.ErrorIs(t, h.HandleConfirm(t.Context(), tokStr), ErrTokenInvalid)
+	})
+
+	t.Run("superseded token", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		h, sendToken := newHandler(t, pool)
+		user := testutil.CreateUser(t, pool, testutil.Email(), false)
+
+		oldTokStr := sendToken(user)
+		tokStr := sendToken(user)
+
+		require.ErrorIs(t, h.HandleConfirm(t.Context(), oldTokStr), ErrTokenInvalid)
+		require.NoError(t, h.HandleConfirm(t.Context(), tokStr))
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		h, sendToken := newHandler(t, pool)
+		user := testutil.CreateUser(t, pool, testutil.Email(), false)
+
+		tokStr := sendToken(user)
+		require.NoError(t, dbsqlctest.New().TestExpireEmailVerificationTokensByUserID(t.Context(), pool, user.ID))
+
+		require.ErrorIs(t, h.HandleConfirm(t.Context(), tokStr), ErrTokenInvalid)
+		assert.False(t, isVerified(t, pool, user))
+	})
+
+	t.Run("email changed since sending", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		h, sendToken := newHandler(t, pool)
+		user := testutil.CreateUser(t, pool, testutil.Email(), false)
+
+		tokStr := sendToken(user)
+
+		n, err := dbsqlc.New().ChangeUserEmailByID(t.Context(), pool, dbsqlc.ChangeUserEmailByIDParams{
+			NewEmail:        testutil.Email(),
+			IsEmailVerified: false,
+			ID:              user.ID,
+			OldEmail:        user.Email,
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), n)
+
+		require.ErrorIs(t, h.HandleConfirm(t.Context(), tokStr), ErrTokenInvalid)
+		assert.False(t, isVerified(t, pool, user))
+	})
+}
@@ -0,0 +1,78 @@
+package shieldemailverification
+
+import (
+	"errors"
+	"net/http"
+
+	"go.inout.gg/foundations/debug"
+	"go.inout.gg/foundations/http/httperror"
+	"go.inout.gg/foundations/http/httpmiddleware"
+
+	"go.inout.gg/shield"
+	"go.inout.gg/shield/shieldsession"
+)
+
+// Middleware returns a middleware that blocks users with unverified emails.
+//
+// Apply it to the routes that require a verified email, after
+// the shieldsession.Middleware. Unauthenticated requests fail with
+// http.StatusUnauthorized, users with unverified emails fail with
+// http.StatusForbidden and ErrEmailNotVerified.
+func Middleware[S any](
+	h *Handler[S],
+	errorHandler httperror.ErrorHandler,
+) httpmiddleware.MiddlewareFunc {
+	debug.Assert(h != nil, "handler must be set")
+	debug.Assert(errorHandler != nil, "errorHandler must be set")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				sess, err := shieldsession.FromRequest[S](r)
+				if err != nil {
+					errorHandler.ServeHTTP(
+						w,
+						r,
+						httperror.FromError(
+							err,
+							http.StatusUnauthorized,
+							"unauthorized access",
+						),
+					)
+
+					return
+				}
+
+				verified, err := h.IsVerified(r.Context(), sess.UserID)
+				if err != nil {
+					code := http.StatusInternalServerError
+					if errors.Is(err, shield.ErrUserNotFound) {
+						code = http.StatusUnauthorized
+					}
+
+					errorHandler.ServeHTTP(w, r, httperror.FromError(err, code))
+
+					return
+				}
+
+				if !verified {
+					d("blocking user=%v with unverified email", sess.UserID)
+
+					errorHandler.ServeHTTP(
+						w,
+						r,
+						httperror.FromError(
+							ErrEmailNotVerified,
+							http.StatusForbidden,
+							"email not verified",
+						),
+					)
+
+					return
+				}
+
+				next.ServeHTTP(w, r)
+			},
+		)
+	}
+}
@@ -0,0 +1,95 @@
+package shieldemailverification
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"go.inout.gg/shield/internal/mocks/mocks"
+	"go.inout.gg/shield/internal/testutil"
+)
+
+// errorHandler records the error and responds with its status code.
+type errorHandler struct {
+	err  error
+	code int
+}
+
+func (e *errorHandler) ServeHTTP(w http.ResponseWriter, _ *http.Request, err error) {
+	var httpErr interface{ StatusCode() int }
+	if !errors.As(err, &httpErr) {
+		panic("unexpected error without a status code")
+	}
+
+	e.err = err
+	e.code = httpErr.StatusCode()
+	w.WriteHeader(e.code)
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		verified bool
+		wantCode int
+		wantErr  error
+	}{
+		{"verified", true, http.StatusOK, nil},
+		{"unverified", false, http.StatusForbidden, ErrEmailNotVerified},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			pool := testutil.NewPool(t)
+			user := testutil.CreateUser(t, pool, testutil.Email(), tt.verified)
+			h := NewHandler[struct{}](pool, mocks.NewMockSender(gomock.NewController(t)), nil)
+
+			//nolint:exhaustruct
+			eh := &errorHandler{}
+
+			called := false
+			next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true })
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequestWithContext(testutil.SessionContext[struct{}](t, user.ID), http.MethodGet, "/", nil)
+			Middleware(h, eh)(next).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantErr == nil, called)
+			assert.Equal(t, tt.wantCode, w.Code)
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, eh.err, tt.wantErr)
+				assert.Equal(t, tt.wantCode, eh.code)
+			}
+		})
+	}
+}
+
+func TestMiddlewareUnauthenticated(t *testing.T) {
+	t.Parallel()
+
+	//nolint:exhaustruct
+	h := &Handler[struct{}]{}
+
+	//nolint:exhaustruct
+	eh := &errorHandler{}
+
+	called := false
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true })
+
+	w := httptest.NewRecorder()
+	Middleware(h, eh)(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.False(t, called)
+	require.Error(t, eh.err)
+	assert.Equal(t, http.StatusUnauthorized, eh.code)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,13 @@
+// Package shieldemailverification implements verification of user email
+// addresses.
+//
+// A single-use token is sent to the user's email address, on registration
+// or on demand. Confirming the token marks the email as verified.
+// Middleware can be used to block users with unverified emails from
+// accessing routes.
+package shieldemailverification
+
+import "go.inout.gg/foundations/debug"
+
+//nolint:gochecknoglobals
+var d = debug.Debuglog("shield/emailverification")
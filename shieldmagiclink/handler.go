@@ -0,0 +1,298 @@
+package shieldmagiclink
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.inout.gg/foundations/dbsql"
+	"go.inout.gg/foundations/debug"
+	"go.jetify.com/typeid/v2"
+
+	"go.inout.gg/shield"
+	"go.inout.gg/shield/internal/dbsqlc"
+	"go.inout.gg/shield/internal/random"
+	"go.inout.gg/shield/internal/tid"
+	"go.inout.gg/shield/shieldsender"
+	"go.inout.gg/shield/shieldsession"
+)
+
+const (
+	DefaultTokenLength = 32
+	DefaultExpiresIn   = 15 * time.Minute
+)
+
+// ErrTokenInvalid is returned when the magic link token doesn't exist, has
+// expired or has already been used.
+var ErrTokenInvalid = errors.New("shield/magiclink: token invalid")
+
+// MagicLinkMessagePayload is the payload of the magic link message.
+type MagicLinkMessagePayload struct {
+	ExpiresAt time.Time
+	Token     string
+}
+
+// Hooker allows to hook into the magic link sign-in.
+type Hooker[U any] interface {
+	// OnUserRegistration is called when a new user is created on the first
+	// sign-in. Use this method to create an additional context for the user.
+	OnUserRegistration(context.Context, typeid.TypeID, pgx.Tx) (U, error)
+
+	// OnUserLogin is called when an existing user signs in.
+	// Use this method to fetch additional data from the database for the user.
+	OnUserLogin(context.Context, typeid.TypeID, pgx.Tx) (U, error)
+}
+
+// Config is the configuration for the magic link handler.
+type Config[U any] struct {
+	Logger *slog.Logger // optional
+	Hooker Hooker[U]    // optional
+
+	// TokenLength is the number of random bytes in a token.
+	//
+	// Defaults to DefaultTokenLength.
+	TokenLength int // optional
+
+	// ExpiresIn sets for how long a sent link is valid.
+	//
+	// Defaults to DefaultExpiresIn.
+	ExpiresIn time.Duration // optional
+
+	// CreateUser enables creating a user on the first sign-in with an email
+	// that is not registered yet.
+	CreateUser bool // optional
+}
+
+func (c *Config[U]) defaults() {
+	c.Logger = cmp.Or(c.Logger, shield.DefaultLogger)
+	c.TokenLength = cmp.Or(c.TokenLength, DefaultTokenLength)
+	c.ExpiresIn = cmp.Or(c.ExpiresIn, DefaultExpiresIn)
+}
+
+func (c *Config[U]) assert() {
+	debug.Assert(c.Logger != nil, "Logger must be set")
+	debug.Assert(c.TokenLength >= 16, "TokenLength must be at least 16")
+	debug.Assert(c.ExpiresIn > 0, "ExpiresIn must be positive")
+}
+
+// Handler issues and redeems magic links.
+type Handler[U any] struct {
+	pool   *pgxpool.Pool
+	sender shieldsender.Sender
+	config *Config[U]
+}
+
+func NewHandler[U any](
+	pool *pgxpool.Pool,
+	sender shieldsender.Sender,
+	config *Config[U],
+) *Handler[U] {
+	if config == nil {
+		//nolint:exhaustruct
+		config = &Config[U]{}
+	}
+
+	config.defaults()
+	config.assert()
+
+	h := Handler[U]{
+		pool:   pool,
+		sender: sender,
+		config: config,
+	}
+
+	debug.Assert(h.pool != nil, "pool must be set")
+	debug.Assert(h.sender != nil, "sender must be set")
+
+	return &h
+}
+
+// HandleSendLink sends a magic link token to the given email.
+//
+// Previously sent unused tokens of the email are invalidated.
+//
+// If no user with the email exists and Config.CreateUser is not set,
+// shield.ErrUserNotFound is returned. To avoid user enumeration, respond to
+// the client the same way as on success.
+func (h *Handler[U]) HandleSendLink(ctx context.Context, email string) error {
+	// Forbid authorized user access.
+	if shieldsession.IsAuthenticated(ctx) {
+		return shield.ErrAuthenticatedUser
+	}
+
+	if !h.config.CreateUser {
+		if _, err := dbsqlc.New().FindUserByEmail(ctx, h.pool, email); err != nil {
+			if dbsql.IsNotFoundError(err) {
+				d("magic link requested for an unknown email")
+				return shield.ErrUserNotFound
+			}
+
+			return fmt.Errorf("shield/magiclink: failed to find user: %w", err)
+		}
+	}
+
+	tokStr, err := random.SecureHexString(h.config.TokenLength)
+	if err != nil {
+		return fmt.Errorf("shield/magiclink: failed to generate token: %w", err)
+	}
+
+	expiresAt := time.Now().Add(h.config.ExpiresIn)
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("shield/magiclink: failed to begin transaction: %w", err)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err := dbsqlc.New().DeleteUnusedMagicLinkTokensByEmail(ctx, tx, email); err != nil {
+		return fmt.Errorf("shield/magiclink: failed to invalidate tokens: %w", err)
+	}
+
+	if err := dbsqlc.New().CreateMagicLinkToken(ctx, tx, dbsqlc.CreateMagicLinkTokenParams{
+		ID:        tid.MustMagicLinkID(),
+		Email:     email,
+		TokenHash: random.HashToken(tokStr),
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		return fmt.Errorf("shield/magiclink: failed to create token: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("shield/magiclink: failed to commit transaction: %w", err)
+	}
+
+	if err := h.sender.Send(ctx, shieldsender.Message{
+		Email: email,
+		Key:   shieldsender.MessageKeyMagicLink,
+		Payload: MagicLinkMessagePayload{
+			ExpiresAt: expiresAt,
+			Token:     tokStr,
+		},
+	}); err != nil {
+		return fmt.Errorf("shield/magiclink: failed to send magic link: %w", err)
+	}
+
+	return nil
+}
+
+// HandleRedeem redeems the magic link token tokStr and returns the user
+// it has been issued for, ready to be passed to the Authenticator.Issue.
+//
+// As the token proves ownership of the email, the user's email is marked
+// as verified. If the user doesn't exist and Config.CreateUser is set,
+// the user is created.
+func (h *Handler[U]) HandleRedeem(ctx context.Context, tokStr string) (shield.User[U], error) {
+	var user shield.User[U]
+
+	// Forbid authorized user access.
+	if shieldsession.IsAuthenticated(ctx) {
+		return user, shield.ErrAuthenticatedUser
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return user, fmt.Errorf("shield/magiclink: failed to begin transaction: %w", err)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	email, err := dbsqlc.New().ConsumeMagicLinkToken(ctx, tx, random.HashToken(tokStr))
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			return user, ErrTokenInvalid
+		}
+
+		return user, fmt.Errorf("shield/magiclink: failed to consume token: %w", err)
+	}
+
+	userID, payload, err := h.findOrCreateUser(ctx, tx, email)
+	if err != nil {
+		return user, err
+	}
+
+	if err := dbsqlc.New().MarkUserEmailAsVerifiedByID(ctx, tx, userID); err != nil {
+		return user, fmt.Errorf("shield/magiclink: failed to verify email: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return user, fmt.Errorf("shield/magiclink: failed to commit transaction: %w", err)
+	}
+
+	user.ID = userID
+	user.T = &payload
+
+	return user, nil
+}
+
+// findOrCreateUser returns the ID of the user with the given email and its
+// hooked payload.
+func (h *Handler[U]) findOrCreateUser(
+	ctx context.Context,
+	tx pgx.Tx,
+	email string,
+) (typeid.TypeID, U, error) {
+	var payload U
+
+	dbUser, err := dbsqlc.New().FindUserByEmail(ctx, tx, email)
+	if err == nil {
+		if h.config.Hooker != nil {
+			payload, err = h.config.Hooker.OnUserLogin(ctx, dbUser.ID, tx)
+			if err != nil {
+				return dbUser.ID, payload, fmt.Errorf(
+					"shield/magiclink: failed to hook user login: %w",
+					err,
+				)
+			}
+		}
+
+		return dbUser.ID, payload, nil
+	}
+
+	if !dbsql.IsNotFoundError(err) {
+		return dbUser.ID, payload, fmt.Errorf("shield/magiclink: failed to find user: %w", err)
+	}
+
+	if !h.config.CreateUser {
+		return dbUser.ID, payload, shield.ErrUserNotFound
+	}
+
+	userID := tid.MustUserID()
+	if err := dbsqlc.New().CreateUser(ctx, tx, dbsqlc.CreateUserParams{
+		ID:    userID,
+		Email: email,
+	}); err != nil {
+		return userID, payload, fmt.Errorf("shield/magiclink: failed to create user: %w", err)
+	}
+
+	d("created a new user on the first magic link sign-in: %v", userID)
+
+	if h.config.Hooker != nil {
+		payload, err = h.config.Hooker.OnUserRegistration(ctx, userID, tx)
+		if err != nil {
+			return userID, payload, fmt.Errorf(
+				"shield/magiclink: failed to hook user registration: %w",
+				err,
+			)
+		}
+	}
+
+	return userID, payload, nil
+}
+
+// HandleDeleteExpiredTokens deletes expired tokens.
+//
+// It's intended to be run periodically.
+func (h *Handler[U]) HandleDeleteExpiredTokens(ctx context.Context) (int64, error) {
+	n, err := dbsqlc.New().DeleteExpiredMagicLinkTokens(ctx, h.pool)
+	if err != nil {
+		return 0, fmt.Errorf("shield/magiclink: failed to delete expired tokens: %w", err)
+	}
+
+	return n, nil
+}
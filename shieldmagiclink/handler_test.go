@@ -0,0 +1,199 @@
+package shieldmagiclink
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.jetify.com/typeid/v2"
+	"go.uber.org/mock/gomock"
+
+	"go.inout.gg/shield"
+	"go.inout.gg/shield/internal/dbsqlctest"
+	"go.inout.gg/shield/internal/mocks/mocks"
+	"go.inout.gg/shield/internal/testutil"
+	"go.inout.gg/shield/shieldsender"
+)
+
+// hooker records the IDs of the users it has been called for.
+type hooker struct {
+	registered []typeid.TypeID
+	loggedIn   []typeid.TypeID
+}
+
+func (h *hooker) OnUserRegistration(_ context.Context, userID typeid.TypeID, _ pgx.Tx) (string, error) {
+	h.registered = append(h.registered, userID)
+	return "registered", nil
+}
+
+func (h *hooker) OnUserLogin(_ context.Context, userID typeid.TypeID, _ pgx.Tx) (string, error) {
+	h.loggedIn = append(h.loggedIn, userID)
+	return "logged in", nil
+}
+
+// newHandler returns a handler with a fake hooker, along with a function
+// sending a link to the given email and returning the sent token.
+func newHandler(
+	t *testing.T,
+	pool *pgxpool.Pool,
+	createUser bool,
+) (*Handler[string], *hooker, func(email string) string) {
+	t.Helper()
+
+	//nolint:exhaustruct
+	hooks := &hooker{}
+	sender := mocks.NewMockSender(gomock.NewController(t))
+
+	//nolint:exhaustruct
+	h := NewHandler(pool, sender, &Config[string]{
+		Hooker:     hooks,
+		CreateUser: createUser,
+	})
+
+	sendLink := func(email string) string {
+		t.Helper()
+
+		var tokStr string
+
+		sender.EXPECT().
+			Send(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, msg shieldsender.Message) error {
+				assert.Equal(t, email, msg.Email)
+				assert.Equal(t, shieldsender.MessageKeyMagicLink, msg.Key)
+
+				payload, ok := msg.Payload.(MagicLinkMessagePayload)
+				require.True(t, ok)
+
+				tokStr = payload.Token
+
+				return nil
+			})
+
+		require.NoError(t, h.HandleSendLink(t.Context(), email))
+
+		return tokStr
+	}
+
+	return h, hooks, sendLink
+}
+
+func TestHandleSendLink(t *testing.T) {
+	t.Parallel()
+
+	t.Run("unknown email", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		h, _, _ := newHandler(t, pool, false)
+
+		require.ErrorIs(t, h.HandleSendLink(t.Context(), testutil.Email()), shield.ErrUserNotFound)
+	})
+}
+
+func TestHandleRedeem(t *testing.T) {
+	t.Parallel()
+
+	t.Run("existing user", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		h, hooks, sendLink := newHandler(t, pool, false)
+		dbUser := testutil.CreateUser(t, pool, testutil.Email(), false)
+
+		user, err := h.HandleRedeem(t.Context(), sendLink(dbUser.Email))
+		require.NoError(t, err)
+		assert.Equal(t, dbUser.ID, user.ID)
+		require.NotNil(t, user.T)
+		assert.Equal(t, "logged in", *user.T)
+		assert.Equal(t, []typeid.TypeID{dbUser.ID}, hooks.loggedIn)
+		assert.Empty(t, hooks.registered)
+
+		dbUser, err = dbsqlctest.New().TestFindUserByID(t.Context(), pool, dbUser.ID)
+		require.NoError(t, err)
+		assert.True(t, dbUser.IsEmailVerified)
+	})
+
+	t.Run("token reuse", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		h, _, sendLink := newHandler(t, pool, false)
+		dbUser := testutil.CreateUser(t, pool, testutil.Email(), true)
+
+		tokStr := sendLink(dbUser.Email)
+
+		_, err := h.HandleRedeem(t.Context(), tokStr)
+		require.NoError(t, err)
+
+		_, err = h.HandleRedeem(t.Context(), tokStr)
+		require.ErrorIs(t, err, ErrTokenInvalid)
+	})
+
+	t.Run("superseded token", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		h, _, sendLink := newHandler(t, pool, false)
+		dbUser := testutil.CreateUser(t, pool, testutil.Email(), true)
+
+		oldTokStr := sendLink(dbUser.Email)
+		tokStr := sendLink(dbUser.Email)
+
+		_, err := h.HandleRedeem(t.Context(), oldTokStr)
+		require.ErrorIs(t, err, ErrTokenInvalid)
+
+		_, err = h.HandleRedeem(t.Context(), tokStr)
+		require.NoError(t, err)
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		h, hooks, sendLink := newHandler(t, pool, false)
+		dbUser := testutil.CreateUser(t, pool, testutil.Email(), true)
+
+		tokStr := sendLink(dbUser.Email)
+		require.NoError(t, dbsqlctest.New().TestExpireMagicLinkTokensByEmail(t.Context(), pool, dbUser.Email))
+
+		_, err := h.HandleRedeem(t.Context(), tokStr)
+		require.ErrorIs(t, err, ErrTokenInvalid)
+		assert.Empty(t, hooks.loggedIn)
+	})
+
+	t.Run("creates user", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		h, hooks, sendLink := newHandler(t, pool, true)
+		email := testutil.Email()
+
+		user, err := h.HandleRedeem(t.Context(), sendLink(email))
+		require.NoError(t, err)
+		require.NotNil(t, user.T)
+		assert.Equal(t, "registered", *user.T)
+		assert.Equal(t, []typeid.TypeID{user.ID}, hooks.registered)
+		assert.Empty(t, hooks.loggedIn)
+
+		dbUser, err := dbsqlctest.New().TestFindUserByID(t.Context(), pool, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, email, dbUser.Email)
+		assert.True(t, dbUser.IsEmailVerified)
+	})
+}
+
+func TestConfigDefaults(t *testing.T) {
+	t.Parallel()
+
+	//nolint:exhaustruct
+	config := &Config[struct{}]{}
+	config.defaults()
+
+	assert.Equal(t, DefaultTokenLength, config.TokenLength)
+	assert.Equal(t, DefaultExpiresIn, config.ExpiresIn)
+	assert.NotNil(t, config.Logger)
+	assert.False(t, config.CreateUser)
+}
@@ -0,0 +1,12 @@
+// Package shieldmagiclink implements passwordless sign-in with links sent
+// by email.
+//
+// A single-use, short-lived token bound to an email address is sent to
+// the user. Redeeming the token signs the user in, optionally creating
+// the user on first use.
+package shieldmagiclink
+
+import "go.inout.gg/foundations/debug"
+
+//nolint:gochecknoglobals
+var d = debug.Debuglog("shield/magiclink")
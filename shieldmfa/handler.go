@@ -0,0 +1,253 @@
+package shieldmfa
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.inout.gg/foundations/dbsql"
+	"go.inout.gg/foundations/debug"
+	"go.jetify.com/typeid/v2"
+
+	"go.inout.gg/shield"
+	"go.inout.gg/shield/internal/dbsqlc"
+	"go.inout.gg/shield/internal/sliceutil"
+)
+
+const DefaultMaxAttempts = 5
+
+var (
+	// ErrSessionNotFound is returned when the session doesn't exist, has
+	// expired or doesn't require MFA.
+	ErrSessionNotFound = errors.New("shield/mfa: session not found")
+
+	// ErrFactorUnavailable is returned when the factor is not enabled for
+	// the user or has no verifier configured.
+	ErrFactorUnavailable = errors.New("shield/mfa: factor unavailable")
+
+	// ErrTooManyAttempts is returned when the number of failed verifications
+	// exceeds Config.MaxAttempts. The session is deleted and the user has to
+	// log in again.
+	ErrTooManyAttempts = errors.New("shield/mfa: too many attempts")
+)
+
+// Verifier verifies a second factor of a user.
+//
+// The meaning of proof is up to the factor, e.g., a TOTP code or
+// a JSON-encoded passkey assertion.
+//
+// shieldtotp.Handler, shieldemailotp.Handler and shieldpasskey.Handler
+// implement Verifier.
+type Verifier interface {
+	Verify(ctx context.Context, userID typeid.TypeID, proof string) error
+}
+
+// VerifierFunc is an adapter to allow the use of ordinary functions as
+// verifiers.
+type VerifierFunc func(ctx context.Context, userID typeid.TypeID, proof string) error
+
+func (f VerifierFunc) Verify(
+	ctx context.Context,
+	userID typeid.TypeID,
+	proof string,
+) error {
+	return f(ctx, userID, proof)
+}
+
+// Config is the configuration for the MFA handler.
+type Config struct {
+	Logger *slog.Logger // optional
+
+	// Verifiers maps factor names (e.g., shield.MFAOTP) to their verifiers.
+	//
+	// Only factors with a configured verifier can be used.
+	Verifiers map[string]Verifier // required
+
+	// MaxAttempts is the number of verifications allowed for a session.
+	//
+	// Defaults to DefaultMaxAttempts.
+	MaxAttempts int // optional
+}
+
+func (c *Config) defaults() {
+	c.Logger = cmp.Or(c.Logger, shield.DefaultLogger)
+	c.MaxAttempts = cmp.Or(c.MaxAttempts, DefaultMaxAttempts)
+}
+
+func (c *Config) assert() {
+	debug.Assert(c.Logger != nil, "Logger must be set")
+	debug.Assert(len(c.Verifiers) > 0, "Verifiers must be set")
+	debug.Assert(c.MaxAttempts > 0, "MaxAttempts must be positive")
+}
+
+// Handler upgrades partially issued sessions of users with MFA.
+type Handler struct {
+	pool   *pgxpool.Pool
+	config *Config
+}
+
+func NewHandler(pool *pgxpool.Pool, config *Config) *Handler {
+	config.defaults()
+	config.assert()
+
+	h := Handler{
+		pool:   pool,
+		config: config,
+	}
+
+	debug.Assert(h.pool != nil, "pool must be set")
+
+	return &h
+}
+
+// Challenge is a pending MFA challenge of a session.
+type Challenge struct {
+	ExpiresAt time.Time
+
+	// Factors lists the factors the user can verify the session with.
+	Factors []string
+
+	// AttemptsLeft is the number of verifications left before the session
+	// is deleted.
+	AttemptsLeft int
+	UserID       typeid.TypeID
+	SessionID    typeid.TypeID
+}
+
+// HandleFindChallenge returns the MFA challenge of the session with
+// the given sessionID.
+//
+// The session ID is returned by shieldsession.Authenticator.Authenticate along
+// with shield.ErrMFARequired.
+func (h *Handler) HandleFindChallenge(
+	ctx context.Context,
+	sessionID typeid.TypeID,
+) (*Challenge, error) {
+	sess, err := h.findSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	factors, err := h.factors(ctx, sess.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Challenge{
+		ExpiresAt:    sess.ExpiresAt,
+		Factors:      factors,
+		AttemptsLeft: max(h.config.MaxAttempts-int(sess.MfaAttempts), 0),
+		UserID:       sess.UserID,
+		SessionID:    sess.ID,
+	}, nil
+}
+
+// HandleVerifyChallenge verifies the factor of the session's user and
+// marks the session as fully authenticated.
+//
+// Every call counts as an attempt. Once Config.MaxAttempts is exceeded,
+// the session is deleted and ErrTooManyAttempts is returned.
+//
+// Errors returned by the verifier are wrapped, so they can be checked with
+// errors.Is, e.g., errors.Is(err, shieldtotp.ErrCodeIncorrect).
+func (h *Handler) HandleVerifyChallenge(
+	ctx context.Context,
+	sessionID typeid.TypeID,
+	factor, proof string,
+) error {
+	sess, err := h.findSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	factors, err := h.factors(ctx, sess.UserID)
+	if err != nil {
+		return err
+	}
+
+	if !slices.Contains(factors, factor) {
+		return ErrFactorUnavailable
+	}
+
+	q := dbsqlc.New()
+
+	// The attempt is recorded before verification, so that concurrent
+	// requests can't exceed the limit.
+	attempts, err := q.IncrementSessionMFAAttempts(ctx, h.pool, sess.ID)
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			return ErrSessionNotFound
+		}
+
+		return fmt.Errorf("shield/mfa: failed to record attempt: %w", err)
+	}
+
+	if int(attempts) > h.config.MaxAttempts {
+		d("session=%v exceeded MFA attempts", sess.ID)
+
+		if err := q.DeleteSessionByID(ctx, h.pool, sess.ID); err != nil {
+			return fmt.Errorf("shield/mfa: failed to delete session: %w", err)
+		}
+
+		return ErrTooManyAttempts
+	}
+
+	if err := h.config.Verifiers[factor].Verify(ctx, sess.UserID, proof); err != nil {
+		return fmt.Errorf("shield/mfa: failed to verify %s: %w", factor, err)
+	}
+
+	n, err := q.CompleteSessionMFA(ctx, h.pool, sess.ID)
+	if err != nil {
+		return fmt.Errorf("shield/mfa: failed to complete session: %w", err)
+	}
+
+	if n == 0 {
+		return ErrSessionNotFound
+	}
+
+	d("session=%v is fully authenticated with %s", sess.ID, factor)
+
+	return nil
+}
+
+func (h *Handler) findSession(
+	ctx context.Context,
+	sessionID typeid.TypeID,
+) (dbsqlc.ShieldUserSession, error) {
+	sess, err := dbsqlc.New().FindPendingMFASessionByID(ctx, h.pool, sessionID)
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			return sess, ErrSessionNotFound
+		}
+
+		return sess, fmt.Errorf("shield/mfa: failed to find session: %w", err)
+	}
+
+	return sess, nil
+}
+
+// factors returns the user's factors that have a verifier configured.
+func (h *Handler) factors(
+	ctx context.Context,
+	userID typeid.TypeID,
+) ([]string, error) {
+	mfas, err := dbsqlc.New().GetUserMFAs(ctx, h.pool, userID)
+	if err != nil {
+		return nil, fmt.Errorf("shield/mfa: failed to get user MFAs: %w", err)
+	}
+
+	factors := sliceutil.Map(mfas, func(m dbsqlc.ShieldUserMfa) string { return m.Name })
+
+	// Recovery codes are available to every user with MFA.
+	factors = append(factors, shield.MFARecoveryCode)
+
+	return sliceutil.Filter(factors, func(f string) bool {
+		_, ok := h.config.Verifiers[f]
+		return ok
+	}), nil
+}
@@ -0,0 +1,13 @@
+// Package shieldmfa implements the second step of the authentication for
+// users with MFA enabled.
+//
+// When a user with MFA logs in, the session is issued partially and
+// authenticating it fails with shield.ErrMFARequired. The session is then
+// upgraded to a fully authenticated one by verifying one of the user's
+// factors with Handler.HandleVerifyChallenge.
+package shieldmfa
+
+import "go.inout.gg/foundations/debug"
+
+//nolint:gochecknoglobals
+var d = debug.Debuglog("shield/mfa")
@@ -1,25 +1,105 @@
 package shieldpasskey
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"time"
 
+	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.inout.gg/foundations/dbsql"
+	"go.inout.gg/foundations/debug"
+	"go.jetify.com/typeid/v2"
 
+	"go.inout.gg/shield"
 	"go.inout.gg/shield/internal/dbsqlc"
+	"go.inout.gg/shield/internal/tid"
+	"go.inout.gg/shield/shieldsession"
 )
 
-type Handler struct {
-	wa   *webauthn.WebAuthn
-	pool *pgxpool.Pool
+const (
+	DefaultSessionExpiresIn       = 5 * time.Minute
+	DefaultResidentKeyRequirement = protocol.ResidentKeyRequirementPreferred
+)
+
+var (
+	// ErrPasskeyIncorrect is returned when the passkey assertion can't be verified.
+	ErrPasskeyIncorrect = errors.New("shield/passkey: passkey incorrect")
+
+	// ErrPasskeyAlreadyRegistered is returned when the user tries to register
+	// an authenticator that is already registered.
+	ErrPasskeyAlreadyRegistered = errors.New(
+		"shield/passkey: passkey already registered",
+	)
+
+	// ErrPasskeyCloned is returned when the authenticator signature counter
+	// indicates that the passkey might have been cloned.
+	ErrPasskeyCloned = errors.New("shield/passkey: passkey might be cloned")
+)
+
+// Hooker allows to hook into the passkey login process and perform
+// additional operations.
+type Hooker[U any] interface {
+	// OnUserLogin is called when a user is logging in with a passkey.
+	// Use this method to fetch additional data from the database for the user.
+	//
+	// Note that the passkey is already verified at this moment.
+	OnUserLogin(context.Context, typeid.TypeID, pgx.Tx) (U, error)
+}
+
+// Config is the configuration for the passkey handler.
+type Config[U any] struct {
+	Logger         *slog.Logger     // optional
+	WebauthnConfig *webauthn.Config // required
+	Hooker         Hooker[U]        // optional
+
+	// SessionExpiresIn sets for how long a started passkey ceremony
+	// can be finished.
+	//
+	// Defaults to DefaultSessionExpiresIn.
+	SessionExpiresIn time.Duration // optional
+
+	// ResidentKeyRequirement sets whether registered passkeys must be
+	// discoverable credentials, i.e., usable for usernameless login.
+	//
+	// Defaults to DefaultResidentKeyRequirement.
+	ResidentKeyRequirement protocol.ResidentKeyRequirement // optional
+}
+
+func (c *Config[U]) defaults() {
+	c.Logger = cmp.Or(c.Logger, shield.DefaultLogger)
+	c.SessionExpiresIn = cmp.Or(c.SessionExpiresIn, DefaultSessionExpiresIn)
+	c.ResidentKeyRequirement = cmp.Or(
+		c.ResidentKeyRequirement,
+		DefaultResidentKeyRequirement,
+	)
+}
+
+func (c *Config[U]) assert() {
+	debug.Assert(c.Logger != nil, "Logger must be set")
+	debug.Assert(c.WebauthnConfig != nil, "WebauthnConfig must be set")
+	debug.Assert(c.SessionExpiresIn > 0, "SessionExpiresIn must be positive")
 }
 
-type Config struct {
-	WebauthnConfig *webauthn.Config
+type Handler[U, S any] struct {
+	wa     *webauthn.WebAuthn
+	pool   *pgxpool.Pool
+	config *Config[U]
 }
 
-func NewHandler(pool *pgxpool.Pool, config *Config) (*Handler, error) {
+func NewHandler[U, S any](
+	pool *pgxpool.Pool,
+	config *Config[U],
+) (*Handler[U, S], error) {
+	config.defaults()
+	config.assert()
+
 	wa, err := webauthn.New(config.WebauthnConfig)
 	if err != nil {
 		return nil, fmt.Errorf(
@@ -28,38 +108,382 @@ func NewHandler(pool *pgxpool.Pool, config *Config) (*Handler, error) {
 		)
 	}
 
-	return &Handler{
-		wa,
-		pool,
-	}, nil
+	h := Handler[U, S]{
+		wa:     wa,
+		pool:   pool,
+		config: config,
+	}
+
+	debug.Assert(h.pool != nil, "pool must be set")
+
+	return &h, nil
+}
+
+// LoginChallenge is a started passkey login ceremony.
+//
+// Assertion is meant to be passed to the client as is, whereas ID must be
+// kept (e.g., in a cookie) to finish the ceremony with HandleFinishUserLogin.
+type LoginChallenge struct {
+	ExpiresAt time.Time
+	Assertion *protocol.CredentialAssertion
+	ID        typeid.TypeID
 }
 
-func (h *Handler) HandleStartUserLogin(
+// HandleStartUserLogin starts the passkey login ceremony for a user with
+// the given email.
+//
+// The WebAuthn session data is stored server-side and is valid for
+// Config.SessionExpiresIn.
+func (h *Handler[_, _]) HandleStartUserLogin(
 	ctx context.Context,
 	email string,
-) error {
-	row, err := dbsqlc.New().
-		FindUserWithPasskeyCredentialByEmail(ctx, h.pool, email)
+) (*LoginChallenge, error) {
+	// Forbid authorized user access.
+	if shieldsession.IsAuthenticated(ctx) {
+		return nil, shield.ErrAuthenticatedUser
+	}
+
+	dbUser, err := dbsqlc.New().FindUserByEmail(ctx, h.pool, email)
 	if err != nil {
-		return fmt.Errorf(
+		if dbsql.IsNotFoundError(err) {
+			return nil, shield.ErrUserNotFound
+		}
+
+		return nil, fmt.Errorf(
 			"shield/passkey: failed to retrieve a user: %w",
 			err,
 		)
 	}
 
-	user := &user{row}
+	user, err := findUser(ctx, h.pool, dbUser)
+	if err != nil {
+		return nil, err
+	}
 
-	_, _, err = h.wa.BeginLogin(user, nil)
+	// Treat a user without passkeys as a non-existing user/credential.
+	if len(user.credentials) == 0 {
+		d("user has no passkeys")
+		return nil, shield.ErrUserNotFound
+	}
+
+	assertion, sessionData, err := h.wa.BeginLogin(user)
 	if err != nil {
-		return fmt.Errorf(
+		return nil, fmt.Errorf(
 			"shield/passkey: unable to initialize passkey login flow: %w",
 			err,
 		)
 	}
 
-	return nil
+	sessionID, expiresAt, err := h.createSession(
+		ctx,
+		h.pool,
+		ceremonyLogin,
+		&dbUser.ID,
+		sessionData,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginChallenge{
+		ExpiresAt: expiresAt,
+		Assertion: assertion,
+		ID:        sessionID,
+	}, nil
+}
+
+// HandleFinishUserLogin finishes the passkey login ceremony started with
+// HandleStartUserLogin.
+//
+// The response is the JSON-encoded assertion returned by the client.
+//
+// On success, the authenticator sign count is updated and the user is returned,
+// so it can be passed to shieldsession.Authenticator.Issue.
+func (h *Handler[U, _]) HandleFinishUserLogin(
+	ctx context.Context,
+	challengeID typeid.TypeID,
+	response io.Reader,
+) (shield.User[U], error) {
+	var user shield.User[U]
+
+	// Forbid authorized user access.
+	if shieldsession.IsAuthenticated(ctx) {
+		return user, shield.ErrAuthenticatedUser
+	}
+
+	parsedResponse, err := protocol.ParseCredentialRequestResponseBody(response)
+	if err != nil {
+		d("failed to parse passkey assertion: %v", err)
+		return user, ErrPasskeyIncorrect
+	}
+
+	// The session is consumed outside of the transaction, so that it can't be
+	// reused even if the ceremony fails.
+	userID, sessionData, err := h.consumeSession(ctx, h.pool, ceremonyLogin, challengeID)
+	if err != nil {
+		return user, err
+	}
+
+	if userID == nil {
+		d("passkey session was started as a discoverable login")
+		return user, ErrPasskeySessionNotFound
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return user, fmt.Errorf(
+			"shield/passkey: failed to begin transaction: %w",
+			err,
+		)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	dbUser, err := dbsqlc.New().FindUserByID(ctx, tx, *userID)
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			return user, shield.ErrUserNotFound
+		}
+
+		return user, fmt.Errorf(
+			"shield/passkey: failed to retrieve a user: %w",
+			err,
+		)
+	}
+
+	wu, err := findUser(ctx, tx, dbUser)
+	if err != nil {
+		return user, err
+	}
+
+	credential, err := h.wa.ValidateLogin(wu, sessionData, parsedResponse)
+	if err != nil {
+		d("passkey assertion validation failed: %v", err)
+		return user, ErrPasskeyIncorrect
+	}
+
+	return h.finishLogin(ctx, tx, dbUser.ID, credential)
 }
 
-func (h *Handler) HandleEndUserLogin(_ context.Context) error {
+// HandleStartDiscoverableLogin starts the usernameless passkey login ceremony,
+// where the user picks one of the discoverable credentials stored on
+// the authenticator.
+//
+// Set mediation to protocol.MediationConditional to use the conditional UI
+// (passkey autofill).
+//
+// The WebAuthn session data is stored server-side and is valid for
+// Config.SessionExpiresIn.
+func (h *Handler[_, _]) HandleStartDiscoverableLogin(
+	ctx context.Context,
+	mediation protocol.CredentialMediationRequirement,
+) (*LoginChallenge, error) {
+	// Forbid authorized user access.
+	if shieldsession.IsAuthenticated(ctx) {
+		return nil, shield.ErrAuthenticatedUser
+	}
+
+	assertion, sessionData, err := h.wa.BeginDiscoverableMediatedLogin(mediation)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"shield/passkey: unable to initialize passkey login flow: %w",
+			err,
+		)
+	}
+
+	sessionID, expiresAt, err := h.createSession(
+		ctx,
+		h.pool,
+		ceremonyLogin,
+		nil,
+		sessionData,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginChallenge{
+		ExpiresAt: expiresAt,
+		Assertion: assertion,
+		ID:        sessionID,
+	}, nil
+}
+
+// HandleFinishDiscoverableLogin finishes the usernameless passkey login
+// ceremony started with HandleStartDiscoverableLogin.
+//
+// The user is looked up by the user handle returned by the authenticator,
+// which is the WebAuthn user ID set during the passkey registration.
+//
+// The response is the JSON-encoded assertion returned by the client.
+//
+// On success, the authenticator sign count is updated and the user is returned,
+// so it can be passed to shieldsession.Authenticator.Issue.
+func (h *Handler[U, _]) HandleFinishDiscoverableLogin(
+	ctx context.Context,
+	challengeID typeid.TypeID,
+	response io.Reader,
+) (shield.User[U], error) {
+	var user shield.User[U]
+
+	// Forbid authorized user access.
+	if shieldsession.IsAuthenticated(ctx) {
+		return user, shield.ErrAuthenticatedUser
+	}
+
+	parsedResponse, err := protocol.ParseCredentialRequestResponseBody(response)
+	if err != nil {
+		d("failed to parse passkey assertion: %v", err)
+		return user, ErrPasskeyIncorrect
+	}
+
+	// The session is consumed outside of the transaction, so that it can't be
+	// reused even if the ceremony fails.
+	userID, sessionData, err := h.consumeSession(ctx, h.pool, ceremonyLogin, challengeID)
+	if err != nil {
+		return user, err
+	}
+
+	if userID != nil {
+		d("passkey session was not started as a discoverable login")
+		return user, ErrPasskeySessionNotFound
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return user, fmt.Errorf(
+			"shield/passkey: failed to begin transaction: %w",
+			err,
+		)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var dbUser dbsqlc.ShieldUser
+
+	findUserByHandle := func(_, userHandle []byte) (webauthn.User, error) {
+		userID, err := tid.FromString(string(userHandle))
+		if err != nil {
+			return nil, err
+		}
+
+		dbUser, err = dbsqlc.New().FindUserByID(ctx, tx, userID)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"shield/passkey: failed to retrieve a user: %w",
+				err,
+			)
+		}
+
+		wu, err := findUser(ctx, tx, dbUser)
+		if err != nil {
+			return nil, err
+		}
+
+		return wu, nil
+	}
+
+	_, credential, err := h.wa.ValidatePasskeyLogin(
+		findUserByHandle,
+		sessionData,
+		parsedResponse,
+	)
+	if err != nil {
+		d("passkey assertion validation failed: %v", err)
+		return user, ErrPasskeyIncorrect
+	}
+
+	return h.finishLogin(ctx, tx, dbUser.ID, credential)
+}
+
+// finishLogin persists the credential state after a successful assertion
+// and commits tx.
+func (h *Handler[U, _]) finishLogin(
+	ctx context.Context,
+	tx pgx.Tx,
+	userID typeid.TypeID,
+	credential *webauthn.Credential,
+) (shield.User[U], error) {
+	var user shield.User[U]
+
+	if err := h.updatePasskey(ctx, tx, userID, credential); err != nil {
+		return user, err
+	}
+
+	// An entry point for hooking the user login process.
+	var (
+		payload U
+		err     error
+	)
+
+	if h.config.Hooker != nil {
+		d("login hooking is enabled, trying to get payload")
+
+		payload, err = h.config.Hooker.OnUserLogin(ctx, userID, tx)
+		if err != nil {
+			return user, fmt.Errorf(
+				"shield/passkey: failed to hook user login: %w",
+				err,
+			)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return user, fmt.Errorf(
+			"shield/passkey: failed to login a user: %w",
+			err,
+		)
+	}
+
+	user.ID = userID
+	user.T = &payload
+
+	return user, nil
+}
+
+// updatePasskey persists the credential state after a successful assertion.
+//
+// If the authenticator might have been cloned, tx is committed to persist
+// the clone warning and ErrPasskeyCloned is returned.
+func (h *Handler[_, _]) updatePasskey(
+	ctx context.Context,
+	tx pgx.Tx,
+	userID typeid.TypeID,
+	credential *webauthn.Credential,
+) error {
+	// Persist the updated sign count.
+	if err := dbsqlc.New().UpdateUserPasskeyOnLogin(ctx, tx, dbsqlc.UpdateUserPasskeyOnLoginParams{
+		SignCount:      int64(credential.Authenticator.SignCount),
+		CloneWarning:   credential.Authenticator.CloneWarning,
+		IsUserPresent:  credential.Flags.UserPresent,
+		IsUserVerified: credential.Flags.UserVerified,
+		IsBackupState:  credential.Flags.BackupState,
+		UserID:         userID,
+		CredentialID:   credential.ID,
+	}); err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to update passkey: %w",
+			err,
+		)
+	}
+
+	// The clone warning is persisted, so the passkey can't be used anymore.
+	if credential.Authenticator.CloneWarning {
+		h.config.Logger.WarnContext(
+			ctx,
+			"Passkey sign count indicates a possibly cloned authenticator",
+			slog.String("user_id", userID.String()),
+		)
+
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf(
+				"shield/passkey: failed to commit transaction: %w",
+				err,
+			)
+		}
+
+		return ErrPasskeyCloned
+	}
+
 	return nil
 }
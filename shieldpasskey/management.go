@@ -0,0 +1,276 @@
+package shieldpasskey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.jetify.com/typeid/v2"
+
+	"go.inout.gg/shield"
+	"go.inout.gg/shield/internal/dbsqlc"
+	"go.inout.gg/shield/internal/sliceutil"
+	"go.inout.gg/shield/internal/tid"
+	"go.inout.gg/shield/shieldsession"
+)
+
+// ErrPasskeyNotFound is returned when the passkey doesn't exist or
+// belongs to another user.
+var ErrPasskeyNotFound = errors.New("shield/passkey: passkey not found")
+
+// Passkey is a passkey registered by a user.
+type Passkey struct {
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	Name       string
+
+	// AAGUID identifies the authenticator model, it can be used to show
+	// a recognizable authenticator name, e.g., "iCloud Keychain" or "YubiKey 5".
+	AAGUID     string
+	Transports []string
+	ID         typeid.TypeID
+}
+
+// HandleListPasskeys returns all passkeys registered by the signed-in user.
+//
+// The session is expected to be provided via a passed ctx context.
+func (h *Handler[_, S]) HandleListPasskeys(ctx context.Context) ([]Passkey, error) {
+	sess, err := shieldsession.FromContext[S](ctx)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"shield/passkey: failed to retrieve session from the context: %w",
+			err,
+		)
+	}
+
+	passkeys, err := dbsqlc.New().FindUserPasskeysByUserID(ctx, h.pool, sess.UserID)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"shield/passkey: failed to retrieve user passkeys: %w",
+			err,
+		)
+	}
+
+	return sliceutil.Map(
+		passkeys,
+		func(p dbsqlc.ShieldUserPasskey) Passkey {
+			aaguid, err := uuid.FromBytes(p.Aaguid)
+			if err != nil {
+				aaguid = uuid.Nil
+			}
+
+			return Passkey{
+				CreatedAt:  p.CreatedAt,
+				LastUsedAt: p.LastUsedAt,
+				Name:       p.Name,
+				AAGUID:     aaguid.String(),
+				Transports: p.Transports,
+				ID:         p.ID,
+			}
+		},
+	), nil
+}
+
+// HandleRenamePasskey renames a passkey with the given ID registered by
+// the signed-in user.
+//
+// The session is expected to be provided via a passed ctx context.
+func (h *Handler[_, S]) HandleRenamePasskey(
+	ctx context.Context,
+	passkeyID typeid.TypeID,
+	name string,
+) error {
+	sess, err := shieldsession.FromContext[S](ctx)
+	if err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to retrieve session from the context: %w",
+			err,
+		)
+	}
+
+	n, err := dbsqlc.New().RenameUserPasskey(ctx, h.pool, dbsqlc.RenameUserPasskeyParams{
+		Name:   name,
+		ID:     passkeyID,
+		UserID: sess.UserID,
+	})
+	if err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to rename passkey: %w",
+			err,
+		)
+	}
+
+	if n == 0 {
+		return ErrPasskeyNotFound
+	}
+
+	return nil
+}
+
+// HandleDeletePasskey deletes a passkey with the given ID registered by
+// the signed-in user.
+//
+// The session is expected to be provided via a passed ctx context.
+func (h *Handler[_, S]) HandleDeletePasskey(
+	ctx context.Context,
+	passkeyID typeid.TypeID,
+) error {
+	sess, err := shieldsession.FromContext[S](ctx)
+	if err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to retrieve session from the context: %w",
+			err,
+		)
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to begin transaction: %w",
+			err,
+		)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	q := dbsqlc.New()
+
+	n, err := q.DeleteUserPasskey(ctx, tx, dbsqlc.DeleteUserPasskeyParams{
+		ID:     passkeyID,
+		UserID: sess.UserID,
+	})
+	if err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to delete passkey: %w",
+			err,
+		)
+	}
+
+	if n == 0 {
+		return ErrPasskeyNotFound
+	}
+
+	// Passkey MFA can't be completed without passkeys.
+	passkeys, err := q.FindUserPasskeysByUserID(ctx, tx, sess.UserID)
+	if err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to retrieve user passkeys: %w",
+			err,
+		)
+	}
+
+	if len(passkeys) == 0 {
+		if err := q.DeleteUserMFA(ctx, tx, dbsqlc.DeleteUserMFAParams{
+			UserID: sess.UserID,
+			Name:   shield.MFAPasskey,
+		}); err != nil {
+			return fmt.Errorf(
+				"shield/passkey: failed to delete MFA factor: %w",
+				err,
+			)
+		}
+
+		d("deleted the last passkey, passkey MFA is disabled")
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to commit transaction: %w",
+			err,
+		)
+	}
+
+	d("deleted passkey with ID: %v", passkeyID)
+
+	return nil
+}
+
+// HandleEnrollMFA enables passkeys as a second factor for the signed-in
+// user, verified with HandleStartMFAChallenge and Verify.
+//
+// The user must have at least one passkey registered, otherwise
+// ErrPasskeyNotFound is returned. Passkey MFA is disabled once the last
+// passkey is deleted.
+//
+// The session is expected to be provided via a passed ctx context.
+func (h *Handler[_, S]) HandleEnrollMFA(ctx context.Context) error {
+	sess, err := shieldsession.FromContext[S](ctx)
+	if err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to retrieve session from the context: %w",
+			err,
+		)
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to begin transaction: %w",
+			err,
+		)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	q := dbsqlc.New()
+
+	passkeys, err := q.FindUserPasskeysByUserID(ctx, tx, sess.UserID)
+	if err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to retrieve user passkeys: %w",
+			err,
+		)
+	}
+
+	if len(passkeys) == 0 {
+		return ErrPasskeyNotFound
+	}
+
+	if err := q.CreateUserMFA(ctx, tx, dbsqlc.CreateUserMFAParams{
+		ID:     tid.MustMFAID(),
+		UserID: sess.UserID,
+		Name:   shield.MFAPasskey,
+	}); err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to create MFA factor: %w",
+			err,
+		)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to commit transaction: %w",
+			err,
+		)
+	}
+
+	return nil
+}
+
+// HandleUnenrollMFA disables passkeys as a second factor for the signed-in
+// user. The passkeys themselves are kept.
+//
+// The session is expected to be provided via a passed ctx context.
+func (h *Handler[_, S]) HandleUnenrollMFA(ctx context.Context) error {
+	sess, err := shieldsession.FromContext[S](ctx)
+	if err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to retrieve session from the context: %w",
+			err,
+		)
+	}
+
+	if err := dbsqlc.New().DeleteUserMFA(ctx, h.pool, dbsqlc.DeleteUserMFAParams{
+		UserID: sess.UserID,
+		Name:   shield.MFAPasskey,
+	}); err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to delete MFA factor: %w",
+			err,
+		)
+	}
+
+	return nil
+}
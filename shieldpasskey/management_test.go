@@ -0,0 +1,170 @@
+package shieldpasskey
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.jetify.com/typeid/v2"
+
+	"go.inout.gg/shield"
+	"go.inout.gg/shield/internal/dbsqlc"
+	"go.inout.gg/shield/internal/sliceutil"
+	"go.inout.gg/shield/internal/testutil"
+	"go.inout.gg/shield/internal/tid"
+	"go.inout.gg/shield/shieldmfa"
+)
+
+func newHandler(t *testing.T, pool *pgxpool.Pool) *Handler[struct{}, struct{}] {
+	t.Helper()
+
+	//nolint:exhaustruct
+	h, err := NewHandler[struct{}, struct{}](pool, &Config[struct{}]{
+		//nolint:exhaustruct
+		WebauthnConfig: &webauthn.Config{
+			RPID:          "example.com",
+			RPDisplayName: "Example",
+			RPOrigins:     []string{"https://example.com"},
+		},
+	})
+	require.NoError(t, err)
+
+	return h
+}
+
+// createPasskey stores a passkey of the user with the given userID.
+func createPasskey(t *testing.T, pool *pgxpool.Pool, userID typeid.TypeID) typeid.TypeID {
+	t.Helper()
+
+	passkeyID := tid.MustPasskeyID()
+	err := dbsqlc.New().CreateUserPasskey(t.Context(), pool, dbsqlc.CreateUserPasskeyParams{
+		ID:               passkeyID,
+		UserID:           userID,
+		Name:             "Passkey",
+		CredentialID:     []byte(rand.Text()),
+		PublicKey:        []byte("public key"),
+		AttestationType:  "none",
+		Attestation:      []byte("{}"),
+		Transports:       []string{},
+		Aaguid:           make([]byte, 16),
+		SignCount:        0,
+		Attachment:       "",
+		IsUserPresent:    true,
+		IsUserVerified:   true,
+		IsBackupEligible: false,
+		IsBackupState:    false,
+	})
+	require.NoError(t, err)
+
+	return passkeyID
+}
+
+// mfas returns names of the user's MFA factors.
+func mfas(t *testing.T, pool *pgxpool.Pool, userID typeid.TypeID) []string {
+	t.Helper()
+
+	mfas, err := dbsqlc.New().GetUserMFAs(t.Context(), pool, userID)
+	require.NoError(t, err)
+
+	return sliceutil.Map(mfas, func(m dbsqlc.ShieldUserMfa) string { return m.Name })
+}
+
+func TestHandleEnrollMFA(t *testing.T) {
+	t.Parallel()
+
+	t.Run("without passkeys", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		h := newHandler(t, pool)
+		user := testutil.CreateUser(t, pool, testutil.Email(), true)
+		ctx := testutil.SessionContext[struct{}](t, user.ID)
+
+		require.ErrorIs(t, h.HandleEnrollMFA(ctx), ErrPasskeyNotFound)
+		assert.Empty(t, mfas(t, pool, user.ID))
+	})
+
+	t.Run("enroll and unenroll", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		h := newHandler(t, pool)
+		user := testutil.CreateUser(t, pool, testutil.Email(), true)
+		ctx := testutil.SessionContext[struct{}](t, user.ID)
+		createPasskey(t, pool, user.ID)
+
+		require.NoError(t, h.HandleEnrollMFA(ctx))
+		require.NoError(t, h.HandleEnrollMFA(ctx))
+		assert.Equal(t, []string{shield.MFAPasskey}, mfas(t, pool, user.ID))
+
+		require.NoError(t, h.HandleUnenrollMFA(ctx))
+		assert.Empty(t, mfas(t, pool, user.ID))
+	})
+
+	t.Run("offered as MFA factor", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		h := newHandler(t, pool)
+		user := testutil.CreateUser(t, pool, testutil.Email(), true)
+		ctx := testutil.SessionContext[struct{}](t, user.ID)
+		createPasskey(t, pool, user.ID)
+		require.NoError(t, h.HandleEnrollMFA(ctx))
+
+		sessionID, err := dbsqlc.New().CreateUserSession(t.Context(), pool, dbsqlc.CreateUserSessionParams{
+			ID:            tid.MustSessionID(),
+			UserID:        user.ID,
+			ExpiresAt:     time.Now().Add(time.Hour),
+			IsMfaRequired: true,
+		})
+		require.NoError(t, err)
+
+		//nolint:exhaustruct
+		mfa := shieldmfa.NewHandler(pool, &shieldmfa.Config{
+			Verifiers: map[string]shieldmfa.Verifier{shield.MFAPasskey: h},
+		})
+
+		challenge, err := mfa.HandleFindChallenge(t.Context(), sessionID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{shield.MFAPasskey}, challenge.Factors)
+	})
+}
+
+func TestHandleDeletePasskey(t *testing.T) {
+	t.Parallel()
+
+	t.Run("keeps MFA with passkeys left", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		h := newHandler(t, pool)
+		user := testutil.CreateUser(t, pool, testutil.Email(), true)
+		ctx := testutil.SessionContext[struct{}](t, user.ID)
+		passkeyID := createPasskey(t, pool, user.ID)
+		createPasskey(t, pool, user.ID)
+		require.NoError(t, h.HandleEnrollMFA(ctx))
+
+		require.NoError(t, h.HandleDeletePasskey(ctx, passkeyID))
+		assert.Equal(t, []string{shield.MFAPasskey}, mfas(t, pool, user.ID))
+	})
+
+	t.Run("last passkey disables MFA", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		h := newHandler(t, pool)
+		user := testutil.CreateUser(t, pool, testutil.Email(), true)
+		ctx := testutil.SessionContext[struct{}](t, user.ID)
+		passkeyID := createPasskey(t, pool, user.ID)
+		require.NoError(t, h.HandleEnrollMFA(ctx))
+
+		require.NoError(t, h.HandleDeletePasskey(ctx, passkeyID))
+		assert.Empty(t, mfas(t, pool, user.ID))
+
+		require.ErrorIs(t, h.HandleDeletePasskey(ctx, passkeyID), ErrPasskeyNotFound)
+	})
+}
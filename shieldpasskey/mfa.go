@@ -0,0 +1,168 @@
+package shieldpasskey
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.inout.gg/foundations/dbsql"
+	"go.jetify.com/typeid/v2"
+
+	"go.inout.gg/shield"
+	"go.inout.gg/shield/internal/dbsqlc"
+)
+
+// HandleStartMFAChallenge starts the passkey assertion ceremony for
+// the user with the given userID, who has passed the first authentication
+// step and has to verify a second factor.
+//
+// The ceremony is finished by Verify, typically via shieldmfa.Handler.
+// shieldmfa.Handler offers passkeys only to users who enabled them with
+// HandleEnrollMFA.
+func (h *Handler[_, _]) HandleStartMFAChallenge(
+	ctx context.Context,
+	userID typeid.TypeID,
+) (*LoginChallenge, error) {
+	dbUser, err := dbsqlc.New().FindUserByID(ctx, h.pool, userID)
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			return nil, shield.ErrUserNotFound
+		}
+
+		return nil, fmt.Errorf(
+			"shield/passkey: failed to retrieve a user: %w",
+			err,
+		)
+	}
+
+	user, err := findUser(ctx, h.pool, dbUser)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(user.credentials) == 0 {
+		d("user has no passkeys")
+		return nil, ErrPasskeyNotFound
+	}
+
+	assertion, sessionData, err := h.wa.BeginLogin(user)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"shield/passkey: unable to initialize passkey MFA flow: %w",
+			err,
+		)
+	}
+
+	sessionID, expiresAt, err := h.createSession(
+		ctx,
+		h.pool,
+		ceremonyMFA,
+		&dbUser.ID,
+		sessionData,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginChallenge{
+		ExpiresAt: expiresAt,
+		Assertion: assertion,
+		ID:        sessionID,
+	}, nil
+}
+
+// Verify finishes the passkey assertion ceremony started with
+// HandleStartMFAChallenge, where proof is the JSON-encoded assertion
+// returned by the client.
+//
+// The ceremony is looked up by the challenge signed by the authenticator.
+func (h *Handler[_, _]) Verify(
+	ctx context.Context,
+	userID typeid.TypeID,
+	proof string,
+) error {
+	parsedResponse, err := protocol.ParseCredentialRequestResponseBody(
+		strings.NewReader(proof),
+	)
+	if err != nil {
+		d("failed to parse passkey assertion: %v", err)
+		return ErrPasskeyIncorrect
+	}
+
+	sess, err := dbsqlc.New().ConsumeUserPasskeySessionByChallenge(
+		ctx,
+		h.pool,
+		dbsqlc.ConsumeUserPasskeySessionByChallengeParams{
+			UserID:    &userID,
+			Ceremony:  string(ceremonyMFA),
+			Challenge: parsedResponse.Response.CollectedClientData.Challenge,
+		},
+	)
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			return ErrPasskeySessionNotFound
+		}
+
+		return fmt.Errorf(
+			"shield/passkey: failed to retrieve passkey session: %w",
+			err,
+		)
+	}
+
+	var sessionData webauthn.SessionData
+	if err := json.Unmarshal(sess.SessionData, &sessionData); err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to decode passkey session: %w",
+			err,
+		)
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to begin transaction: %w",
+			err,
+		)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	dbUser, err := dbsqlc.New().FindUserByID(ctx, tx, userID)
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			return shield.ErrUserNotFound
+		}
+
+		return fmt.Errorf(
+			"shield/passkey: failed to retrieve a user: %w",
+			err,
+		)
+	}
+
+	wu, err := findUser(ctx, tx, dbUser)
+	if err != nil {
+		return err
+	}
+
+	credential, err := h.wa.ValidateLogin(wu, sessionData, parsedResponse)
+	if err != nil {
+		d("passkey assertion validation failed: %v", err)
+		return ErrPasskeyIncorrect
+	}
+
+	if err := h.updatePasskey(ctx, tx, dbUser.ID, credential); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to commit transaction: %w",
+			err,
+		)
+	}
+
+	return nil
+}
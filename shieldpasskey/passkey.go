@@ -3,5 +3,5 @@ package shieldpasskey
 
 import "go.inout.gg/foundations/debug"
 
-//nolint:unused,gochecknoglobals
+//nolint:gochecknoglobals
 var d = debug.Debuglog("shield/passkey")
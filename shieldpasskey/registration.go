@@ -0,0 +1,217 @@
+package shieldpasskey
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.inout.gg/foundations/dbsql"
+	"go.jetify.com/typeid/v2"
+
+	"go.inout.gg/shield/internal/dbsqlc"
+	"go.inout.gg/shield/internal/sliceutil"
+	"go.inout.gg/shield/internal/tid"
+	"go.inout.gg/shield/shieldsession"
+)
+
+// DefaultPasskeyName is the name given to a passkey registered without a name.
+const DefaultPasskeyName = "Passkey"
+
+// RegistrationChallenge is a started passkey registration ceremony.
+//
+// Creation is meant to be passed to the client as is, whereas ID must be
+// kept (e.g., in a cookie) to finish the ceremony with HandleFinishRegistration.
+type RegistrationChallenge struct {
+	ExpiresAt time.Time
+	Creation  *protocol.CredentialCreation
+	ID        typeid.TypeID
+}
+
+// HandleStartRegistration starts the passkey registration ceremony for
+// the signed-in user.
+//
+// Already registered passkeys are passed to the client as an exclusion list,
+// so the same authenticator can't be registered twice.
+//
+// The session is expected to be provided via a passed ctx context.
+func (h *Handler[_, S]) HandleStartRegistration(
+	ctx context.Context,
+) (*RegistrationChallenge, error) {
+	sess, err := shieldsession.FromContext[S](ctx)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"shield/passkey: failed to retrieve session from the context: %w",
+			err,
+		)
+	}
+
+	dbUser, err := dbsqlc.New().FindUserByID(ctx, h.pool, sess.UserID)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"shield/passkey: failed to retrieve a user: %w",
+			err,
+		)
+	}
+
+	wu, err := findUser(ctx, h.pool, dbUser)
+	if err != nil {
+		return nil, err
+	}
+
+	exclusions := sliceutil.Map(
+		wu.WebAuthnCredentials(),
+		func(c webauthn.Credential) protocol.CredentialDescriptor {
+			return c.Descriptor()
+		},
+	)
+
+	creation, sessionData, err := h.wa.BeginRegistration(
+		wu,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(h.config.ResidentKeyRequirement),
+	)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"shield/passkey: unable to initialize passkey registration flow: %w",
+			err,
+		)
+	}
+
+	sessionID, expiresAt, err := h.createSession(
+		ctx,
+		h.pool,
+		ceremonyRegistration,
+		&dbUser.ID,
+		sessionData,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RegistrationChallenge{
+		ExpiresAt: expiresAt,
+		Creation:  creation,
+		ID:        sessionID,
+	}, nil
+}
+
+// HandleFinishRegistration finishes the passkey registration ceremony started
+// with HandleStartRegistration and stores the created credential under
+// the given name.
+//
+// If name is empty, DefaultPasskeyName is used instead.
+//
+// The response is the JSON-encoded attestation returned by the client.
+//
+// The session is expected to be provided via a passed ctx context.
+func (h *Handler[_, S]) HandleFinishRegistration(
+	ctx context.Context,
+	challengeID typeid.TypeID,
+	name string,
+	response io.Reader,
+) error {
+	sess, err := shieldsession.FromContext[S](ctx)
+	if err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to retrieve session from the context: %w",
+			err,
+		)
+	}
+
+	parsedResponse, err := protocol.ParseCredentialCreationResponseBody(response)
+	if err != nil {
+		d("failed to parse passkey attestation: %v", err)
+		return ErrPasskeyIncorrect
+	}
+
+	// The session is consumed outside of the transaction, so that it can't be
+	// reused even if the ceremony fails.
+	userID, sessionData, err := h.consumeSession(
+		ctx,
+		h.pool,
+		ceremonyRegistration,
+		challengeID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if userID == nil || *userID != sess.UserID {
+		d("passkey session belongs to a different user")
+		return ErrPasskeySessionNotFound
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to begin transaction: %w",
+			err,
+		)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	dbUser, err := dbsqlc.New().FindUserByID(ctx, tx, *userID)
+	if err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to retrieve a user: %w",
+			err,
+		)
+	}
+
+	wu, err := findUser(ctx, tx, dbUser)
+	if err != nil {
+		return err
+	}
+
+	credential, err := h.wa.CreateCredential(wu, sessionData, parsedResponse)
+	if err != nil {
+		d("passkey attestation validation failed: %v", err)
+		return ErrPasskeyIncorrect
+	}
+
+	// Authenticators are expected to respect the exclusion list, but
+	// double-check it here as the client can't be trusted.
+	for _, c := range wu.credentials {
+		if bytes.Equal(c.ID, credential.ID) {
+			return ErrPasskeyAlreadyRegistered
+		}
+	}
+
+	params, err := passkeyParams(
+		tid.MustPasskeyID(),
+		dbUser.ID,
+		cmp.Or(name, DefaultPasskeyName),
+		credential,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := dbsqlc.New().CreateUserPasskey(ctx, tx, params); err != nil {
+		if dbsql.IsUniqueViolationError(err) {
+			return ErrPasskeyAlreadyRegistered
+		}
+
+		return fmt.Errorf(
+			"shield/passkey: failed to store passkey: %w",
+			err,
+		)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf(
+			"shield/passkey: failed to register a passkey: %w",
+			err,
+		)
+	}
+
+	d("registered a new passkey for the user with ID: %v", dbUser.ID)
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package shieldpasskey
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.inout.gg/foundations/dbsql"
+	"go.jetify.com/typeid/v2"
+
+	"go.inout.gg/shield/internal/dbsqlc"
+	"go.inout.gg/shield/internal/tid"
+)
+
+// ErrPasskeySessionNotFound is returned when the passkey ceremony session
+// is either missing, expired or has already been used.
+var ErrPasskeySessionNotFound = errors.New(
+	"shield/passkey: passkey session not found",
+)
+
+// ceremony is a WebAuthn ceremony a passkey session is issued for.
+type ceremony string
+
+const (
+	ceremonyLogin        ceremony = "login"
+	ceremonyRegistration ceremony = "registration"
+	ceremonyMFA          ceremony = "mfa"
+)
+
+// createSession stores the WebAuthn session data server-side, so it can be
+// retrieved later on when finishing the ceremony.
+//
+// userID is nil for discoverable logins, as the user is not known upfront.
+func (h *Handler[_, _]) createSession(
+	ctx context.Context,
+	db dbsqlc.DBTX,
+	c ceremony,
+	userID *typeid.TypeID,
+	sessionData *webauthn.SessionData,
+) (typeid.TypeID, time.Time, error) {
+	sessionID := tid.MustPasskeySessionID()
+	expiresAt := time.Now().Add(h.config.SessionExpiresIn)
+
+	data, err := json.Marshal(sessionData)
+	if err != nil {
+		return sessionID, expiresAt, fmt.Errorf(
+			"shield/passkey: failed to encode passkey session: %w",
+			err,
+		)
+	}
+
+	if err := dbsqlc.New().CreatePasskeySession(ctx, db, dbsqlc.CreatePasskeySessionParams{
+		ID:          sessionID,
+		Ceremony:    string(c),
+		UserID:      userID,
+		SessionData: data,
+		ExpiresAt:   expiresAt,
+	}); err != nil {
+		return sessionID, expiresAt, fmt.Errorf(
+			"shield/passkey: failed to create passkey session: %w",
+			err,
+		)
+	}
+
+	d("created passkey %s session with id=%v", c, sessionID)
+
+	return sessionID, expiresAt, nil
+}
+
+// consumeSession retrieves and removes the WebAuthn session data, so that
+// the same session can't be reused twice.
+func (h *Handler[_, _]) consumeSession(
+	ctx context.Context,
+	db dbsqlc.DBTX,
+	c ceremony,
+	sessionID typeid.TypeID,
+) (*typeid.TypeID, webauthn.SessionData, error) {
+	var sessionData webauthn.SessionData
+
+	sess, err := dbsqlc.New().
+		ConsumePasskeySession(ctx, db, dbsqlc.ConsumePasskeySessionParams{
+			ID:       sessionID,
+			Ceremony: string(c),
+		})
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			return sess.UserID, sessionData, ErrPasskeySessionNotFound
+		}
+
+		return sess.UserID, sessionData, fmt.Errorf(
+			"shield/passkey: failed to retrieve passkey session: %w",
+			err,
+		)
+	}
+
+	if err := json.Unmarshal(sess.SessionData, &sessionData); err != nil {
+		return sess.UserID, sessionData, fmt.Errorf(
+			"shield/passkey: failed to decode passkey session: %w",
+			err,
+		)
+	}
+
+	return sess.UserID, sessionData, nil
+}
@@ -1,29 +1,150 @@
 package shieldpasskey
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 
+	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/go-webauthn/webauthn/webauthn"
+	"go.jetify.com/typeid/v2"
 
 	"go.inout.gg/shield/internal/dbsqlc"
+	"go.inout.gg/shield/internal/sliceutil"
 )
 
 var _ webauthn.User = (*user)(nil)
 
+// user adapts a shield user to the webauthn.User interface.
 type user struct {
-	dbsqlc.FindUserWithPasskeyCredentialByEmailRow
+	email       string
+	credentials []webauthn.Credential
+	id          typeid.TypeID
 }
 
-func (u *user) WebAuthnCredentials() []webauthn.Credential {
-	var credentials []webauthn.Credential
-	if err := json.Unmarshal(u.UserCredential, &credentials); err != nil {
-		panic(err)
+// newUser creates a new webauthn user from the passkeys stored in the database.
+func newUser(
+	id typeid.TypeID,
+	email string,
+	passkeys []dbsqlc.ShieldUserPasskey,
+) (*user, error) {
+	credentials := make([]webauthn.Credential, len(passkeys))
+
+	for i, passkey := range passkeys {
+		credential, err := credentialFromPasskey(passkey)
+		if err != nil {
+			return nil, err
+		}
+
+		credentials[i] = credential
+	}
+
+	return &user{
+		email:       email,
+		credentials: credentials,
+		id:          id,
+	}, nil
+}
+
+// findUser loads all passkeys of the dbUser and adapts it to the webauthn.User
+// interface.
+func findUser(ctx context.Context, db dbsqlc.DBTX, dbUser dbsqlc.ShieldUser) (*user, error) {
+	passkeys, err := dbsqlc.New().FindUserPasskeysByUserID(ctx, db, dbUser.ID)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"shield/passkey: failed to retrieve user passkeys: %w",
+			err,
+		)
+	}
+
+	return newUser(dbUser.ID, dbUser.Email, passkeys)
+}
+
+func (u *user) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+func (u *user) WebAuthnDisplayName() string                { return u.email }
+func (u *user) WebAuthnID() []byte                         { return []byte(u.id.String()) }
+func (u *user) WebAuthnIcon() string                       { return "" }
+func (u *user) WebAuthnName() string                       { return u.email }
+
+// credentialFromPasskey converts a stored passkey to a webauthn credential.
+func credentialFromPasskey(passkey dbsqlc.ShieldUserPasskey) (webauthn.Credential, error) {
+	var (
+		credential  webauthn.Credential
+		attestation webauthn.CredentialAttestation
+	)
+
+	if err := json.Unmarshal(passkey.Attestation, &attestation); err != nil {
+		return credential, fmt.Errorf(
+			"shield/passkey: failed to decode passkey attestation: %w",
+			err,
+		)
 	}
 
-	return credentials
+	credential = webauthn.Credential{
+		ID:              passkey.CredentialID,
+		PublicKey:       passkey.PublicKey,
+		AttestationType: passkey.AttestationType,
+		Transport: sliceutil.Map(
+			passkey.Transports,
+			func(t string) protocol.AuthenticatorTransport {
+				return protocol.AuthenticatorTransport(t)
+			},
+		),
+		Flags: webauthn.CredentialFlags{
+			UserPresent:    passkey.IsUserPresent,
+			UserVerified:   passkey.IsUserVerified,
+			BackupEligible: passkey.IsBackupEligible,
+			BackupState:    passkey.IsBackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:       passkey.Aaguid,
+			SignCount:    uint32(passkey.SignCount), //nolint:gosec
+			CloneWarning: passkey.CloneWarning,
+			Attachment:   protocol.AuthenticatorAttachment(passkey.Attachment),
+		},
+		Attestation: attestation,
+	}
+
+	return credential, nil
 }
 
-func (u *user) WebAuthnDisplayName() string { return u.Email }
-func (u *user) WebAuthnID() []byte          { return []byte(u.ID.String()) }
-func (u *user) WebAuthnIcon() string        { return "" }
-func (u *user) WebAuthnName() string        { return u.Email }
+// passkeyParams converts a webauthn credential to parameters used to store
+// it in the database.
+func passkeyParams(
+	id, userID typeid.TypeID,
+	name string,
+	credential *webauthn.Credential,
+) (dbsqlc.CreateUserPasskeyParams, error) {
+	var params dbsqlc.CreateUserPasskeyParams
+
+	attestation, err := json.Marshal(credential.Attestation)
+	if err != nil {
+		return params, fmt.Errorf(
+			"shield/passkey: failed to encode passkey attestation: %w",
+			err,
+		)
+	}
+
+	params = dbsqlc.CreateUserPasskeyParams{
+		ID:              id,
+		UserID:          userID,
+		Name:            name,
+		CredentialID:    credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Attestation:     attestation,
+		Transports: sliceutil.Map(
+			credential.Transport,
+			func(t protocol.AuthenticatorTransport) string { return string(t) },
+		),
+		Aaguid:           credential.Authenticator.AAGUID,
+		SignCount:        int64(credential.Authenticator.SignCount),
+		Attachment:       string(credential.Authenticator.Attachment),
+		IsUserPresent:    credential.Flags.UserPresent,
+		IsUserVerified:   credential.Flags.UserVerified,
+		IsBackupEligible: credential.Flags.BackupEligible,
+		IsBackupState:    credential.Flags.BackupState,
+	}
+
+	return params, nil
+}
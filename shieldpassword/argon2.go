@@ -0,0 +1,281 @@
+package shieldpassword
+
+import (
+	"cmp"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.inout.gg/foundations/debug"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/text/unicode/norm"
+)
+
+var _ PasswordHasher = (*argon2PasswordHasher)(nil)
+
+// Argon2 defaults follow the OWASP Password Storage Cheat Sheet
+// recommendation.
+const (
+	Argon2DefaultMemory      = 19 * 1024 // KiB
+	Argon2DefaultIterations  = 2
+	Argon2DefaultParallelism = 1
+	Argon2DefaultSaltLength  = 16
+	Argon2DefaultKeyLength   = 32
+)
+
+// Bounds of Argon2id parameters accepted from stored hashes, so that
+// a tampered hash can't make verification arbitrarily expensive.
+const (
+	argon2MaxMemory      = 1024 * 1024 // KiB
+	argon2MaxIterations  = 64
+	argon2MaxParallelism = 64
+	argon2MinSaltLength  = 8
+	argon2MaxSaltLength  = 64
+	argon2MinKeyLength   = 16
+	argon2MaxKeyLength   = 128
+)
+
+// ErrMalformedHash is returned when a stored password hash can't be decoded.
+var ErrMalformedHash = errors.New("shield/password: malformed password hash")
+
+//nolint:gochecknoglobals
+var b64 = base64.RawStdEncoding
+
+// Argon2Config is the configuration for the Argon2id password hasher.
+type Argon2Config struct {
+	// Memory is the amount of memory used in KiB.
+	//
+	// Defaults to Argon2DefaultMemory.
+	Memory uint32 // optional
+
+	// Iterations is the number of passes over the memory.
+	//
+	// Defaults to Argon2DefaultIterations.
+	Iterations uint32 // optional
+
+	// Parallelism is the number of threads used.
+	//
+	// Defaults to Argon2DefaultParallelism.
+	Parallelism uint8 // optional
+
+	// SaltLength is the length of a random salt in bytes.
+	//
+	// Defaults to Argon2DefaultSaltLength.
+	SaltLength uint32 // optional
+
+	// KeyLength is the length of a generated hash in bytes.
+	//
+	// Defaults to Argon2DefaultKeyLength.
+	KeyLength uint32 // optional
+}
+
+func (c *Argon2Config) defaults() {
+	c.Memory = cmp.Or(c.Memory, Argon2DefaultMemory)
+	c.Iterations = cmp.Or(c.Iterations, Argon2DefaultIterations)
+	c.Parallelism = cmp.Or(c.Parallelism, Argon2DefaultParallelism)
+	c.SaltLength = cmp.Or(c.SaltLength, Argon2DefaultSaltLength)
+	c.KeyLength = cmp.Or(c.KeyLength, Argon2DefaultKeyLength)
+}
+
+func (c *Argon2Config) assert() {
+	debug.Assert(c.Memory >= 8*uint32(c.Parallelism), "Memory must be at least 8*Parallelism KiB")
+	debug.Assert(c.Memory <= argon2MaxMemory, "Memory must be at most 1 GiB")
+	debug.Assert(c.Iterations > 0, "Iterations must be positive")
+	debug.Assert(c.Iterations <= argon2MaxIterations, "Iterations must be at most 64")
+	debug.Assert(c.Parallelism > 0, "Parallelism must be positive")
+	debug.Assert(c.Parallelism <= argon2MaxParallelism, "Parallelism must be at most 64")
+	debug.Assert(c.SaltLength >= argon2MinSaltLength, "SaltLength must be at least 8 bytes")
+	debug.Assert(c.SaltLength <= argon2MaxSaltLength, "SaltLength must be at most 64 bytes")
+	debug.Assert(c.KeyLength >= argon2MinKeyLength, "KeyLength must be at least 16 bytes")
+	debug.Assert(c.KeyLength <= argon2MaxKeyLength, "KeyLength must be at most 128 bytes")
+}
+
+type argon2PasswordHasher struct {
+	config *Argon2Config
+}
+
+// NewArgon2PasswordHasher creates a password hasher using the Argon2id
+// algorithm.
+//
+// Hashes are encoded as PHC strings, e.g., $argon2id$v=19$m=19456,t=2,p=1$...,
+// so they carry the parameters they were created with.
+//
+// If config is nil, the default config is used.
+func NewArgon2PasswordHasher(config *Argon2Config) PasswordHasher {
+	if config == nil {
+		//nolint:exhaustruct
+		config = &Argon2Config{}
+	}
+
+	config.defaults()
+	config.assert()
+
+	return &argon2PasswordHasher{config}
+}
+
+func (h *argon2PasswordHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.config.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf(
+			"shield/password: unable to generate a salt: %w",
+			err,
+		)
+	}
+
+	params := argon2Params{
+		memory:      h.config.Memory,
+		iterations:  h.config.Iterations,
+		parallelism: h.config.Parallelism,
+		salt:        salt,
+		key:         nil,
+	}
+	params.key = params.derive(password, h.config.KeyLength)
+
+	return params.String(), nil
+}
+
+func (h *argon2PasswordHasher) Verify(
+	hashedPassword string,
+	password string,
+) (bool, error) {
+	params, err := parseArgon2Hash(hashedPassword)
+	if err != nil {
+		return false, err
+	}
+
+	//nolint:gosec // the key length is bounded by the decoded hash.
+	key := params.derive(password, uint32(len(params.key)))
+
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+func (h *argon2PasswordHasher) NeedsRehash(hashedPassword string) bool {
+	params, err := parseArgon2Hash(hashedPassword)
+	if err != nil {
+		return true
+	}
+
+	return params.memory != h.config.Memory ||
+		params.iterations != h.config.Iterations ||
+		params.parallelism != h.config.Parallelism ||
+		len(params.salt) != int(h.config.SaltLength) ||
+		len(params.key) != int(h.config.KeyLength)
+}
+
+// argon2Params are parameters of an Argon2id hash.
+type argon2Params struct {
+	salt        []byte
+	key         []byte
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+func (p argon2Params) derive(password string, keyLength uint32) []byte {
+	return argon2.IDKey(
+		[]byte(norm.NFKC.String(password)),
+		p.salt,
+		p.iterations,
+		p.memory,
+		p.parallelism,
+		keyLength,
+	)
+}
+
+// String encodes the hash as a PHC string.
+func (p argon2Params) String() string {
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		p.memory,
+		p.iterations,
+		p.parallelism,
+		b64.EncodeToString(p.salt),
+		b64.EncodeToString(p.key),
+	)
+}
+
+// parseArgon2Hash decodes an Argon2id PHC string.
+//
+// The parameters are parsed strictly and bounded, as they are used to
+// derive a key on each verification.
+func parseArgon2Hash(hash string) (argon2Params, error) {
+	var p argon2Params
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return p, ErrMalformedHash
+	}
+
+	version, ok := parsePHCParam(parts[2], "v", math.MaxUint32)
+	if !ok {
+		return p, ErrMalformedHash
+	}
+
+	if version != argon2.Version {
+		return p, fmt.Errorf(
+			"shield/password: unsupported argon2 version %d",
+			version,
+		)
+	}
+
+	params := strings.Split(parts[3], ",")
+	if len(params) != 3 {
+		return p, ErrMalformedHash
+	}
+
+	memory, ok := parsePHCParam(params[0], "m", argon2MaxMemory)
+	if !ok {
+		return p, ErrMalformedHash
+	}
+
+	iterations, ok := parsePHCParam(params[1], "t", argon2MaxIterations)
+	if !ok || iterations == 0 {
+		return p, ErrMalformedHash
+	}
+
+	parallelism, ok := parsePHCParam(params[2], "p", argon2MaxParallelism)
+	if !ok || parallelism == 0 || memory < 8*parallelism {
+		return p, ErrMalformedHash
+	}
+
+	var err error
+
+	if p.salt, err = b64.Strict().DecodeString(parts[4]); err != nil ||
+		len(p.salt) < argon2MinSaltLength || len(p.salt) > argon2MaxSaltLength {
+		return p, ErrMalformedHash
+	}
+
+	if p.key, err = b64.Strict().DecodeString(parts[5]); err != nil ||
+		len(p.key) < argon2MinKeyLength || len(p.key) > argon2MaxKeyLength {
+		return p, ErrMalformedHash
+	}
+
+	p.memory = uint32(memory)          //nolint:gosec // bounded above.
+	p.iterations = uint32(iterations)  //nolint:gosec // bounded above.
+	p.parallelism = uint8(parallelism) //nolint:gosec // bounded above.
+
+	return p, nil
+}
+
+// parsePHCParam parses a "name=value" parameter of a PHC string with
+// a decimal value not greater than maxValue.
+func parsePHCParam(s, name string, maxValue uint64) (uint64, bool) {
+	v, ok := strings.CutPrefix(s, name+"=")
+	if !ok || v == "" || (len(v) > 1 && v[0] == '0') {
+		return 0, false
+	}
+
+	n, err := strconv.ParseUint(v, 10, 32)
+	if err != nil || n > maxValue {
+		return 0, false
+	}
+
+	return n, true
+}
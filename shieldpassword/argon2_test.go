@@ -0,0 +1,78 @@
+package shieldpassword
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArgon2PasswordHasher(t *testing.T) {
+	t.Parallel()
+
+	//nolint:exhaustruct
+	hasher := NewArgon2PasswordHasher(&Argon2Config{Memory: 64, Iterations: 1})
+
+	hash, err := hasher.Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$"))
+
+	ok, err := hasher.Verify(hash, "correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = hasher.Verify(hash, "Tr0ub4dor&3")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// NFKC normalization: the full-width form matches its ASCII equivalent.
+	ok, err = hasher.Verify(hash, "ｃorrect horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = hasher.Verify("$2a$10$invalid", "password")
+	require.ErrorIs(t, err, ErrMalformedHash)
+}
+
+func TestParseArgon2Hash(t *testing.T) {
+	t.Parallel()
+
+	//nolint:exhaustruct
+	hasher := NewArgon2PasswordHasher(&Argon2Config{Memory: 64, Iterations: 1})
+
+	hash, err := hasher.Hash("password")
+	require.NoError(t, err)
+
+	_, err = parseArgon2Hash(hash)
+	require.NoError(t, err)
+
+	parts := strings.Split(hash, "$")
+	withParams := func(version, params string) string {
+		return strings.Join([]string{"", "argon2id", version, params, parts[4], parts[5]}, "$")
+	}
+
+	tests := map[string]string{
+		"trailing junk in params":  withParams("v=19", "m=64,t=1,p=1junk"),
+		"trailing junk in version": withParams("v=19junk", "m=64,t=1,p=1"),
+		"extra param":              withParams("v=19", "m=64,t=1,p=1,x=1"),
+		"reordered params":         withParams("v=19", "t=1,m=64,p=1"),
+		"signed value":             withParams("v=19", "m=+64,t=1,p=1"),
+		"leading zero":             withParams("v=19", "m=064,t=1,p=1"),
+		"memory too large":         withParams("v=19", "m=4194304,t=1,p=1"),
+		"memory too small":         withParams("v=19", "m=8,t=1,p=4"),
+		"too many iterations":      withParams("v=19", "m=64,t=1000000,p=1"),
+		"too many threads":         withParams("v=19", "m=65536,t=1,p=255"),
+		"zero iterations":          withParams("v=19", "m=64,t=0,p=1"),
+		"trailing junk in key":     hash + "$",
+	}
+
+	for name, h := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := parseArgon2Hash(h)
+			assert.ErrorIs(t, err, ErrMalformedHash)
+		})
+	}
+}
@@ -59,3 +59,12 @@ func (h *bcryptPasswordHasher) Verify(
 
 	return true, nil
 }
+
+func (h *bcryptPasswordHasher) NeedsRehash(hashedPassword string) bool {
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	if err != nil {
+		return true
+	}
+
+	return cost != h.cost
+}
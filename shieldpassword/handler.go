@@ -3,9 +3,12 @@ package shieldpassword
 import (
 	"cmp"
 	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"sync"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -27,19 +30,60 @@ var (
 		"shield/password: email already taken",
 	)
 	ErrPasswordIncorrect = errors.New("shield/password: password incorrect")
+
+	// ErrInvalidCredentials is returned on a failed login instead of
+	// shield.ErrUserNotFound and ErrPasswordIncorrect if
+	// Config.EnumerationResistant is set.
+	ErrInvalidCredentials = errors.New("shield/password: invalid credentials")
 )
 
 // Config is the configuration for the password handler.
 type Config[U any] struct {
-	Logger           *slog.Logger
-	PasswordHasher   PasswordHasher
-	PasswordVerifier shieldpasswordverifier.PasswordVerifier
-	Hooker           Hooker[U]
+	Logger         *slog.Logger
+	PasswordHasher PasswordHasher
+
+	// PasswordVerifier verifies the strength of new passwords on
+	// registration and password change.
+	//
+	// If not set, passwords are not verified.
+	PasswordVerifier shieldpasswordverifier.PasswordVerifier // optional
+
+	// PasswordPolicyResolver resolves the password policy of the workspace
+	// set in the context with shieldworkspace.WithWorkspaceID.
+	//
+	// The resolved policy is applied in addition to PasswordVerifier.
+	PasswordPolicyResolver shieldpasswordverifier.PolicyResolver // optional
+
+	// PasswordHistory prevents reuse of recent passwords on password change.
+	PasswordHistory PasswordHistory // optional
+
+	// Lockout configures throttling and lockout after failed logins.
+	//
+	// If not set, failed logins are not tracked.
+	Lockout *LockoutConfig // optional
+
+	// EnumerationResistant makes login failures indistinguishable, so that
+	// attackers can't find out whether an email is registered.
+	//
+	// If set, ErrInvalidCredentials is returned for both unknown users and
+	// incorrect passwords.
+	EnumerationResistant bool // optional
+
+	// EmailVerifier sends an email verification token to newly registered
+	// users, e.g., *shieldemailverification.Handler.
+	//
+	// If not set, no token is sent on registration.
+	EmailVerifier EmailVerifier // optional
+	Hooker        Hooker[U]
 }
 
 func (c *Config[U]) defaults() {
 	c.Logger = cmp.Or(c.Logger, shield.DefaultLogger)
 	c.PasswordHasher = cmp.Or(c.PasswordHasher, DefaultPasswordHasher)
+
+	if c.Lockout != nil {
+		c.Lockout.defaults()
+	}
 }
 
 func (c *Config[U]) assert() {
@@ -61,6 +105,11 @@ type Hooker[U any] interface {
 	OnUserLogin(context.Context, typeid.TypeID, pgx.Tx) (U, error)
 }
 
+// EmailVerifier sends an email verification token to the user.
+type EmailVerifier interface {
+	HandleSendToken(context.Context, typeid.TypeID) error
+}
+
 // NewConfig creates a new config.
 //
 // If no password hasher is configured, the DefaultPasswordHasher will be used.
@@ -85,6 +134,41 @@ func WithPasswordHasher[U any](hasher PasswordHasher) func(*Config[U]) {
 	return func(cfg *Config[U]) { cfg.PasswordHasher = hasher }
 }
 
+// WithPasswordVerifier configures the password verifier.
+func WithPasswordVerifier[U any](
+	verifier shieldpasswordverifier.PasswordVerifier,
+) func(*Config[U]) {
+	return func(cfg *Config[U]) { cfg.PasswordVerifier = verifier }
+}
+
+// WithPasswordPolicyResolver configures the password policy resolver.
+func WithPasswordPolicyResolver[U any](
+	resolver shieldpasswordverifier.PolicyResolver,
+) func(*Config[U]) {
+	return func(cfg *Config[U]) { cfg.PasswordPolicyResolver = resolver }
+}
+
+// WithPasswordHistory configures the password history.
+func WithPasswordHistory[U any](history PasswordHistory) func(*Config[U]) {
+	return func(cfg *Config[U]) { cfg.PasswordHistory = history }
+}
+
+// WithLockout configures throttling and lockout after failed logins.
+func WithLockout[U any](lockout *LockoutConfig) func(*Config[U]) {
+	return func(cfg *Config[U]) { cfg.Lockout = lockout }
+}
+
+// WithEnumerationResistance makes login failures indistinguishable.
+func WithEnumerationResistance[U any]() func(*Config[U]) {
+	return func(cfg *Config[U]) { cfg.EnumerationResistant = true }
+}
+
+// WithEmailVerifier configures sending of an email verification token
+// on registration.
+func WithEmailVerifier[U any](verifier EmailVerifier) func(*Config[U]) {
+	return func(cfg *Config[U]) { cfg.EmailVerifier = verifier }
+}
+
 func WithHooker[U any](hooker Hooker[U]) func(*Config[U]) {
 	return func(cfg *Config[U]) { cfg.Hooker = hooker }
 }
@@ -94,6 +178,10 @@ type Handler[U, S any] struct {
 	config        *Config[U]
 	authenticator shieldsession.Authenticator[U, S]
 	sender        shieldsender.Sender
+
+	// dummyPasswordHash is verified against on a failed user lookup, so
+	// that unknown users take the same time to log in as known ones.
+	dummyPasswordHash func() (string, error)
 }
 
 // It provides functionality to.
@@ -107,6 +195,7 @@ func NewHandler[U, S any](
 		config = NewConfig[U]()
 	}
 
+	config.defaults()
 	config.assert()
 
 	h := Handler[U, S]{
@@ -114,6 +203,9 @@ func NewHandler[U, S any](
 		config:        config,
 		authenticator: authenticator,
 		sender:        sender,
+		dummyPasswordHash: sync.OnceValues(func() (string, error) {
+			return config.PasswordHasher.Hash(rand.Text())
+		}),
 	}
 
 	debug.Assert(h.pool != nil, "Logger must be set")
@@ -127,6 +219,11 @@ func NewHandler[U, S any](
 // The user ID is expected to be provide via a session assigned to a passed ctx context.
 //
 // If no password was previously set for a user a new credential will be created.
+//
+// If the new password doesn't pass Config.PasswordVerifier or the resolved
+// password policy, the verifier error is returned, e.g.,
+// *shieldpasswordverifier.PasswordVerificationError. If it matches one of
+// the recent passwords, ErrPasswordReused is returned.
 func (h *Handler[_, S]) HandleChangeUserPassword(
 	ctx context.Context,
 	oldPassword, newPassword string,
@@ -139,9 +236,19 @@ func (h *Handler[_, S]) HandleChangeUserPassword(
 		)
 	}
 
-	// Make sure that the password hashing is performed outside of the transaction
-	// as it is an expensive operation.
-	passwordHash, err := h.config.PasswordHasher.Hash(newPassword)
+	policy, err := ResolvePasswordPolicy(ctx, h.config.PasswordPolicyResolver)
+	if err != nil {
+		return err
+	}
+
+	passwordHash, err := h.checkPasswordChange(ctx, policy, sess.UserID, oldPassword, newPassword)
+	if err != nil {
+		return err
+	}
+
+	// The new password is hashed outside of the transaction, so that
+	// the expensive hashing doesn't hold a connection and row locks.
+	newPasswordHash, err := h.config.PasswordHasher.Hash(newPassword)
 	if err != nil {
 		return fmt.Errorf(
 			"shield/password: failed to hash password: %w",
@@ -160,7 +267,7 @@ func (h *Handler[_, S]) HandleChangeUserPassword(
 	defer func() { _ = tx.Rollback(ctx) }()
 
 	dbUser, err := dbsqlc.New().
-		FindUserWithPasswordCredentialByUserID(ctx, tx, sess.UserID)
+		FindUserWithPasswordCredentialByUserIDForUpdate(ctx, tx, sess.UserID)
 	if err != nil {
 		return fmt.Errorf(
 			"shield/password: failed to retrieve users credentials: %w",
@@ -168,33 +275,42 @@ func (h *Handler[_, S]) HandleChangeUserPassword(
 		)
 	}
 
-	if dbUser.PasswordHash == nil && oldPassword == "" {
-		if err := dbsqlc.New().UpsertPasswordCredentialByUserID(ctx, tx, dbsqlc.UpsertPasswordCredentialByUserIDParams{
-			ID:                   tid.MustCredentialID(),
-			UserID:               dbUser.ID,
-			UserCredentialKey:    dbUser.Email,
-			UserCredentialSecret: passwordHash,
-		}); err != nil {
-			return fmt.Errorf(
-				"shield/password: failed to create user credential: %w",
-				err,
-			)
-		}
+	// The password has been changed concurrently, so oldPassword has been
+	// checked against a stale hash.
+	if pointer.ToValue(dbUser.PasswordHash, "") != pointer.ToValue(passwordHash, "") {
+		d("password changed concurrently")
+		return ErrPasswordIncorrect
+	}
 
+	hasPassword := dbUser.PasswordHash != nil
+
+	if err := dbsqlc.New().UpsertPasswordCredentialByUserID(ctx, tx, dbsqlc.UpsertPasswordCredentialByUserIDParams{
+		ID:                   tid.MustCredentialID(),
+		UserID:               dbUser.ID,
+		UserCredentialKey:    dbUser.Email,
+		UserCredentialSecret: newPasswordHash,
+	}); err != nil {
+		return fmt.Errorf(
+			"shield/password: failed to update user credential: %w",
+			err,
+		)
+	}
+
+	if hasPassword {
+		if err := h.config.PasswordHistory.RecordInTx(
+			ctx,
+			tx,
+			policy,
+			dbUser.ID,
+			pointer.ToValue(dbUser.PasswordHash, ""),
+		); err != nil {
+			return err
+		}
+	} else {
 		d(
 			"created a new user password credential for the user with ID: %v",
 			dbUser.ID,
 		)
-	} else {
-		ok, err := h.config.PasswordHasher.Verify(pointer.ToValue(dbUser.PasswordHash, ""), oldPassword)
-		if err != nil {
-			return fmt.Errorf("shield/password: failed to verify password: %w", err)
-		}
-
-		if !ok {
-			d("password mismatch")
-			return ErrPasswordIncorrect
-		}
 	}
 
 	err = h.authenticator.ExpireSessions(ctx, tx)
@@ -221,6 +337,86 @@ func (h *Handler[_, S]) HandleChangeUserPassword(
 	return nil
 }
 
+// checkPasswordChange checks that the user with the given userID may change
+// the password from oldPassword to newPassword, and returns the user's current
+// password hash, or nil if the user has no password.
+//
+// The checks run in a read-only transaction, so that the slow hash
+// verifications don't hold row locks.
+func (h *Handler[_, S]) checkPasswordChange(
+	ctx context.Context,
+	policy *shieldpasswordverifier.Policy,
+	userID typeid.TypeID,
+	oldPassword, newPassword string,
+) (*string, error) {
+	//nolint:exhaustruct
+	tx, err := h.pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf(
+			"shield/password: failed to begin transaction: %w",
+			err,
+		)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	dbUser, err := dbsqlc.New().
+		FindUserWithPasswordCredentialByUserID(ctx, tx, userID)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"shield/password: failed to retrieve users credentials: %w",
+			err,
+		)
+	}
+
+	if err := VerifyPassword(
+		ctx,
+		h.config.PasswordVerifier,
+		policy,
+		newPassword,
+		dbUser.Email,
+	); err != nil {
+		return nil, err
+	}
+
+	if dbUser.PasswordHash == nil && oldPassword == "" {
+		return nil, nil
+	}
+
+	ok, err := h.config.PasswordHasher.Verify(pointer.ToValue(dbUser.PasswordHash, ""), oldPassword)
+	if err != nil {
+		return nil, fmt.Errorf("shield/password: failed to verify password: %w", err)
+	}
+
+	if !ok {
+		d("password mismatch")
+		return nil, ErrPasswordIncorrect
+	}
+
+	if err := h.config.PasswordHistory.CheckInTx(
+		ctx,
+		tx,
+		h.config.PasswordHasher,
+		policy,
+		dbUser.ID,
+		dbUser.PasswordHash,
+		newPassword,
+	); err != nil {
+		return nil, err
+	}
+
+	return dbUser.PasswordHash, nil
+}
+
+// HandleUserRegistration registers a new user with the given email and
+// password.
+//
+// If the password doesn't pass Config.PasswordVerifier or the resolved
+// password policy, the verifier error is returned, e.g.,
+// *shieldpasswordverifier.PasswordVerificationError.
+//
+// If Config.EmailVerifier is set, an email verification token is sent to
+// the registered user.
 func (h *Handler[U, _]) HandleUserRegistration(
 	ctx context.Context,
 	email, password string,
@@ -232,6 +428,10 @@ func (h *Handler[U, _]) HandleUserRegistration(
 		return user, shield.ErrAuthenticatedUser
 	}
 
+	if err := h.verifyPassword(ctx, password, email); err != nil {
+		return user, err
+	}
+
 	// Make sure that the password hashing is performed outside of the transaction
 	// as it is an expensive operation.
 	passwordHash, err := h.config.PasswordHasher.Hash(password)
@@ -283,12 +483,34 @@ func (h *Handler[U, _]) HandleUserRegistration(
 		)
 	}
 
+	h.sendEmailVerificationToken(ctx, userID)
+
 	user.ID = userID
 	user.T = &payload
 
 	return user, nil
 }
 
+// sendEmailVerificationToken sends an email verification token to the newly
+// registered user, if Config.EmailVerifier is set.
+//
+// The user is already registered at this point, so a failure is only
+// logged and the user can request another token later.
+func (h *Handler[_, _]) sendEmailVerificationToken(ctx context.Context, userID typeid.TypeID) {
+	if h.config.EmailVerifier == nil {
+		return
+	}
+
+	if err := h.config.EmailVerifier.HandleSendToken(ctx, userID); err != nil {
+		h.config.Logger.ErrorContext(
+			ctx,
+			"Failed to send email verification token",
+			slog.String("user_id", userID.String()),
+			slog.Any("error", err),
+		)
+	}
+}
+
 func (h *Handler[U, _]) handleUserRegistrationTx(
 	ctx context.Context,
 	email, passwordHash string,
@@ -326,6 +548,17 @@ func (h *Handler[U, _]) handleUserRegistrationTx(
 	return uid, nil
 }
 
+// HandleUserLogin logs in the user with the given email and password.
+//
+// If the user is not found, the password is verified against a dummy hash,
+// so that the response time doesn't reveal whether the email is registered.
+// With Config.EnumerationResistant set, ErrInvalidCredentials is returned
+// instead of shield.ErrUserNotFound and ErrPasswordIncorrect.
+//
+// If Config.Lockout is set, failed attempts are tracked per email and
+// client IP and, once the thresholds are reached, a *LockedError wrapping
+// ErrAccountLocked or ErrLoginThrottled is returned until the lock expires.
+// Unknown emails are locked the same way as registered ones.
 func (h *Handler[U, _]) HandleUserLogin(
 	ctx context.Context,
 	email, password string,
@@ -337,6 +570,13 @@ func (h *Handler[U, _]) HandleUserLogin(
 		return user, shield.ErrAuthenticatedUser
 	}
 
+	userSubjects := h.userThrottleSubjects(email)
+	subjects := slices.Concat(userSubjects, h.ipThrottleSubjects(ctx))
+
+	if err := h.checkLockout(ctx, subjects); err != nil {
+		return user, err
+	}
+
 	tx, err := h.pool.Begin(ctx)
 	if err != nil {
 		return user, fmt.Errorf(
@@ -354,7 +594,10 @@ func (h *Handler[U, _]) HandleUserLogin(
 	)
 	if err != nil {
 		if dbsql.IsNotFoundError(err) {
-			return user, shield.ErrUserNotFound
+			d("user not found")
+			h.recordLoginFailure(ctx, subjects)
+
+			return user, h.userNotFound(password)
 		}
 
 		return user, fmt.Errorf(
@@ -366,7 +609,9 @@ func (h *Handler[U, _]) HandleUserLogin(
 	// Treat the empty password as a non-existing user/credential.
 	if dbUser.PasswordHash == "" {
 		d("empty password in db")
-		return user, shield.ErrUserNotFound
+		h.recordLoginFailure(ctx, subjects)
+
+		return user, h.userNotFound(password)
 	}
 
 	// An entry point for hooking the user login process.
@@ -402,11 +647,109 @@ func (h *Handler[U, _]) HandleUserLogin(
 
 	if !ok {
 		d("password mismatch")
+		h.recordLoginFailure(ctx, subjects)
+
+		if h.config.EnumerationResistant {
+			return user, ErrInvalidCredentials
+		}
+
 		return user, ErrPasswordIncorrect
 	}
 
+	// Only failures of the user are reset, failures of the client IP age out
+	// with the throttle window, so that logging into an own account doesn't
+	// reset throttling of credential stuffing.
+	if err := h.resetLoginFailures(ctx, userSubjects); err != nil {
+		return user, err
+	}
+
+	if h.config.PasswordHasher.NeedsRehash(dbUser.PasswordHash) {
+		h.rehashPassword(ctx, dbUser.ID, dbUser.PasswordHash, password)
+	}
+
 	user.ID = dbUser.ID
 	user.T = &payload
 
 	return user, nil
 }
+
+// userNotFound verifies password against a dummy hash to make the failed
+// lookup take as long as a password verification and returns the login
+// error.
+func (h *Handler[_, _]) userNotFound(password string) error {
+	if dummyHash, err := h.dummyPasswordHash(); err == nil {
+		_, _ = h.config.PasswordHasher.Verify(dummyHash, password)
+	}
+
+	if h.config.EnumerationResistant {
+		return ErrInvalidCredentials
+	}
+
+	return shield.ErrUserNotFound
+}
+
+// verifyPassword checks the strength of a new password of the user with
+// the given email with the configured password verifier and policy.
+func (h *Handler[_, _]) verifyPassword(
+	ctx context.Context,
+	password, email string,
+) error {
+	policy, err := ResolvePasswordPolicy(ctx, h.config.PasswordPolicyResolver)
+	if err != nil {
+		return err
+	}
+
+	return VerifyPassword(
+		ctx,
+		h.config.PasswordVerifier,
+		policy,
+		password,
+		email,
+	)
+}
+
+// rehashPassword upgrades the outdated password hash of the user with
+// the given userID.
+//
+// The login is not failed if the upgrade fails, as the password has already
+// been verified.
+func (h *Handler[_, _]) rehashPassword(
+	ctx context.Context,
+	userID typeid.TypeID,
+	oldPasswordHash, password string,
+) {
+	passwordHash, err := h.config.PasswordHasher.Hash(password)
+	if err != nil {
+		h.config.Logger.ErrorContext(
+			ctx,
+			"Failed to re-hash password",
+			slog.String("user_id", userID.String()),
+			slog.Any("error", err),
+		)
+
+		return
+	}
+
+	// The hash is only replaced if it hasn't been changed concurrently.
+	n, err := dbsqlc.New().UpdatePasswordCredentialSecretByUserID(
+		ctx,
+		h.pool,
+		dbsqlc.UpdatePasswordCredentialSecretByUserIDParams{
+			NewUserCredentialSecret: passwordHash,
+			UserID:                  userID,
+			OldUserCredentialSecret: oldPasswordHash,
+		},
+	)
+	if err != nil {
+		h.config.Logger.ErrorContext(
+			ctx,
+			"Failed to update re-hashed password",
+			slog.String("user_id", userID.String()),
+			slog.Any("error", err),
+		)
+
+		return
+	}
+
+	d("re-hashed password for user=%v, updated=%d", userID, n)
+}
@@ -0,0 +1,152 @@
+package shieldpassword
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/jackc/pgx/v5"
+	"go.jetify.com/typeid/v2"
+
+	"go.inout.gg/shield/internal/dbsqlc"
+	"go.inout.gg/shield/internal/tid"
+	"go.inout.gg/shield/shieldpasswordverifier"
+)
+
+// ErrPasswordReused is returned when the new password matches one of
+// the user's recent passwords.
+var ErrPasswordReused = errors.New("shield/password: password was used recently")
+
+// PasswordHistory prevents users from reusing their recent passwords.
+//
+// The current password hash is stored in the user credential, previous
+// hashes are kept in the password history table.
+type PasswordHistory struct {
+	// Size is the number of the user's last passwords, including the current
+	// one, that cannot be reused. If zero, passwords can be reused.
+	//
+	// A non-zero Policy.HistorySize of the resolved password policy takes
+	// precedence over Size.
+	Size int // optional
+
+	// Retention is the number of previous password hashes kept per user,
+	// older hashes are pruned when the password is changed.
+	//
+	// If zero, only the hashes needed to enforce Size are kept. If negative,
+	// the history is never pruned.
+	Retention int // optional
+}
+
+// size returns the history size to enforce under the policy.
+func (h PasswordHistory) size(policy *shieldpasswordverifier.Policy) int {
+	if policy != nil && policy.HistorySize > 0 {
+		return policy.HistorySize
+	}
+
+	return max(h.Size, 0)
+}
+
+// CheckInTx returns ErrPasswordReused if password matches the user's
+// currentPasswordHash or any of the previous hashes within the history size.
+func (h PasswordHistory) CheckInTx(
+	ctx context.Context,
+	tx pgx.Tx,
+	hasher PasswordHasher,
+	policy *shieldpasswordverifier.Policy,
+	userID typeid.TypeID,
+	currentPasswordHash *string,
+	password string,
+) error {
+	size := h.size(policy)
+	if size == 0 {
+		return nil
+	}
+
+	var hashes []string
+	if currentPasswordHash != nil {
+		hashes = append(hashes, *currentPasswordHash)
+	}
+
+	if previous := size - len(hashes); previous > 0 {
+		previousHashes, err := dbsqlc.New().FindRecentUserPasswordHistoryHashes(
+			ctx,
+			tx,
+			dbsqlc.FindRecentUserPasswordHistoryHashesParams{
+				UserID: userID,
+				Size:   int32(min(previous, math.MaxInt32)), //nolint:gosec
+			},
+		)
+		if err != nil {
+			return fmt.Errorf(
+				"shield/password: failed to find password history: %w",
+				err,
+			)
+		}
+
+		hashes = append(hashes, previousHashes...)
+	}
+
+	for _, hash := range hashes {
+		ok, err := hasher.Verify(hash, password)
+		if err != nil {
+			return fmt.Errorf(
+				"shield/password: failed to verify password history: %w",
+				err,
+			)
+		}
+
+		if ok {
+			return ErrPasswordReused
+		}
+	}
+
+	return nil
+}
+
+// RecordInTx records the replaced passwordHash of the user in the history
+// and prunes the history according to Retention.
+func (h PasswordHistory) RecordInTx(
+	ctx context.Context,
+	tx pgx.Tx,
+	policy *shieldpasswordverifier.Policy,
+	userID typeid.TypeID,
+	passwordHash string,
+) error {
+	retention := h.Retention
+	if retention == 0 {
+		// The current password is stored in the credential.
+		retention = max(h.size(policy)-1, 0)
+	}
+
+	if retention == 0 {
+		return nil
+	}
+
+	if err := dbsqlc.New().CreateUserPasswordHistory(ctx, tx, dbsqlc.CreateUserPasswordHistoryParams{
+		ID:           tid.MustPasswordHistoryID(),
+		UserID:       userID,
+		PasswordHash: passwordHash,
+	}); err != nil {
+		return fmt.Errorf(
+			"shield/password: failed to record password history: %w",
+			err,
+		)
+	}
+
+	if retention < 0 {
+		return nil
+	}
+
+	if _, err := dbsqlc.New().PruneUserPasswordHistory(ctx, tx, dbsqlc.PruneUserPasswordHistoryParams{
+		UserID:    userID,
+		Retention: int32(min(retention, math.MaxInt32)), //nolint:gosec
+	}); err != nil {
+		return fmt.Errorf(
+			"shield/password: failed to prune password history: %w",
+			err,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package shieldpassword
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"go.inout.gg/shield/internal/dbsqlc"
+	"go.inout.gg/shield/internal/testutil"
+)
+
+func TestPasswordHistoryRecordInTx(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		history PasswordHistory
+		want    int
+	}{
+		//nolint:exhaustruct
+		"zero config keeps nothing": {PasswordHistory{}, 0},
+		//nolint:exhaustruct
+		"size of one keeps nothing": {PasswordHistory{Size: 1}, 0},
+		//nolint:exhaustruct
+		"size keeps previous hashes": {PasswordHistory{Size: 3}, 2},
+		"retention overrides size":   {PasswordHistory{Size: 3, Retention: 4}, 4},
+		//nolint:exhaustruct
+		"negative retention keeps all": {PasswordHistory{Retention: -1}, 5},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			pool := testutil.NewPool(t)
+			user := testutil.CreateUser(t, pool, testutil.Email(), true)
+
+			for i := range 5 {
+				tx, err := pool.Begin(t.Context())
+				require.NoError(t, err)
+				require.NoError(t, tt.history.RecordInTx(t.Context(), tx, nil, user.ID, fmt.Sprintf("hash %d", i)))
+				require.NoError(t, tx.Commit(t.Context()))
+			}
+
+			hashes, err := dbsqlc.New().FindRecentUserPasswordHistoryHashes(
+				t.Context(),
+				pool,
+				dbsqlc.FindRecentUserPasswordHistoryHashesParams{UserID: user.ID, Size: 10},
+			)
+			require.NoError(t, err)
+			assert.Len(t, hashes, tt.want)
+		})
+	}
+}
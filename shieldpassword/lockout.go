@@ -0,0 +1,406 @@
+package shieldpassword
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"go.inout.gg/foundations/dbsql"
+	"go.jetify.com/typeid/v2"
+
+	"go.inout.gg/shield"
+	"go.inout.gg/shield/internal/dbsqlc"
+	"go.inout.gg/shield/internal/tid"
+)
+
+const (
+	throttleKindUser = "user"
+	throttleKindIP   = "ip"
+)
+
+var (
+	// ErrAccountLocked is returned when logging in is temporarily blocked
+	// after too many failed attempts.
+	//
+	// The returned error is a *LockedError carrying the time after which
+	// the login can be retried.
+	ErrAccountLocked = errors.New("shield/password: account locked")
+
+	// ErrLoginThrottled is returned when logging in is delayed due to
+	// progressive back-off after failed attempts.
+	//
+	// The returned error is a *LockedError carrying the time after which
+	// the login can be retried.
+	ErrLoginThrottled = errors.New("shield/password: login throttled")
+)
+
+var _ error = (*LockedError)(nil)
+
+// LockedError is returned when logging in is blocked after failed attempts.
+//
+// It wraps either ErrAccountLocked or ErrLoginThrottled.
+type LockedError struct {
+	// RetryAfter is the time after which the login can be retried.
+	RetryAfter time.Time
+
+	err error
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", e.err, e.RetryAfter.Format(time.RFC3339))
+}
+
+func (e *LockedError) Unwrap() error { return e.err }
+
+//nolint:gochecknoglobals
+var (
+	// DefaultUserThrottle is the default throttle of failed logins per user.
+	DefaultUserThrottle = ThrottleConfig{
+		Window:           time.Hour,
+		DelayThreshold:   3,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Minute,
+		LockoutThreshold: 10,
+		LockoutDuration:  15 * time.Minute,
+	}
+
+	// DefaultIPThrottle is the default throttle of failed logins per
+	// client IP.
+	DefaultIPThrottle = ThrottleConfig{
+		Window:           time.Hour,
+		DelayThreshold:   10,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Minute,
+		LockoutThreshold: 100,
+		LockoutDuration:  time.Hour,
+	}
+)
+
+// ThrottleConfig configures throttling of failed logins.
+//
+// After DelayThreshold failures each next attempt is delayed by an
+// exponentially growing delay, starting at BaseDelay and capped at MaxDelay.
+// After LockoutThreshold failures the login is locked for LockoutDuration.
+//
+// Zero fields are set to defaults, negative thresholds disable
+// the corresponding feature.
+type ThrottleConfig struct {
+	// Window is the duration after which failures are forgotten.
+	Window time.Duration // optional
+
+	BaseDelay       time.Duration // optional
+	MaxDelay        time.Duration // optional
+	LockoutDuration time.Duration // optional
+
+	DelayThreshold   int // optional
+	LockoutThreshold int // optional
+}
+
+func (c *ThrottleConfig) defaults(d ThrottleConfig) {
+	c.Window = cmp.Or(c.Window, d.Window)
+	c.BaseDelay = cmp.Or(c.BaseDelay, d.BaseDelay)
+	c.MaxDelay = cmp.Or(c.MaxDelay, d.MaxDelay)
+	c.LockoutDuration = cmp.Or(c.LockoutDuration, d.LockoutDuration)
+	c.DelayThreshold = cmp.Or(c.DelayThreshold, d.DelayThreshold)
+	c.LockoutThreshold = cmp.Or(c.LockoutThreshold, d.LockoutThreshold)
+}
+
+// isLockedOut reports whether the number of failures reaches the lockout.
+func (c *ThrottleConfig) isLockedOut(failures int) bool {
+	return c.LockoutThreshold > 0 && failures >= c.LockoutThreshold
+}
+
+// lockedUntil returns the time the login is blocked until after the given
+// number of failures, or a zero time if it's not blocked.
+func (c *ThrottleConfig) lockedUntil(failures int, now time.Time) time.Time {
+	if c.isLockedOut(failures) {
+		return now.Add(c.LockoutDuration)
+	}
+
+	if c.DelayThreshold > 0 && failures >= c.DelayThreshold {
+		exp := min(failures-c.DelayThreshold, 32)
+		delay := min(
+			time.Duration(float64(c.BaseDelay)*math.Pow(2, float64(exp))),
+			c.MaxDelay,
+		)
+
+		return now.Add(delay)
+	}
+
+	return time.Time{}
+}
+
+// LockoutConfig configures tracking of failed logins.
+//
+// Failures are tracked per login email and, if the client IP is provided
+// with WithClientIP, per client IP. Emails are tracked whether they are
+// registered or not, so that lockouts don't reveal registered emails.
+type LockoutConfig struct {
+	User ThrottleConfig // optional
+	IP   ThrottleConfig // optional
+}
+
+func (c *LockoutConfig) defaults() {
+	c.User.defaults(DefaultUserThrottle)
+	c.IP.defaults(DefaultIPThrottle)
+}
+
+type clientIPCtxKey struct{}
+
+// WithClientIP returns a copy of ctx carrying the IP address of the client,
+// used to track failed logins per IP.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPCtxKey{}, ip)
+}
+
+func clientIPFromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(clientIPCtxKey{}).(string)
+	return ip, ok && ip != ""
+}
+
+// throttleSubject is a subject failed logins are tracked for.
+type throttleSubject struct {
+	config  *ThrottleConfig
+	kind    string
+	subject string
+}
+
+// userThrottleSubjects returns the subjects to track failed logins with
+// the given email.
+func (h *Handler[_, _]) userThrottleSubjects(email string) []throttleSubject {
+	if h.config.Lockout == nil {
+		return nil
+	}
+
+	return []throttleSubject{{
+		config:  &h.config.Lockout.User,
+		kind:    throttleKindUser,
+		subject: normalizeThrottleEmail(email),
+	}}
+}
+
+// normalizeThrottleEmail normalizes email, so that variations of the same
+// email share failed logins.
+func normalizeThrottleEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// ipThrottleSubjects returns the subjects to track failed logins of
+// the client IP set in ctx with WithClientIP.
+func (h *Handler[_, _]) ipThrottleSubjects(ctx context.Context) []throttleSubject {
+	if h.config.Lockout == nil {
+		return nil
+	}
+
+	ip, ok := clientIPFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	return []throttleSubject{{
+		config:  &h.config.Lockout.IP,
+		kind:    throttleKindIP,
+		subject: ip,
+	}}
+}
+
+// checkLockout returns a *LockedError if logging in is blocked for any of
+// the subjects.
+func (h *Handler[_, _]) checkLockout(
+	ctx context.Context,
+	subjects []throttleSubject,
+) error {
+	now := time.Now()
+
+	for _, s := range subjects {
+		throttle, err := dbsqlc.New().FindLoginThrottle(ctx, h.pool, dbsqlc.FindLoginThrottleParams{
+			Kind:    s.kind,
+			Subject: s.subject,
+		})
+		if err != nil {
+			if dbsql.IsNotFoundError(err) {
+				continue
+			}
+
+			return fmt.Errorf(
+				"shield/password: failed to find login throttle: %w",
+				err,
+			)
+		}
+
+		if throttle.LockedUntil == nil || !throttle.LockedUntil.After(now) {
+			continue
+		}
+
+		lockErr := ErrLoginThrottled
+		if s.config.isLockedOut(int(throttle.Failures)) {
+			lockErr = ErrAccountLocked
+		}
+
+		return &LockedError{RetryAfter: *throttle.LockedUntil, err: lockErr}
+	}
+
+	return nil
+}
+
+// recordLoginFailure records a failed login for the subjects and blocks
+// further logins once thresholds are reached.
+//
+// Errors are logged rather than returned, so that they don't mask
+// the login failure.
+func (h *Handler[_, _]) recordLoginFailure(
+	ctx context.Context,
+	subjects []throttleSubject,
+) {
+	if err := h.recordLoginFailureErr(ctx, subjects); err != nil {
+		h.config.Logger.ErrorContext(
+			ctx,
+			"Failed to record login failure",
+			slog.Any("error", err),
+		)
+	}
+}
+
+func (h *Handler[_, _]) recordLoginFailureErr(
+	ctx context.Context,
+	subjects []throttleSubject,
+) error {
+	now := time.Now()
+
+	for _, s := range subjects {
+		failures, err := dbsqlc.New().RecordLoginFailure(ctx, h.pool, dbsqlc.RecordLoginFailureParams{
+			ID:            tid.MustLoginThrottleID(),
+			Kind:          s.kind,
+			Subject:       s.subject,
+			WindowSeconds: int32(min(s.config.Window.Seconds(), math.MaxInt32)),
+		})
+		if err != nil {
+			return fmt.Errorf(
+				"shield/password: failed to record login failure: %w",
+				err,
+			)
+		}
+
+		lockedUntil := s.config.lockedUntil(int(failures), now)
+		if lockedUntil.IsZero() {
+			continue
+		}
+
+		d("blocking logins for %s %s until %v", s.kind, s.subject, lockedUntil)
+
+		if err := dbsqlc.New().LockLoginThrottle(ctx, h.pool, dbsqlc.LockLoginThrottleParams{
+			LockedUntil: &lockedUntil,
+			Kind:        s.kind,
+			Subject:     s.subject,
+		}); err != nil {
+			return fmt.Errorf(
+				"shield/password: failed to lock login throttle: %w",
+				err,
+			)
+		}
+	}
+
+	return nil
+}
+
+// resetLoginFailures resets failed logins of the subjects.
+func (h *Handler[_, _]) resetLoginFailures(
+	ctx context.Context,
+	subjects []throttleSubject,
+) error {
+	for _, s := range subjects {
+		if err := dbsqlc.New().DeleteLoginThrottle(ctx, h.pool, dbsqlc.DeleteLoginThrottleParams{
+			Kind:    s.kind,
+			Subject: s.subject,
+		}); err != nil {
+			return fmt.Errorf(
+				"shield/password: failed to reset login throttle: %w",
+				err,
+			)
+		}
+	}
+
+	return nil
+}
+
+// HandleUnlockUser removes the lockout and resets failed logins of the user
+// with the given userID.
+//
+// It's intended to be used by administrators.
+func (h *Handler[_, _]) HandleUnlockUser(
+	ctx context.Context,
+	userID typeid.TypeID,
+) error {
+	user, err := dbsqlc.New().FindUserByID(ctx, h.pool, userID)
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			return shield.ErrUserNotFound
+		}
+
+		return fmt.Errorf(
+			"shield/password: failed to find user: %w",
+			err,
+		)
+	}
+
+	if err := dbsqlc.New().DeleteLoginThrottle(ctx, h.pool, dbsqlc.DeleteLoginThrottleParams{
+		Kind:    throttleKindUser,
+		Subject: normalizeThrottleEmail(user.Email),
+	}); err != nil {
+		return fmt.Errorf(
+			"shield/password: failed to unlock user: %w",
+			err,
+		)
+	}
+
+	return nil
+}
+
+// HandleUnlockIP removes the lockout and resets failed logins of the client
+// IP address.
+//
+// It's intended to be used by administrators.
+func (h *Handler[_, _]) HandleUnlockIP(ctx context.Context, ip string) error {
+	if err := dbsqlc.New().DeleteLoginThrottle(ctx, h.pool, dbsqlc.DeleteLoginThrottleParams{
+		Kind:    throttleKindIP,
+		Subject: ip,
+	}); err != nil {
+		return fmt.Errorf(
+			"shield/password: failed to unlock IP: %w",
+			err,
+		)
+	}
+
+	return nil
+}
+
+// HandlePruneLoginThrottles deletes failed login records that are no longer
+// relevant, i.e., older than the throttle window and not locked.
+//
+// It's intended to be run periodically.
+func (h *Handler[_, _]) HandlePruneLoginThrottles(ctx context.Context) (int64, error) {
+	if h.config.Lockout == nil {
+		return 0, nil
+	}
+
+	window := max(h.config.Lockout.User.Window, h.config.Lockout.IP.Window)
+
+	n, err := dbsqlc.New().DeleteStaleLoginThrottles(
+		ctx,
+		h.pool,
+		int32(min(window.Seconds(), math.MaxInt32)),
+	)
+	if err != nil {
+		return 0, fmt.Errorf(
+			"shield/password: failed to prune login throttles: %w",
+			err,
+		)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,191 @@
+package shieldpassword
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.inout.gg/foundations/dbsql"
+	"go.inout.gg/foundations/must"
+
+	"go.inout.gg/shield"
+	"go.inout.gg/shield/internal/dbsqlc"
+	"go.inout.gg/shield/internal/testutil"
+	"go.inout.gg/shield/internal/tid"
+)
+
+func TestThrottleConfigLockedUntil(t *testing.T) {
+	t.Parallel()
+
+	//nolint:exhaustruct
+	config := ThrottleConfig{}
+	config.defaults(DefaultUserThrottle)
+
+	now := time.Now()
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{6, 8 * time.Second},
+		{9, time.Minute},
+		{10, 15 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		got := config.lockedUntil(tt.failures, now)
+
+		var delay time.Duration
+		if !got.IsZero() {
+			delay = got.Sub(now)
+		}
+
+		assert.Equal(t, tt.want, delay, "failures: %d", tt.failures)
+	}
+}
+
+func TestLockedError(t *testing.T) {
+	t.Parallel()
+
+	err := error(&LockedError{RetryAfter: time.Now(), err: ErrAccountLocked})
+	require.ErrorIs(t, err, ErrAccountLocked)
+	assert.NotErrorIs(t, err, ErrLoginThrottled)
+}
+
+// newLockoutHandler returns a handler throttling emails with the given
+// config and tracking client IPs without blocking them.
+func newLockoutHandler(t *testing.T, user ThrottleConfig) *Handler[struct{}, struct{}] {
+	t.Helper()
+
+	//nolint:exhaustruct
+	lockout := &LockoutConfig{
+		User: user,
+		IP:   ThrottleConfig{DelayThreshold: -1, LockoutThreshold: -1},
+	}
+
+	//nolint:exhaustruct
+	hasher := NewArgon2PasswordHasher(&Argon2Config{Memory: 64, Iterations: 1})
+
+	return NewHandler[struct{}, struct{}](
+		testutil.NewPool(t),
+		nil,
+		nil,
+		NewConfig(
+			WithPasswordHasher[struct{}](hasher),
+			WithLockout[struct{}](lockout),
+		),
+	)
+}
+
+func TestLockout(t *testing.T) {
+	t.Parallel()
+
+	t.Run("failures throttle and then lock the email", func(t *testing.T) {
+		t.Parallel()
+
+		//nolint:exhaustruct
+		h := newLockoutHandler(t, ThrottleConfig{DelayThreshold: 2, LockoutThreshold: 3})
+		subjects := h.userThrottleSubjects(testutil.Email())
+
+		require.NoError(t, h.recordLoginFailureErr(t.Context(), subjects))
+		require.NoError(t, h.checkLockout(t.Context(), subjects))
+
+		require.NoError(t, h.recordLoginFailureErr(t.Context(), subjects))
+
+		var lockErr *LockedError
+		require.ErrorAs(t, h.checkLockout(t.Context(), subjects), &lockErr)
+		require.ErrorIs(t, lockErr, ErrLoginThrottled)
+		assert.WithinDuration(t, time.Now().Add(time.Second), lockErr.RetryAfter, time.Second)
+
+		require.NoError(t, h.recordLoginFailureErr(t.Context(), subjects))
+
+		require.ErrorAs(t, h.checkLockout(t.Context(), subjects), &lockErr)
+		require.ErrorIs(t, lockErr, ErrAccountLocked)
+	})
+
+	t.Run("unknown emails are locked like registered ones", func(t *testing.T) {
+		t.Parallel()
+
+		//nolint:exhaustruct
+		h := newLockoutHandler(t, ThrottleConfig{DelayThreshold: -1, LockoutThreshold: 3})
+		pool := h.pool
+
+		registered := testutil.Email()
+		user := testutil.CreateUser(t, pool, registered, true)
+		testutil.CreatePassword(t, pool, user, must.Must(h.config.PasswordHasher.Hash("password")))
+
+		for _, email := range []string{registered, testutil.Email()} {
+			for range 3 {
+				_, err := h.HandleUserLogin(t.Context(), email, "incorrect")
+				require.Error(t, err)
+			}
+
+			var lockErr *LockedError
+
+			_, err := h.HandleUserLogin(t.Context(), email, "password")
+			require.ErrorAs(t, err, &lockErr, email)
+			require.ErrorIs(t, err, ErrAccountLocked, email)
+		}
+	})
+
+	t.Run("successful login resets only user failures", func(t *testing.T) {
+		t.Parallel()
+
+		//nolint:exhaustruct
+		h := newLockoutHandler(t, ThrottleConfig{DelayThreshold: -1, LockoutThreshold: 3})
+		pool := h.pool
+
+		email := testutil.Email()
+		user := testutil.CreateUser(t, pool, email, true)
+		testutil.CreatePassword(t, pool, user, must.Must(h.config.PasswordHasher.Hash("password")))
+
+		ip := tid.MustLoginThrottleID().String()
+		ctx := WithClientIP(t.Context(), ip)
+
+		_, err := h.HandleUserLogin(ctx, email, "incorrect")
+		require.ErrorIs(t, err, ErrPasswordIncorrect)
+
+		_, err = h.HandleUserLogin(ctx, email, "password")
+		require.NoError(t, err)
+
+		_, err = dbsqlc.New().FindLoginThrottle(ctx, pool, dbsqlc.FindLoginThrottleParams{
+			Kind:    throttleKindUser,
+			Subject: email,
+		})
+		assert.True(t, dbsql.IsNotFoundError(err), "user failures must be reset")
+
+		throttle, err := dbsqlc.New().FindLoginThrottle(ctx, pool, dbsqlc.FindLoginThrottleParams{
+			Kind:    throttleKindIP,
+			Subject: ip,
+		})
+		require.NoError(t, err, "IP failures must be kept")
+		assert.Equal(t, int32(1), throttle.Failures)
+	})
+
+	t.Run("HandleUnlockUser removes the lockout", func(t *testing.T) {
+		t.Parallel()
+
+		//nolint:exhaustruct
+		h := newLockoutHandler(t, ThrottleConfig{DelayThreshold: -1, LockoutThreshold: 3})
+
+		email := testutil.Email()
+		user := testutil.CreateUser(t, h.pool, email, true)
+		subjects := h.userThrottleSubjects(email)
+
+		for range 3 {
+			require.NoError(t, h.recordLoginFailureErr(t.Context(), subjects))
+		}
+
+		require.ErrorIs(t, h.checkLockout(t.Context(), subjects), ErrAccountLocked)
+
+		require.NoError(t, h.HandleUnlockUser(t.Context(), user.ID))
+		require.NoError(t, h.checkLockout(t.Context(), subjects))
+
+		require.ErrorIs(t, h.HandleUnlockUser(t.Context(), tid.MustUserID()), shield.ErrUserNotFound)
+	})
+}
@@ -0,0 +1,59 @@
+package shieldpassword
+
+import "strings"
+
+var _ PasswordHasher = (*multiPasswordHasher)(nil)
+
+type multiPasswordHasher struct {
+	primary PasswordHasher
+	bcrypt  PasswordHasher
+	argon2  PasswordHasher
+	scrypt  PasswordHasher
+}
+
+// NewMultiPasswordHasher creates a password hasher that hashes passwords
+// with primary, but verifies bcrypt, Argon2id and scrypt hashes alike.
+//
+// Hashes created with another algorithm or different parameters are
+// reported by NeedsRehash, so they can be upgraded to primary on login.
+//
+// Hashes of unknown format are verified with primary.
+func NewMultiPasswordHasher(primary PasswordHasher) PasswordHasher {
+	return &multiPasswordHasher{
+		primary: primary,
+		// Verification relies only on the parameters encoded in the hash.
+		bcrypt: NewBcryptPasswordHasher(BcryptDefaultCost),
+		argon2: NewArgon2PasswordHasher(nil),
+		scrypt: NewScryptPasswordHasher(nil),
+	}
+}
+
+func (h *multiPasswordHasher) Hash(password string) (string, error) {
+	return h.primary.Hash(password)
+}
+
+func (h *multiPasswordHasher) Verify(
+	hashedPassword string,
+	password string,
+) (bool, error) {
+	var hasher PasswordHasher
+
+	switch {
+	case strings.HasPrefix(hashedPassword, "$2a$"),
+		strings.HasPrefix(hashedPassword, "$2b$"),
+		strings.HasPrefix(hashedPassword, "$2y$"):
+		hasher = h.bcrypt
+	case strings.HasPrefix(hashedPassword, "$argon2id$"):
+		hasher = h.argon2
+	case strings.HasPrefix(hashedPassword, "$scrypt$"):
+		hasher = h.scrypt
+	default:
+		hasher = h.primary
+	}
+
+	return hasher.Verify(hashedPassword, password)
+}
+
+func (h *multiPasswordHasher) NeedsRehash(hashedPassword string) bool {
+	return h.primary.NeedsRehash(hashedPassword)
+}
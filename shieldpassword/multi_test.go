@@ -0,0 +1,43 @@
+package shieldpassword
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestMultiPasswordHasher(t *testing.T) {
+	t.Parallel()
+
+	//nolint:exhaustruct
+	primary := NewArgon2PasswordHasher(&Argon2Config{Memory: 64, Iterations: 1})
+	hasher := NewMultiPasswordHasher(primary)
+
+	//nolint:exhaustruct
+	legacy := map[string]PasswordHasher{
+		"bcrypt": NewBcryptPasswordHasher(bcrypt.MinCost),
+		"scrypt": NewScryptPasswordHasher(&ScryptConfig{CostLog2: 4}),
+		"argon2": NewArgon2PasswordHasher(&Argon2Config{Memory: 32, Iterations: 1}),
+	}
+
+	for name, h := range legacy {
+		hash, err := h.Hash("password")
+		require.NoError(t, err, name)
+
+		ok, err := hasher.Verify(hash, "password")
+		require.NoError(t, err, name)
+		assert.True(t, ok, name)
+
+		ok, err = hasher.Verify(hash, "wrong")
+		require.NoError(t, err, name)
+		assert.False(t, ok, name)
+
+		assert.True(t, hasher.NeedsRehash(hash), name)
+	}
+
+	hash, err := hasher.Hash("password")
+	require.NoError(t, err)
+	assert.False(t, hasher.NeedsRehash(hash))
+}
@@ -0,0 +1,139 @@
+package shieldpassword
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"strings"
+
+	"go.inout.gg/foundations/debug"
+	"golang.org/x/text/unicode/norm"
+)
+
+var _ PasswordHasher = (*pepperedPasswordHasher)(nil)
+
+const pepperPrefix = "$pepper$"
+
+// ErrUnknownPepper is returned when a password hash was created with
+// a pepper version that is not configured.
+var ErrUnknownPepper = errors.New("shield/password: unknown pepper version")
+
+// PepperConfig is the configuration for the peppering password hasher.
+type PepperConfig struct {
+	// Peppers maps pepper versions to secret peppers. Peppers must be kept
+	// outside of the database.
+	//
+	// Retired peppers must be kept until all hashes using them have been
+	// re-hashed, otherwise users won't be able to log in.
+	Peppers map[string][]byte // required
+
+	// CurrentVersion is the version of the pepper used for new hashes.
+	CurrentVersion string // required
+}
+
+func (c *PepperConfig) assert() {
+	debug.Assert(len(c.Peppers) > 0, "Peppers must be set")
+	debug.Assert(c.CurrentVersion != "", "CurrentVersion must be set")
+	debug.Assert(
+		len(c.Peppers[c.CurrentVersion]) >= 32,
+		"pepper of CurrentVersion must be at least 32 bytes long",
+	)
+
+	for version := range c.Peppers {
+		debug.Assert(
+			!strings.Contains(version, "$"),
+			"pepper version must not contain $",
+		)
+	}
+}
+
+type pepperedPasswordHasher struct {
+	hasher PasswordHasher
+	config *PepperConfig
+}
+
+// NewPepperedPasswordHasher wraps hasher to mix a secret pepper into every
+// password hash, so that a database dump alone is not enough to crack
+// the passwords offline.
+//
+// The password is keyed with HMAC-SHA256 using the pepper before being
+// passed to hasher, and the pepper version is recorded in the hash, e.g.,
+// $pepper$v1$argon2id$v=19$....
+//
+// Hashes created with a non-current pepper version, as well as hashes created
+// without a pepper, are reported by NeedsRehash, so a pepper can be rotated
+// by re-hashing passwords on login.
+func NewPepperedPasswordHasher(
+	hasher PasswordHasher,
+	config *PepperConfig,
+) PasswordHasher {
+	debug.Assert(hasher != nil, "hasher must be set")
+	config.assert()
+
+	return &pepperedPasswordHasher{hasher, config}
+}
+
+func (h *pepperedPasswordHasher) Hash(password string) (string, error) {
+	version := h.config.CurrentVersion
+
+	hash, err := h.hasher.Hash(h.pepper(h.config.Peppers[version], password))
+	if err != nil {
+		return "", err
+	}
+
+	return pepperPrefix + version + hash, nil
+}
+
+func (h *pepperedPasswordHasher) Verify(
+	hashedPassword string,
+	password string,
+) (bool, error) {
+	version, hash, ok := parsePepperedHash(hashedPassword)
+	if !ok {
+		// Hashes created before the pepper has been introduced.
+		return h.hasher.Verify(hashedPassword, password)
+	}
+
+	pepper, ok := h.config.Peppers[version]
+	if !ok {
+		return false, ErrUnknownPepper
+	}
+
+	return h.hasher.Verify(hash, h.pepper(pepper, password))
+}
+
+func (h *pepperedPasswordHasher) NeedsRehash(hashedPassword string) bool {
+	version, hash, ok := parsePepperedHash(hashedPassword)
+	if !ok || version != h.config.CurrentVersion {
+		return true
+	}
+
+	return h.hasher.NeedsRehash(hash)
+}
+
+// pepper keys the normalized password with the pepper.
+//
+// The result is encoded, so that it's suitable for any hasher, e.g., it
+// fits into the bcrypt 72-byte limit.
+func (h *pepperedPasswordHasher) pepper(pepper []byte, password string) string {
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write([]byte(norm.NFKC.String(password)))
+
+	return b64.EncodeToString(mac.Sum(nil))
+}
+
+// parsePepperedHash splits the peppered hash into the pepper version
+// and the underlying hash.
+func parsePepperedHash(hashedPassword string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(hashedPassword, pepperPrefix)
+	if !ok {
+		return "", "", false
+	}
+
+	i := strings.Index(rest, "$")
+	if i <= 0 {
+		return "", "", false
+	}
+
+	return rest[:i], rest[i:], true
+}
@@ -0,0 +1,63 @@
+package shieldpassword
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPepperedPasswordHasher(t *testing.T) {
+	t.Parallel()
+
+	inner := NewBcryptPasswordHasher(bcrypt.MinCost)
+	peppers := map[string][]byte{
+		"v1": bytes.Repeat([]byte{1}, 32),
+		"v2": bytes.Repeat([]byte{2}, 32),
+	}
+
+	old := NewPepperedPasswordHasher(inner, &PepperConfig{
+		Peppers:        peppers,
+		CurrentVersion: "v1",
+	})
+	hasher := NewPepperedPasswordHasher(inner, &PepperConfig{
+		Peppers:        peppers,
+		CurrentVersion: "v2",
+	})
+
+	hash, err := hasher.Hash("password")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$pepper$v2$2a$"))
+	assert.False(t, hasher.NeedsRehash(hash))
+
+	ok, err := hasher.Verify(hash, "password")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// The pepper is required to verify the password.
+	ok, err = inner.Verify(strings.TrimPrefix(hash, "$pepper$v2"), "password")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	oldHash, err := old.Hash("password")
+	require.NoError(t, err)
+
+	ok, err = hasher.Verify(oldHash, "password")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, hasher.NeedsRehash(oldHash))
+
+	unpepperedHash, err := inner.Hash("password")
+	require.NoError(t, err)
+
+	ok, err = hasher.Verify(unpepperedHash, "password")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, hasher.NeedsRehash(unpepperedHash))
+
+	_, err = hasher.Verify("$pepper$v3"+unpepperedHash, "password")
+	require.ErrorIs(t, err, ErrUnknownPepper)
+}
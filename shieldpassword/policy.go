@@ -0,0 +1,106 @@
+package shieldpassword
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.jetify.com/typeid/v2"
+
+	"go.inout.gg/shield/internal/dbsqlc"
+	"go.inout.gg/shield/shieldpasswordverifier"
+	"go.inout.gg/shield/shieldworkspace"
+)
+
+// ErrPasswordExpired is returned when the user's password is older than
+// the password policy allows.
+var ErrPasswordExpired = errors.New("shield/password: password expired")
+
+// ResolvePasswordPolicy resolves the password policy of the workspace set in
+// ctx via shieldworkspace.WithWorkspaceID using resolver.
+//
+// If resolver is nil, or it resolves no policy, nil is returned.
+func ResolvePasswordPolicy(
+	ctx context.Context,
+	resolver shieldpasswordverifier.PolicyResolver,
+) (*shieldpasswordverifier.Policy, error) {
+	if resolver == nil {
+		return nil, nil //nolint:nilnil
+	}
+
+	workspaceID, _ := shieldworkspace.WorkspaceIDFromContext(ctx)
+
+	policy, err := resolver.ResolvePolicy(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"shield/password: failed to resolve password policy: %w",
+			err,
+		)
+	}
+
+	return policy, nil
+}
+
+// VerifyPassword verifies a new password of the user with the given email
+// against verifier and policy.
+//
+// Both verifier and policy are optional.
+func VerifyPassword(
+	_ context.Context,
+	verifier shieldpasswordverifier.PasswordVerifier,
+	policy *shieldpasswordverifier.Policy,
+	password, email string,
+) error {
+	verifiers := []shieldpasswordverifier.PasswordVerifier{verifier}
+	if policy != nil {
+		verifiers = append(verifiers, policy)
+	}
+
+	//nolint:exhaustruct
+	user := shieldpasswordverifier.UserContext{Email: email}
+	if err := shieldpasswordverifier.All(verifiers...).
+		VerifyForUser(password, user); err != nil {
+		return fmt.Errorf(
+			"shield/password: password verification failed: %w",
+			err,
+		)
+	}
+
+	return nil
+}
+
+// HandleCheckPasswordExpiry returns ErrPasswordExpired if the password of
+// the user with the given userID is older than Policy.MaxAge of the resolved
+// password policy.
+//
+// Applications should call it after a successful login and ask the user to
+// change the password if it has expired.
+func (h *Handler[_, _]) HandleCheckPasswordExpiry(
+	ctx context.Context,
+	userID typeid.TypeID,
+) error {
+	policy, err := ResolvePasswordPolicy(ctx, h.config.PasswordPolicyResolver)
+	if err != nil {
+		return err
+	}
+
+	if policy == nil || policy.MaxAge <= 0 {
+		return nil
+	}
+
+	rotatedAt, err := dbsqlc.New().
+		FindPasswordCredentialRotatedAtByUserID(ctx, h.pool, userID)
+	if err != nil {
+		return fmt.Errorf(
+			"shield/password: failed to find password credential: %w",
+			err,
+		)
+	}
+
+	if policy.IsExpired(rotatedAt, time.Now()) {
+		return ErrPasswordExpired
+	}
+
+	return nil
+}
@@ -0,0 +1,278 @@
+package shieldpassword
+
+import (
+	"cmp"
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+
+	"go.inout.gg/foundations/debug"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/text/unicode/norm"
+)
+
+var _ PasswordHasher = (*scryptPasswordHasher)(nil)
+
+// Scrypt defaults follow the OWASP Password Storage Cheat Sheet
+// recommendation.
+const (
+	ScryptDefaultCostLog2   = 17 // N=2^17
+	ScryptDefaultBlockSize  = 8
+	ScryptDefaultParallel   = 1
+	ScryptDefaultSaltLength = 16
+	ScryptDefaultKeyLength  = 32
+)
+
+// Bounds of scrypt parameters accepted from stored hashes, so that
+// a tampered hash can't make verification arbitrarily expensive.
+const (
+	scryptMaxCostLog2         = 20
+	scryptMaxBlockSize        = 32
+	scryptMaxParallel         = 16
+	scryptMaxBlockSizeProduct = 64      // r*p
+	scryptMaxMemory           = 1 << 30 // bytes
+	scryptMinSaltLength       = 8
+	scryptMaxSaltLength       = 64
+	scryptMinKeyLength        = 16
+	scryptMaxKeyLength        = 128
+)
+
+// ScryptConfig is the configuration for the scrypt password hasher.
+type ScryptConfig struct {
+	// CostLog2 is the binary logarithm of the CPU/memory cost parameter N.
+	//
+	// Defaults to ScryptDefaultCostLog2.
+	CostLog2 int // optional
+
+	// BlockSize is the block size parameter r.
+	//
+	// Defaults to ScryptDefaultBlockSize.
+	BlockSize int // optional
+
+	// Parallel is the parallelization parameter p.
+	//
+	// Defaults to ScryptDefaultParallel.
+	Parallel int // optional
+
+	// SaltLength is the length of a random salt in bytes.
+	//
+	// Defaults to ScryptDefaultSaltLength.
+	SaltLength int // optional
+
+	// KeyLength is the length of a generated hash in bytes.
+	//
+	// Defaults to ScryptDefaultKeyLength.
+	KeyLength int // optional
+}
+
+func (c *ScryptConfig) defaults() {
+	c.CostLog2 = cmp.Or(c.CostLog2, ScryptDefaultCostLog2)
+	c.BlockSize = cmp.Or(c.BlockSize, ScryptDefaultBlockSize)
+	c.Parallel = cmp.Or(c.Parallel, ScryptDefaultParallel)
+	c.SaltLength = cmp.Or(c.SaltLength, ScryptDefaultSaltLength)
+	c.KeyLength = cmp.Or(c.KeyLength, ScryptDefaultKeyLength)
+}
+
+func (c *ScryptConfig) assert() {
+	debug.Assert(c.CostLog2 > 0, "CostLog2 must be positive")
+	debug.Assert(c.CostLog2 <= scryptMaxCostLog2, "CostLog2 must be at most 20")
+	debug.Assert(c.BlockSize > 0, "BlockSize must be positive")
+	debug.Assert(c.BlockSize <= scryptMaxBlockSize, "BlockSize must be at most 32")
+	debug.Assert(c.Parallel > 0, "Parallel must be positive")
+	debug.Assert(c.Parallel <= scryptMaxParallel, "Parallel must be at most 16")
+	debug.Assert(
+		c.BlockSize*c.Parallel <= scryptMaxBlockSizeProduct,
+		"BlockSize*Parallel must be at most 64",
+	)
+	debug.Assert(
+		scryptMemory(c.CostLog2, c.BlockSize) <= scryptMaxMemory,
+		"scrypt must use at most 1 GiB of memory",
+	)
+	debug.Assert(c.SaltLength >= scryptMinSaltLength, "SaltLength must be at least 8 bytes")
+	debug.Assert(c.SaltLength <= scryptMaxSaltLength, "SaltLength must be at most 64 bytes")
+	debug.Assert(c.KeyLength >= scryptMinKeyLength, "KeyLength must be at least 16 bytes")
+	debug.Assert(c.KeyLength <= scryptMaxKeyLength, "KeyLength must be at most 128 bytes")
+}
+
+// scryptMemory returns the number of bytes scrypt uses with the given
+// parameters.
+func scryptMemory(costLog2, blockSize int) int {
+	return 128 * blockSize << costLog2
+}
+
+type scryptPasswordHasher struct {
+	config *ScryptConfig
+}
+
+// NewScryptPasswordHasher creates a password hasher using the scrypt
+// algorithm.
+//
+// Hashes are encoded as PHC strings, e.g., $scrypt$ln=17,r=8,p=1$...,
+// so they carry the parameters they were created with.
+//
+// If config is nil, the default config is used.
+func NewScryptPasswordHasher(config *ScryptConfig) PasswordHasher {
+	if config == nil {
+		//nolint:exhaustruct
+		config = &ScryptConfig{}
+	}
+
+	config.defaults()
+	config.assert()
+
+	return &scryptPasswordHasher{config}
+}
+
+func (h *scryptPasswordHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.config.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf(
+			"shield/password: unable to generate a salt: %w",
+			err,
+		)
+	}
+
+	params := scryptParams{
+		salt:      salt,
+		key:       nil,
+		costLog2:  h.config.CostLog2,
+		blockSize: h.config.BlockSize,
+		parallel:  h.config.Parallel,
+	}
+
+	key, err := params.derive(password, h.config.KeyLength)
+	if err != nil {
+		return "", err
+	}
+
+	params.key = key
+
+	return params.String(), nil
+}
+
+func (h *scryptPasswordHasher) Verify(
+	hashedPassword string,
+	password string,
+) (bool, error) {
+	params, err := parseScryptHash(hashedPassword)
+	if err != nil {
+		return false, err
+	}
+
+	key, err := params.derive(password, len(params.key))
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+func (h *scryptPasswordHasher) NeedsRehash(hashedPassword string) bool {
+	params, err := parseScryptHash(hashedPassword)
+	if err != nil {
+		return true
+	}
+
+	return params.costLog2 != h.config.CostLog2 ||
+		params.blockSize != h.config.BlockSize ||
+		params.parallel != h.config.Parallel ||
+		len(params.salt) != h.config.SaltLength ||
+		len(params.key) != h.config.KeyLength
+}
+
+// scryptParams are parameters of a scrypt hash.
+type scryptParams struct {
+	salt      []byte
+	key       []byte
+	costLog2  int
+	blockSize int
+	parallel  int
+}
+
+func (p scryptParams) derive(password string, keyLength int) ([]byte, error) {
+	key, err := scrypt.Key(
+		[]byte(norm.NFKC.String(password)),
+		p.salt,
+		1<<p.costLog2,
+		p.blockSize,
+		p.parallel,
+		keyLength,
+	)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"shield/password: unable to generate a scrypt hash: %w",
+			err,
+		)
+	}
+
+	return key, nil
+}
+
+// String encodes the hash as a PHC string.
+func (p scryptParams) String() string {
+	return fmt.Sprintf(
+		"$scrypt$ln=%d,r=%d,p=%d$%s$%s",
+		p.costLog2,
+		p.blockSize,
+		p.parallel,
+		b64.EncodeToString(p.salt),
+		b64.EncodeToString(p.key),
+	)
+}
+
+// parseScryptHash decodes a scrypt PHC string.
+//
+// The parameters are parsed strictly and bounded, as they are used to
+// derive a key on each verification.
+func parseScryptHash(hash string) (scryptParams, error) {
+	var p scryptParams
+
+	// "", "scrypt", "ln=...,r=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 || parts[0] != "" || parts[1] != "scrypt" {
+		return p, ErrMalformedHash
+	}
+
+	params := strings.Split(parts[2], ",")
+	if len(params) != 3 {
+		return p, ErrMalformedHash
+	}
+
+	costLog2, ok := parsePHCParam(params[0], "ln", scryptMaxCostLog2)
+	if !ok || costLog2 == 0 {
+		return p, ErrMalformedHash
+	}
+
+	blockSize, ok := parsePHCParam(params[1], "r", scryptMaxBlockSize)
+	if !ok || blockSize == 0 {
+		return p, ErrMalformedHash
+	}
+
+	parallel, ok := parsePHCParam(params[2], "p", scryptMaxParallel)
+	if !ok || parallel == 0 || blockSize*parallel > scryptMaxBlockSizeProduct {
+		return p, ErrMalformedHash
+	}
+
+	p.costLog2 = int(costLog2)   //nolint:gosec // bounded above.
+	p.blockSize = int(blockSize) //nolint:gosec // bounded above.
+	p.parallel = int(parallel)   //nolint:gosec // bounded above.
+
+	if scryptMemory(p.costLog2, p.blockSize) > scryptMaxMemory {
+		return p, ErrMalformedHash
+	}
+
+	var err error
+
+	if p.salt, err = b64.Strict().DecodeString(parts[3]); err != nil ||
+		len(p.salt) < scryptMinSaltLength || len(p.salt) > scryptMaxSaltLength {
+		return p, ErrMalformedHash
+	}
+
+	if p.key, err = b64.Strict().DecodeString(parts[4]); err != nil ||
+		len(p.key) < scryptMinKeyLength || len(p.key) > scryptMaxKeyLength {
+		return p, ErrMalformedHash
+	}
+
+	return p, nil
+}
@@ -0,0 +1,89 @@
+package shieldpassword
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScryptPasswordHasher(t *testing.T) {
+	t.Parallel()
+
+	//nolint:exhaustruct
+	hasher := NewScryptPasswordHasher(&ScryptConfig{CostLog2: 4})
+
+	hash, err := hasher.Hash("correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$scrypt$ln=4,r=8,p=1$"))
+
+	ok, err := hasher.Verify(hash, "correct horse battery staple")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = hasher.Verify(hash, "Tr0ub4dor&3")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.False(t, hasher.NeedsRehash(hash))
+	//nolint:exhaustruct
+	assert.True(t, NewScryptPasswordHasher(&ScryptConfig{CostLog2: 5}).NeedsRehash(hash))
+
+	_, err = hasher.Verify("$2a$10$invalid", "password")
+	require.ErrorIs(t, err, ErrMalformedHash)
+}
+
+func TestParseScryptHash(t *testing.T) {
+	t.Parallel()
+
+	//nolint:exhaustruct
+	hasher := NewScryptPasswordHasher(&ScryptConfig{CostLog2: 4})
+
+	hash, err := hasher.Hash("password")
+	require.NoError(t, err)
+
+	_, err = parseScryptHash(hash)
+	require.NoError(t, err)
+
+	parts := strings.Split(hash, "$")
+	withParams := func(params string) string {
+		return strings.Join([]string{"", "scrypt", params, parts[3], parts[4]}, "$")
+	}
+	withSaltAndKey := func(salt, key []byte) string {
+		return strings.Join([]string{"", "scrypt", parts[2], b64.EncodeToString(salt), b64.EncodeToString(key)}, "$")
+	}
+
+	tests := map[string]string{
+		"trailing junk in params": withParams("ln=4,r=8,p=1junk"),
+		"extra param":             withParams("ln=4,r=8,p=1,x=1"),
+		"missing param":           withParams("ln=4,r=8"),
+		"reordered params":        withParams("r=8,ln=4,p=1"),
+		"signed value":            withParams("ln=+4,r=8,p=1"),
+		"leading zero":            withParams("ln=04,r=8,p=1"),
+		"whitespace":              withParams("ln=4, r=8, p=1"),
+		"cost too large":          withParams("ln=31,r=8,p=1"),
+		"zero cost":               withParams("ln=0,r=8,p=1"),
+		"block size too large":    withParams("ln=4,r=1024,p=1"),
+		"too many threads":        withParams("ln=4,r=1,p=255"),
+		"r*p too large":           withParams("ln=4,r=16,p=16"),
+		"memory too large":        withParams("ln=20,r=16,p=1"),
+		"zero block size":         withParams("ln=4,r=0,p=1"),
+		"zero threads":            withParams("ln=4,r=8,p=0"),
+		"salt too short":          withSaltAndKey(make([]byte, 4), make([]byte, 32)),
+		"salt too long":           withSaltAndKey(make([]byte, 1024), make([]byte, 32)),
+		"key too short":           withSaltAndKey(make([]byte, 16), make([]byte, 4)),
+		"key too long":            withSaltAndKey(make([]byte, 16), make([]byte, 1024)),
+		"padded salt":             strings.Join([]string{"", "scrypt", parts[2], parts[3] + "==", parts[4]}, "$"),
+		"trailing junk in key":    hash + "$",
+	}
+
+	for name, h := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := parseScryptHash(h)
+			assert.ErrorIs(t, err, ErrMalformedHash)
+		})
+	}
+}
@@ -15,4 +15,8 @@ var d = debug.Debuglog("shield/password")
 type PasswordHasher interface {
 	Hash(password string) (string, error)
 	Verify(hashedPassword string, password string) (bool, error)
+
+	// NeedsRehash reports whether the hashed password was created with
+	// a different algorithm or parameters, and should be re-hashed.
+	NeedsRehash(hashedPassword string) bool
 }
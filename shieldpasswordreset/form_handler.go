@@ -0,0 +1,253 @@
+package shieldpasswordreset
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+
+	"github.com/go-playground/validator/v10"
+	"go.inout.gg/foundations/debug"
+	"go.inout.gg/foundations/http/httperror"
+
+	"go.inout.gg/shield"
+	"go.inout.gg/shield/shieldpassword"
+	"go.inout.gg/shield/shieldpasswordverifier"
+)
+
+// DefaultMaxFormSize is the default limit of the request body size.
+const DefaultMaxFormSize = 1 << 20
+
+var (
+	ErrMalformedForm = errors.New("shield/passwordreset: malformed form")
+	ErrInvalidForm   = errors.New("shield/passwordreset: invalid form")
+)
+
+// PasswordResetRequestForm is the form of the password reset request.
+type PasswordResetRequestForm struct {
+	Email string `json:"email" mod:"trim,lcase" scrub:"emails" validate:"required,email"`
+}
+
+// PasswordResetConfirmForm is the form of the password reset confirmation.
+//
+// The token might also be passed as the "token" query parameter, e.g.,
+// from the link sent to the user.
+type PasswordResetConfirmForm struct {
+	Token    string `json:"token"    mod:"trim" scrub:"text" validate:"required"`
+	Password string `json:"password" scrub:"text" validate:"required"` //nolint:gosec
+}
+
+// FormConfig is the configuration for the FormHandler.
+type FormConfig struct {
+	Logger *slog.Logger // optional
+
+	// ErrorHandler handles errors, wrapped into httperror with the status
+	// code matching the error.
+	ErrorHandler httperror.ErrorHandler // required
+
+	// RequestRedirectURL is the URL the user is redirected to after
+	// a successful password reset request.
+	//
+	// If not set, 204 No Content is responded.
+	RequestRedirectURL string // optional
+
+	// ConfirmRedirectURL is the URL the user is redirected to after
+	// a successful password reset.
+	//
+	// If not set, 204 No Content is responded.
+	ConfirmRedirectURL string // optional
+
+	// MaxFormSize limits the size of the request body.
+	//
+	// Defaults to DefaultMaxFormSize.
+	MaxFormSize int64 // optional
+}
+
+func (c *FormConfig) defaults() {
+	c.Logger = cmp.Or(c.Logger, shield.DefaultLogger)
+	c.MaxFormSize = cmp.Or(c.MaxFormSize, DefaultMaxFormSize)
+}
+
+func (c *FormConfig) assert() {
+	debug.Assert(c.Logger != nil, "Logger must be set")
+	debug.Assert(c.ErrorHandler != nil, "ErrorHandler must be set")
+}
+
+// FormHandler handles password reset HTTP requests.
+//
+// It accepts both URL-encoded forms and JSON bodies. Its methods are
+// http.HandlerFunc and can be mounted on http.ServeMux patterns:
+//
+//	mux.HandleFunc("POST /password-reset", h.HandleRequest)
+//	mux.HandleFunc("POST /password-reset/confirm", h.HandleConfirm)
+type FormHandler struct {
+	handler *Handler
+	config  *FormConfig
+}
+
+// NewFormHandler creates a new FormHandler on top of handler.
+func NewFormHandler(handler *Handler, config *FormConfig) *FormHandler {
+	debug.Assert(handler != nil, "handler must be set")
+	debug.Assert(config != nil, "config must be set")
+
+	config.defaults()
+	config.assert()
+
+	return &FormHandler{handler, config}
+}
+
+// HandleRequest handles a password reset request submitted with
+// PasswordResetRequestForm.
+func (h *FormHandler) HandleRequest(w http.ResponseWriter, r *http.Request) {
+	var form PasswordResetRequestForm
+	if err := h.decode(w, r, &form, func(values map[string][]string) {
+		form.Email = first(values["email"])
+	}); err != nil {
+		h.error(w, r, err)
+		return
+	}
+
+	if err := h.handler.HandlePasswordReset(r.Context(), form.Email); err != nil {
+		h.error(w, r, err)
+		return
+	}
+
+	h.success(w, r, h.config.RequestRedirectURL)
+}
+
+// HandleConfirm handles a password reset confirmation submitted with
+// PasswordResetConfirmForm.
+func (h *FormHandler) HandleConfirm(w http.ResponseWriter, r *http.Request) {
+	var form PasswordResetConfirmForm
+
+	form.Token = r.URL.Query().Get("token")
+	if err := h.decode(w, r, &form, func(values map[string][]string) {
+		form.Token = cmp.Or(first(values["token"]), form.Token)
+		form.Password = first(values["password"])
+	}); err != nil {
+		h.error(w, r, err)
+		return
+	}
+
+	if err := h.handler.HandlePasswordResetConfirm(
+		r.Context(),
+		form.Password,
+		form.Token,
+	); err != nil {
+		h.error(w, r, err)
+		return
+	}
+
+	h.success(w, r, h.config.ConfirmRedirectURL)
+}
+
+// decode decodes the request body into form, modifies and validates it.
+//
+// JSON bodies are decoded into form directly, URL-encoded forms are passed
+// to fromValues.
+func (h *FormHandler) decode(
+	w http.ResponseWriter,
+	r *http.Request,
+	form any,
+	fromValues func(map[string][]string),
+) error {
+	ctx := r.Context()
+	r.Body = http.MaxBytesReader(w, r.Body, h.config.MaxFormSize)
+
+	if isJSON(r) {
+		if err := json.NewDecoder(r.Body).Decode(form); err != nil {
+			return fmt.Errorf("%w: %w", ErrMalformedForm, err)
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			return fmt.Errorf("%w: %w", ErrMalformedForm, err)
+		}
+
+		fromValues(r.PostForm)
+	}
+
+	if err := shield.DefaultFormModifier.Struct(ctx, form); err != nil {
+		return fmt.Errorf("%w: %w", ErrMalformedForm, err)
+	}
+
+	if err := shield.DefaultFormValidator.Struct(form); err != nil {
+		h.logInvalidForm(r, form, err)
+		return fmt.Errorf("%w: %w", ErrInvalidForm, err)
+	}
+
+	return nil
+}
+
+// logInvalidForm logs the invalid form with sensitive fields scrubbed.
+func (h *FormHandler) logInvalidForm(r *http.Request, form any, err error) {
+	ctx := r.Context()
+
+	if scrubErr := shield.DefaultFormScrubber.Struct(ctx, form); scrubErr != nil {
+		return
+	}
+
+	h.config.Logger.DebugContext(
+		ctx,
+		"Invalid password reset form",
+		slog.Any("form", form),
+		slog.Any("error", err),
+	)
+}
+
+func (h *FormHandler) success(w http.ResponseWriter, r *http.Request, redirectURL string) {
+	if redirectURL != "" {
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *FormHandler) error(w http.ResponseWriter, r *http.Request, err error) {
+	h.config.ErrorHandler.ServeHTTP(w, r, httperror.FromError(err, statusCode(err)))
+}
+
+// statusCode maps err to the HTTP status code.
+func statusCode(err error) int {
+	var (
+		maxBytesErr     *http.MaxBytesError
+		validationErr   validator.ValidationErrors
+		verificationErr *shieldpasswordverifier.PasswordVerificationError
+	)
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrMalformedForm):
+		return http.StatusBadRequest
+	case errors.As(err, &validationErr),
+		errors.As(err, &verificationErr),
+		errors.Is(err, shieldpassword.ErrPasswordReused):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, shield.ErrAuthenticatedUser):
+		return http.StatusForbidden
+	case errors.Is(err, shield.ErrUserNotFound),
+		errors.Is(err, ErrPasswordResetTokenNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrUsedPasswordResetToken):
+		return http.StatusGone
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func isJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "application/json"
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
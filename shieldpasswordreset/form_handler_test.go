@@ -0,0 +1,79 @@
+package shieldpasswordreset
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormHandlerDecode(t *testing.T) {
+	t.Parallel()
+
+	//nolint:exhaustruct
+	h := &FormHandler{config: &FormConfig{}}
+	h.config.defaults()
+
+	t.Run("form", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("email=+John@Example.com+"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		var form PasswordResetRequestForm
+		err := h.decode(httptest.NewRecorder(), r, &form, func(v map[string][]string) {
+			form.Email = first(v["email"])
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "john@example.com", form.Email)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest(http.MethodPost, "/?token=abc", strings.NewReader(`{"password":"secret"}`))
+		r.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+		var form PasswordResetConfirmForm
+
+		form.Token = r.URL.Query().Get("token")
+		err := h.decode(httptest.NewRecorder(), r, &form, nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, "abc", form.Token)
+		assert.Equal(t, "secret", form.Password)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"email":"not-an-email"}`))
+		r.Header.Set("Content-Type", "application/json")
+
+		var form PasswordResetRequestForm
+
+		err := h.decode(httptest.NewRecorder(), r, &form, nil)
+		require.ErrorIs(t, err, ErrInvalidForm)
+		assert.Equal(t, http.StatusUnprocessableEntity, statusCode(err))
+	})
+}
+
+func TestStatusCode(t *testing.T) {
+	t.Parallel()
+
+	tests := map[error]int{
+		ErrMalformedForm:              http.StatusBadRequest,
+		ErrPasswordResetTokenNotFound: http.StatusNotFound,
+		ErrUsedPasswordResetToken:     http.StatusGone,
+		errors.New("boom"):            http.StatusInternalServerError,
+	}
+
+	for err, want := range tests {
+		assert.Equal(t, want, statusCode(err), "statusCode(%v)", err)
+	}
+}
@@ -6,24 +6,37 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.inout.gg/foundations/dbsql"
 	"go.inout.gg/foundations/debug"
 	"go.inout.gg/foundations/must"
+	"go.jetify.com/typeid/v2"
 
 	"go.inout.gg/shield"
 	"go.inout.gg/shield/internal/dbsqlc"
 	"go.inout.gg/shield/internal/random"
 	"go.inout.gg/shield/internal/tid"
 	"go.inout.gg/shield/shieldpassword"
+	"go.inout.gg/shield/shieldpasswordverifier"
 	"go.inout.gg/shield/shieldsender"
 	"go.inout.gg/shield/shieldsession"
 )
 
-// ErrUsedPasswordResetToken is returned when the password reset token has already been used.
-var ErrUsedPasswordResetToken = errors.New(
-	"shield/passwordreset: used password reset token",
+var (
+	// ErrUsedPasswordResetToken is returned when the password reset token has already been used.
+	ErrUsedPasswordResetToken = errors.New(
+		"shield/passwordreset: used password reset token",
+	)
+
+	// ErrPasswordResetTokenNotFound is returned when the password reset token
+	// doesn't exist or has expired.
+	ErrPasswordResetTokenNotFound = errors.New(
+		"shield/passwordreset: password reset token not found",
+	)
 )
 
 const (
@@ -39,6 +52,31 @@ type Config struct {
 	PasswordHasher shieldpassword.PasswordHasher // optional
 	Logger         *slog.Logger                  // optional
 
+	// PasswordVerifier verifies the strength of the new password.
+	//
+	// If not set, passwords are not verified.
+	PasswordVerifier shieldpasswordverifier.PasswordVerifier // optional
+
+	// PasswordPolicyResolver resolves the password policy of the workspace
+	// set in the context with shieldworkspace.WithWorkspaceID.
+	//
+	// The resolved policy is applied in addition to PasswordVerifier.
+	PasswordPolicyResolver shieldpasswordverifier.PolicyResolver // optional
+
+	// PasswordHistory prevents reuse of recent passwords.
+	PasswordHistory shieldpassword.PasswordHistory // optional
+
+	// EnumerationResistant makes reset requests for unknown emails succeed
+	// silently, so that attackers can't find out whether an email is
+	// registered.
+	//
+	// Tokens of registered emails are then issued and sent in the background,
+	// so that the response time doesn't reveal registered emails either.
+	// Use Handler.Wait to wait for them on shutdown.
+	//
+	// If not set, shield.ErrUserNotFound is returned for unknown emails.
+	EnumerationResistant bool // optional
+
 	// TokenLength set the length of the reset token.
 	//
 	// Defaults to DefaultResetTokenExpiry.
@@ -90,6 +128,31 @@ func WithPasswordHasher(hasher shieldpassword.PasswordHasher) func(*Config) {
 	return func(cfg *Config) { cfg.PasswordHasher = hasher }
 }
 
+// WithPasswordVerifier configures the password verifier.
+func WithPasswordVerifier(
+	verifier shieldpasswordverifier.PasswordVerifier,
+) func(*Config) {
+	return func(cfg *Config) { cfg.PasswordVerifier = verifier }
+}
+
+// WithPasswordPolicyResolver configures the password policy resolver.
+func WithPasswordPolicyResolver(
+	resolver shieldpasswordverifier.PolicyResolver,
+) func(*Config) {
+	return func(cfg *Config) { cfg.PasswordPolicyResolver = resolver }
+}
+
+// WithPasswordHistory configures the password history.
+func WithPasswordHistory(history shieldpassword.PasswordHistory) func(*Config) {
+	return func(cfg *Config) { cfg.PasswordHistory = history }
+}
+
+// WithEnumerationResistance makes reset requests for unknown emails succeed
+// silently.
+func WithEnumerationResistance() func(*Config) {
+	return func(cfg *Config) { cfg.EnumerationResistant = true }
+}
+
 // ResetTokenMessagePayload is the payload for the reset token message.
 type PasswordResetRequestMessagePayload struct {
 	Token string
@@ -106,6 +169,9 @@ type Handler struct {
 	pool   *pgxpool.Pool
 	sender shieldsender.Sender
 	config *Config
+
+	// wg tracks tokens sent in the background.
+	wg sync.WaitGroup
 }
 
 func NewHandler(
@@ -119,13 +185,22 @@ func NewHandler(
 
 	config.assert()
 
-	h := Handler{pool, sender, config}
+	//nolint:exhaustruct
+	h := &Handler{pool: pool, sender: sender, config: config}
 	h.assert()
 
-	return &h
+	return h
+}
+
+// Wait waits for password reset tokens being sent in the background.
+func (h *Handler) Wait() {
+	h.wg.Wait()
 }
 
 // HandlePasswordReset handles a password reset request.
+//
+// If no user with the given email exists, shield.ErrUserNotFound is
+// returned, or nil if Config.EnumerationResistant is set.
 func (h *Handler) HandlePasswordReset(
 	ctx context.Context,
 	email string,
@@ -135,52 +210,70 @@ func (h *Handler) HandlePasswordReset(
 		return shield.ErrAuthenticatedUser
 	}
 
-	tx, err := h.pool.Begin(ctx)
+	user, err := dbsqlc.New().FindUserByEmail(ctx, h.pool, email)
 	if err != nil {
-		return fmt.Errorf(
-			"shield/passwordreset: failed to begin transaction: %w",
-			err,
-		)
-	}
+		if dbsql.IsNotFoundError(err) {
+			d("password reset requested for an unknown email")
 
-	defer func() { _ = tx.Rollback(ctx) }()
+			if h.config.EnumerationResistant {
+				return nil
+			}
+
+			return shield.ErrUserNotFound
+		}
 
-	user, err := dbsqlc.New().FindUserByEmail(ctx, tx, email)
-	if err != nil {
 		return fmt.Errorf(
 			"shield/passwordreset: failed to find user: %w",
 			err,
 		)
 	}
 
+	if h.config.EnumerationResistant {
+		// Issuing and sending the token takes longer than a failed lookup,
+		// so it's done in the background to keep the response time equal.
+		ctx := context.WithoutCancel(ctx)
+
+		h.wg.Go(func() {
+			if err := h.sendPasswordResetToken(ctx, user); err != nil {
+				h.config.Logger.ErrorContext(
+					ctx,
+					"Failed to send password reset token",
+					slog.String("user_id", user.ID.String()),
+					slog.Any("error", err),
+				)
+			}
+		})
+
+		return nil
+	}
+
+	return h.sendPasswordResetToken(ctx, user)
+}
+
+// sendPasswordResetToken issues a new password reset token for the user
+// and sends it to the user's email.
+func (h *Handler) sendPasswordResetToken(ctx context.Context, user dbsqlc.ShieldUser) error {
 	tokStr := must.Must(random.SecureHexString(h.config.TokenLength))
 
-	tok, err := dbsqlc.New().
-		UpsertPasswordResetToken(ctx, tx, dbsqlc.UpsertPasswordResetTokenParams{
+	// A pending token of the user is replaced, as its plaintext is unknown.
+	if _, err := dbsqlc.New().
+		UpsertPasswordResetToken(ctx, h.pool, dbsqlc.UpsertPasswordResetTokenParams{
 			ID:        tid.MustPasswordResetID(),
-			Token:     tokStr,
+			TokenHash: random.HashToken(tokStr),
 			UserID:    user.ID,
 			ExpiresAt: time.Now().Add(h.config.TokenExpiryIn),
-		})
-	if err != nil {
+		}); err != nil {
 		return fmt.Errorf(
 			"shield/passwordreset: failed to upsert password reset token: %w",
 			err,
 		)
 	}
 
-	if err := tx.Commit(ctx); err != nil {
-		return fmt.Errorf(
-			"shield/passwordreset: failed to commit transaction: %w",
-			err,
-		)
-	}
-
 	if err := h.sender.Send(ctx, shieldsender.Message{
 		Email: user.Email,
 		Key:   shieldsender.MessageKeyPasswordResetRequest,
 		Payload: PasswordResetRequestMessagePayload{
-			Token: tok.Token,
+			Token: tokStr,
 		},
 	}); err != nil {
 		return fmt.Errorf(
@@ -192,11 +285,32 @@ func (h *Handler) HandlePasswordReset(
 	return nil
 }
 
+// HandlePasswordResetConfirm sets a new password for the user the reset
+// token tokStr has been issued for.
+//
+// If the password doesn't pass Config.PasswordVerifier or the resolved
+// password policy, the verifier error is returned, e.g.,
+// *shieldpasswordverifier.PasswordVerificationError. If it matches one of
+// the recent passwords, shieldpassword.ErrPasswordReused is returned.
 func (h *Handler) HandlePasswordResetConfirm(
 	ctx context.Context,
 	password, tokStr string,
 ) error {
-	// Hash password before tx to avoid unnecessary database delay.
+	policy, err := shieldpassword.ResolvePasswordPolicy(
+		ctx,
+		h.config.PasswordPolicyResolver,
+	)
+	if err != nil {
+		return err
+	}
+
+	tokID, userID, err := h.checkPasswordReset(ctx, policy, password, tokStr)
+	if err != nil {
+		return err
+	}
+
+	// The new password is hashed outside of the transaction, so that
+	// the expensive hashing doesn't hold a connection and row locks.
 	passwordHash, err := h.config.PasswordHasher.Hash(password)
 	if err != nil {
 		return fmt.Errorf(
@@ -215,19 +329,20 @@ func (h *Handler) HandlePasswordResetConfirm(
 
 	defer func() { _ = tx.Rollback(ctx) }()
 
-	tok, err := dbsqlc.New().FindPasswordResetToken(ctx, tx, tokStr)
+	n, err := dbsqlc.New().MarkPasswordResetTokenAsUsed(ctx, tx, tokID)
 	if err != nil {
 		return fmt.Errorf(
-			"shield/passwordreset: failed to find password reset token: %w",
+			"shield/passwordreset: failed to mark password reset token as used: %w",
 			err,
 		)
 	}
 
-	if tok.IsUsed {
+	if n == 0 {
 		return ErrUsedPasswordResetToken
 	}
 
-	user, err := dbsqlc.New().FindUserByID(ctx, tx, tok.UserID)
+	user, err := dbsqlc.New().
+		FindUserWithPasswordCredentialByUserIDForUpdate(ctx, tx, userID)
 	if err != nil {
 		return fmt.Errorf(
 			"shield/passwordreset: failed to find user: %w",
@@ -235,16 +350,9 @@ func (h *Handler) HandlePasswordResetConfirm(
 		)
 	}
 
-	if err := dbsqlc.New().MarkPasswordResetTokenAsUsed(ctx, tx, tok.Token); err != nil {
-		return fmt.Errorf(
-			"shield/passwordreset: failed to mark password reset token as used: %w",
-			err,
-		)
-	}
-
 	if err := dbsqlc.New().UpsertPasswordCredentialByUserID(ctx, tx, dbsqlc.UpsertPasswordCredentialByUserIDParams{
 		ID:                   tid.MustCredentialID(),
-		UserID:               tok.UserID,
+		UserID:               user.ID,
 		UserCredentialKey:    user.Email,
 		UserCredentialSecret: passwordHash,
 	}); err != nil {
@@ -254,6 +362,18 @@ func (h *Handler) HandlePasswordResetConfirm(
 		)
 	}
 
+	if user.PasswordHash != nil {
+		if err := h.config.PasswordHistory.RecordInTx(
+			ctx,
+			tx,
+			policy,
+			user.ID,
+			*user.PasswordHash,
+		); err != nil {
+			return err
+		}
+	}
+
 	// Once password is changed, we need to expire all sessions for this user.
 	if _, err := dbsqlc.New().ExpireAllSessionsByUserID(ctx, tx, dbsqlc.ExpireAllSessionsByUserIDParams{
 		UserID:    user.ID,
@@ -286,6 +406,80 @@ func (h *Handler) HandlePasswordResetConfirm(
 	return nil
 }
 
+// checkPasswordReset checks that the reset token tokStr is usable and
+// the password may be set for the user it has been issued for, and returns
+// the token ID along with the user ID.
+//
+// The checks run in a read-only transaction, so that the slow hash
+// verifications don't hold row locks.
+func (h *Handler) checkPasswordReset(
+	ctx context.Context,
+	policy *shieldpasswordverifier.Policy,
+	password, tokStr string,
+) (typeid.TypeID, typeid.TypeID, error) {
+	var zero typeid.TypeID
+
+	//nolint:exhaustruct
+	tx, err := h.pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return zero, zero, fmt.Errorf(
+			"shield/passwordreset: failed to begin transaction: %w",
+			err,
+		)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	tok, err := dbsqlc.New().FindPasswordResetTokenByHash(ctx, tx, random.HashToken(tokStr))
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			return zero, zero, ErrPasswordResetTokenNotFound
+		}
+
+		return zero, zero, fmt.Errorf(
+			"shield/passwordreset: failed to find password reset token: %w",
+			err,
+		)
+	}
+
+	if tok.IsUsed {
+		return zero, zero, ErrUsedPasswordResetToken
+	}
+
+	user, err := dbsqlc.New().
+		FindUserWithPasswordCredentialByUserID(ctx, tx, tok.UserID)
+	if err != nil {
+		return zero, zero, fmt.Errorf(
+			"shield/passwordreset: failed to find user: %w",
+			err,
+		)
+	}
+
+	if err := shieldpassword.VerifyPassword(
+		ctx,
+		h.config.PasswordVerifier,
+		policy,
+		password,
+		user.Email,
+	); err != nil {
+		return zero, zero, err
+	}
+
+	if err := h.config.PasswordHistory.CheckInTx(
+		ctx,
+		tx,
+		h.config.PasswordHasher,
+		policy,
+		user.ID,
+		user.PasswordHash,
+		password,
+	); err != nil {
+		return zero, zero, err
+	}
+
+	return tok.ID, user.ID, nil
+}
+
 func (h *Handler) assert() {
 	debug.Assert(h.pool != nil, "pool must be set")
 	debug.Assert(h.sender != nil, "sender must be set")
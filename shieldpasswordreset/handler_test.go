@@ -0,0 +1,83 @@
+package shieldpasswordreset
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"go.inout.gg/shield"
+	"go.inout.gg/shield/internal/dbsqlc"
+	"go.inout.gg/shield/internal/mocks/mocks"
+	"go.inout.gg/shield/internal/random"
+	"go.inout.gg/shield/internal/testutil"
+	"go.inout.gg/shield/shieldsender"
+)
+
+func TestHandlePasswordReset(t *testing.T) {
+	t.Parallel()
+
+	t.Run("unknown email", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		sender := mocks.NewMockSender(gomock.NewController(t))
+
+		h := NewHandler(pool, sender, NewConfig())
+		require.ErrorIs(t, h.HandlePasswordReset(t.Context(), testutil.Email()), shield.ErrUserNotFound)
+	})
+
+	t.Run("enumeration resistant unknown email", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+
+		// No message is expected to be sent.
+		sender := mocks.NewMockSender(gomock.NewController(t))
+
+		h := NewHandler(pool, sender, NewConfig(WithEnumerationResistance()))
+		require.NoError(t, h.HandlePasswordReset(t.Context(), testutil.Email()))
+		h.Wait()
+	})
+
+	t.Run("enumeration resistant known email is sent in background", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		user := testutil.CreateUser(t, pool, testutil.Email(), true)
+
+		release := make(chan struct{})
+		sent := make(chan shieldsender.Message, 1)
+
+		sender := mocks.NewMockSender(gomock.NewController(t))
+		sender.EXPECT().
+			Send(gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ context.Context, msg shieldsender.Message) error {
+				<-release
+				sent <- msg
+
+				return nil
+			})
+
+		h := NewHandler(pool, sender, NewConfig(WithEnumerationResistance()))
+
+		// The request completes while the message is still being sent, so it
+		// takes as long as for an unknown email.
+		require.NoError(t, h.HandlePasswordReset(t.Context(), user.Email))
+		close(release)
+		h.Wait()
+
+		msg := <-sent
+		assert.Equal(t, user.Email, msg.Email)
+		assert.Equal(t, shieldsender.MessageKeyPasswordResetRequest, msg.Key)
+
+		payload, ok := msg.Payload.(PasswordResetRequestMessagePayload)
+		require.True(t, ok)
+
+		tok, err := dbsqlc.New().FindPasswordResetTokenByHash(t.Context(), pool, random.HashToken(payload.Token))
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, tok.UserID)
+	})
+}
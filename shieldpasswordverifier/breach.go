@@ -0,0 +1,75 @@
+package shieldpasswordverifier
+
+import (
+	"crypto/sha1" //nolint:gosec // SHA-1 is mandated by the HIBP dataset.
+	"fmt"
+)
+
+var _ PasswordVerifier = (*breachVerifier)(nil)
+
+const DefaultMinBreachCount = 1
+
+const ReasonBreached Reason = "Password has appeared in a data breach"
+
+type BreachConfig struct {
+	// MinCount is the minimal number of times a password must have been
+	// seen in breaches to be rejected.
+	MinCount int // optional
+}
+
+// NewBreachConfig creates a new BreachConfig with defaults.
+//
+// cfgs modifiers can be used to optionally override the defaults.
+func NewBreachConfig(cfgs ...func(*BreachConfig)) *BreachConfig {
+	//nolint:exhaustruct
+	config := &BreachConfig{}
+	for _, f := range cfgs {
+		f(config)
+	}
+
+	config.defaults()
+
+	return config
+}
+
+func (c *BreachConfig) defaults() {
+	if c.MinCount <= 0 {
+		c.MinCount = DefaultMinBreachCount
+	}
+}
+
+type breachVerifier struct {
+	config *BreachConfig
+	index  *BreachIndex
+}
+
+// NewBreachVerifier creates a new PasswordVerifier rejecting passwords
+// found in the breach index, e.g., the offline Have I Been Pwned
+// dataset built with BreachIndexBuilder.
+func NewBreachVerifier(index *BreachIndex, config *BreachConfig) (PasswordVerifier, error) {
+	if config == nil {
+		config = NewBreachConfig()
+	}
+
+	config.defaults()
+
+	return &breachVerifier{
+		config: config,
+		index:  index,
+	}, nil
+}
+
+// Verify verifies that the password hasn't appeared in breaches.
+func (v *breachVerifier) Verify(password string) error {
+	//nolint:gosec
+	count, err := v.index.Count(sha1.Sum([]byte(password)))
+	if err != nil {
+		return fmt.Errorf("shield/password_verifier: failed to look up breached password: %w", err)
+	}
+
+	if count >= v.config.MinCount {
+		return newPasswordVerificationError([]Reason{ReasonBreached})
+	}
+
+	return nil
+}
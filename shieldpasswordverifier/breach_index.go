@@ -0,0 +1,251 @@
+package shieldpasswordverifier
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	breachIndexMagic      = "SHLDHIBP\x00\x00\x00\x01"
+	breachIndexHashSize   = 20
+	breachIndexRecordSize = breachIndexHashSize + 4
+	breachRangePrefixLen  = 5
+)
+
+var (
+	ErrMalformedBreachIndex = errors.New("shield/password_verifier: malformed breach index")
+	ErrMalformedBreachDump  = errors.New("shield/password_verifier: malformed breach dump")
+	ErrUnsortedBreachDump   = errors.New("shield/password_verifier: breach dump is not sorted")
+)
+
+// BreachIndex is a compact on-disk index of breached password SHA-1 hashes.
+//
+// The index is a sorted list of fixed-size records, each is a SHA-1 hash
+// followed by a big-endian uint32 breach count. Lookups are performed with
+// binary search directly against the underlying io.ReaderAt, so the index
+// is never loaded into memory.
+//
+// Use BreachIndexBuilder to build the index from a Have I Been Pwned dump.
+type BreachIndex struct {
+	r      io.ReaderAt
+	closer io.Closer
+	n      int64
+}
+
+// OpenBreachIndex opens the breach index file at path.
+//
+// The returned index must be closed once no longer used.
+func OpenBreachIndex(path string) (*BreachIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("shield/password_verifier: failed to open breach index: %w", err)
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("shield/password_verifier: failed to stat breach index: %w", err)
+	}
+
+	idx, err := NewBreachIndex(f, stat.Size())
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	idx.closer = f
+
+	return idx, nil
+}
+
+// NewBreachIndex creates a BreachIndex reading from r of the given size.
+func NewBreachIndex(r io.ReaderAt, size int64) (*BreachIndex, error) {
+	magic := make([]byte, len(breachIndexMagic))
+	if _, err := r.ReadAt(magic, 0); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformedBreachIndex, err)
+	}
+
+	if string(magic) != breachIndexMagic {
+		return nil, fmt.Errorf("%w: unknown header", ErrMalformedBreachIndex)
+	}
+
+	body := size - int64(len(breachIndexMagic))
+	if body%breachIndexRecordSize != 0 {
+		return nil, fmt.Errorf("%w: truncated record", ErrMalformedBreachIndex)
+	}
+
+	return &BreachIndex{
+		r:      r,
+		closer: nil,
+		n:      body / breachIndexRecordSize,
+	}, nil
+}
+
+// Len returns the number of hashes in the index.
+func (idx *BreachIndex) Len() int64 { return idx.n }
+
+// Close closes the underlying file, if the index was opened with
+// OpenBreachIndex.
+func (idx *BreachIndex) Close() error {
+	if idx.closer == nil {
+		return nil
+	}
+
+	if err := idx.closer.Close(); err != nil {
+		return fmt.Errorf("shield/password_verifier: failed to close breach index: %w", err)
+	}
+
+	return nil
+}
+
+// Count returns the number of times the password with the SHA-1 hash
+// has been seen in breaches, or 0 if it's not in the index.
+func (idx *BreachIndex) Count(hash [breachIndexHashSize]byte) (int, error) {
+	var record [breachIndexRecordSize]byte
+
+	lo, hi := int64(0), idx.n
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		off := int64(len(breachIndexMagic)) + mid*breachIndexRecordSize
+		if _, err := idx.r.ReadAt(record[:], off); err != nil {
+			return 0, fmt.Errorf("shield/password_verifier: failed to read breach index: %w", err)
+		}
+
+		switch bytes.Compare(record[:breachIndexHashSize], hash[:]) {
+		case 0:
+			return int(binary.BigEndian.Uint32(record[breachIndexHashSize:])), nil
+		case -1:
+			lo = mid + 1
+		default:
+			hi = mid
+		}
+	}
+
+	return 0, nil
+}
+
+// BreachIndexBuilder builds a BreachIndex from a Have I Been Pwned SHA-1
+// dump.
+//
+// The dump must be added in ascending hash order, as published by
+// Have I Been Pwned: either range files (one per 5-character prefix, with
+// "SUFFIX:COUNT" lines) in prefix order, or a single "HASH:COUNT" file
+// ordered by hash.
+type BreachIndexBuilder struct {
+	w        *bufio.Writer
+	last     []byte
+	minCount int
+	n        int64
+}
+
+// NewBreachIndexBuilder creates a new BreachIndexBuilder writing the index
+// to w.
+//
+// Hashes seen less than minCount times are skipped to reduce the index size.
+func NewBreachIndexBuilder(w io.Writer, minCount int) (*BreachIndexBuilder, error) {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(breachIndexMagic); err != nil {
+		return nil, fmt.Errorf("shield/password_verifier: failed to write breach index: %w", err)
+	}
+
+	return &BreachIndexBuilder{
+		w:        bw,
+		last:     nil,
+		minCount: minCount,
+		n:        0,
+	}, nil
+}
+
+// Len returns the number of hashes written to the index.
+func (b *BreachIndexBuilder) Len() int64 { return b.n }
+
+// AddRange adds a range file of the hash prefix, e.g., "21BD1".
+func (b *BreachIndexBuilder) AddRange(prefix string, r io.Reader) error {
+	if len(prefix) != breachRangePrefixLen {
+		return fmt.Errorf("%w: invalid range prefix %q", ErrMalformedBreachDump, prefix)
+	}
+
+	return b.add(prefix, r)
+}
+
+// AddHashes adds a file of full hashes.
+func (b *BreachIndexBuilder) AddHashes(r io.Reader) error {
+	return b.add("", r)
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (b *BreachIndexBuilder) Flush() error {
+	if err := b.w.Flush(); err != nil {
+		return fmt.Errorf("shield/password_verifier: failed to write breach index: %w", err)
+	}
+
+	return nil
+}
+
+func (b *BreachIndexBuilder) add(prefix string, r io.Reader) error {
+	var record [breachIndexRecordSize]byte
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+
+	for scanner.Scan() {
+		line++
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		hash, countStr, ok := strings.Cut(text, ":")
+		if !ok {
+			return fmt.Errorf("%w: line %d: missing count", ErrMalformedBreachDump, line)
+		}
+
+		hash = prefix + hash
+		if len(hash) != 2*breachIndexHashSize {
+			return fmt.Errorf("%w: line %d: invalid hash length", ErrMalformedBreachDump, line)
+		}
+
+		if _, err := hex.Decode(record[:breachIndexHashSize], []byte(hash)); err != nil {
+			return fmt.Errorf("%w: line %d: %w", ErrMalformedBreachDump, line, err)
+		}
+
+		count, err := strconv.ParseUint(countStr, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: line %d: %w", ErrMalformedBreachDump, line, err)
+		}
+
+		if count < uint64(max(b.minCount, 0)) {
+			continue
+		}
+
+		if b.last != nil && bytes.Compare(b.last, record[:breachIndexHashSize]) >= 0 {
+			return fmt.Errorf("%w: line %d", ErrUnsortedBreachDump, line)
+		}
+
+		binary.BigEndian.PutUint32(record[breachIndexHashSize:], uint32(min(count, math.MaxUint32)))
+
+		if _, err := b.w.Write(record[:]); err != nil {
+			return fmt.Errorf("shield/password_verifier: failed to write breach index: %w", err)
+		}
+
+		b.last = append(b.last[:0], record[:breachIndexHashSize]...)
+		b.n++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("shield/password_verifier: failed to read breach dump: %w", err)
+	}
+
+	return nil
+}
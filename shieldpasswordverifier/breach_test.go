@@ -0,0 +1,63 @@
+package shieldpasswordverifier
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreachVerifier(t *testing.T) {
+	t.Parallel()
+
+	// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8,
+	// SHA-1 of "hunter2" is F3BBBD66A63D4BF1747940578EC3D0103530E21D.
+	ranges := map[string]string{
+		"5BAA6": "003D68EB55068C33ACE09247EE4C639306B:3\r\n" +
+			"1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n",
+		"F3BBB": "D66A63D4BF1747940578EC3D0103530E21D:2\r\n",
+	}
+
+	var buf bytes.Buffer
+
+	b, err := NewBreachIndexBuilder(&buf, 0)
+	require.NoError(t, err)
+
+	for _, prefix := range []string{"5BAA6", "F3BBB"} {
+		require.NoError(t, b.AddRange(prefix, strings.NewReader(ranges[prefix])))
+	}
+
+	require.NoError(t, b.Flush())
+
+	idx, err := NewBreachIndex(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), idx.Len())
+
+	v, err := NewBreachVerifier(idx, NewBreachConfig(func(c *BreachConfig) {
+		c.MinCount = 3
+	}))
+	require.NoError(t, err)
+
+	var verr *PasswordVerificationError
+	require.ErrorAs(t, v.Verify("password"), &verr)
+	assert.Contains(t, verr.Reasons, ReasonBreached)
+
+	// Below the minimal count.
+	require.NoError(t, v.Verify("hunter2"))
+	require.NoError(t, v.Verify("rWibMFACxAUGZmxhVncy"))
+}
+
+func TestBreachIndexBuilderUnsorted(t *testing.T) {
+	t.Parallel()
+
+	b, err := NewBreachIndexBuilder(&bytes.Buffer{}, 0)
+	require.NoError(t, err)
+
+	err = b.AddHashes(strings.NewReader(
+		"F3BBBD66A63D4BF1747940578EC3D0103530E21D:2\n" +
+			"5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\n",
+	))
+	require.ErrorIs(t, err, ErrUnsortedBreachDump)
+}
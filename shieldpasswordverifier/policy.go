@@ -0,0 +1,156 @@
+package shieldpasswordverifier
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"go.jetify.com/typeid/v2"
+)
+
+var (
+	_ UserPasswordVerifier = (*Policy)(nil)
+	_ UserPasswordVerifier = (allVerifier)(nil)
+	_ PolicyResolver       = (PolicyResolverFunc)(nil)
+	_ PolicyResolver       = (*StaticPolicyResolver)(nil)
+)
+
+// All composes verifiers with AND semantics: the password must pass every
+// verifier.
+//
+// Unlike running verifiers one by one, all failing reasons are reported in
+// a single *PasswordVerificationError. Any other error is returned
+// immediately.
+func All(verifiers ...PasswordVerifier) UserPasswordVerifier {
+	return allVerifier(slices.DeleteFunc(
+		slices.Clone(verifiers),
+		func(v PasswordVerifier) bool { return v == nil },
+	))
+}
+
+type allVerifier []PasswordVerifier
+
+func (a allVerifier) Verify(password string) error {
+	//nolint:exhaustruct
+	return a.VerifyForUser(password, UserContext{})
+}
+
+func (a allVerifier) VerifyForUser(password string, user UserContext) error {
+	var reasons []Reason
+
+	for _, v := range a {
+		err := VerifyForUser(v, password, user)
+		if err == nil {
+			continue
+		}
+
+		var verr *PasswordVerificationError
+		if !errors.As(err, &verr) {
+			return err
+		}
+
+		for _, r := range verr.Reasons {
+			if !slices.Contains(reasons, r) {
+				reasons = append(reasons, r)
+			}
+		}
+	}
+
+	if len(reasons) > 0 {
+		return newPasswordVerificationError(reasons)
+	}
+
+	return nil
+}
+
+// Policy is a password policy.
+//
+// Policy verifies passwords against its length and character rules and
+// additional Verifiers, reporting all failing reasons. HistorySize and
+// MaxAge are enforced by the password handlers.
+type Policy struct {
+	// RequiredChars is a list of character sets, the password must contain
+	// at least one character of each set.
+	RequiredChars PasswordRequiredChars // optional
+
+	// Verifiers are additional verifiers the password must pass, e.g.,
+	// a strength or breach verifier.
+	Verifiers []PasswordVerifier // optional
+
+	// MinLength is the minimal length of the password.
+	MinLength int // optional
+
+	// MaxLength is the maximal length of the password, if zero the length is
+	// not limited.
+	MaxLength int // optional
+
+	// HistorySize is the number of the user's previous passwords that
+	// cannot be reused. If zero, passwords can be reused.
+	HistorySize int // optional
+
+	// MaxAge is the duration after which the password expires and has to be
+	// changed. If zero, passwords never expire.
+	MaxAge time.Duration // optional
+}
+
+// Verify verifies the password against the policy.
+func (p *Policy) Verify(password string) error {
+	//nolint:exhaustruct
+	return p.VerifyForUser(password, UserContext{})
+}
+
+// VerifyForUser verifies the password of the user against the policy.
+func (p *Policy) VerifyForUser(password string, user UserContext) error {
+	rules := &passwordVerifier{config: &Config{
+		RequiredChars: p.RequiredChars,
+		MinLength:     p.MinLength,
+		MaxLength:     p.MaxLength,
+	}}
+
+	return All(append([]PasswordVerifier{rules}, p.Verifiers...)...).
+		VerifyForUser(password, user)
+}
+
+// IsExpired reports whether the password set at rotatedAt has expired
+// at now.
+func (p *Policy) IsExpired(rotatedAt, now time.Time) bool {
+	return p.MaxAge > 0 && !now.Before(rotatedAt.Add(p.MaxAge))
+}
+
+// PolicyResolver resolves the password policy of a workspace.
+type PolicyResolver interface {
+	// ResolvePolicy returns the password policy of the workspace.
+	//
+	// workspaceID is zero if the password is not set in a workspace
+	// context.
+	ResolvePolicy(ctx context.Context, workspaceID typeid.TypeID) (*Policy, error)
+}
+
+// PolicyResolverFunc is a function implementing PolicyResolver.
+type PolicyResolverFunc func(context.Context, typeid.TypeID) (*Policy, error)
+
+func (f PolicyResolverFunc) ResolvePolicy(
+	ctx context.Context,
+	workspaceID typeid.TypeID,
+) (*Policy, error) {
+	return f(ctx, workspaceID)
+}
+
+// StaticPolicyResolver resolves policies from a fixed set of per-workspace
+// overrides, falling back to the Default policy.
+type StaticPolicyResolver struct {
+	Default    *Policy                   // required
+	Workspaces map[typeid.TypeID]*Policy // optional
+}
+
+func (r *StaticPolicyResolver) ResolvePolicy(
+	_ context.Context,
+	workspaceID typeid.TypeID,
+) (*Policy, error) {
+	if p, ok := r.Workspaces[workspaceID]; ok && !workspaceID.IsZero() {
+		return p, nil
+	}
+
+	return r.Default, nil
+}
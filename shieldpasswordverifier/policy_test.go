@@ -0,0 +1,74 @@
+package shieldpasswordverifier
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.inout.gg/foundations/must"
+	"go.jetify.com/typeid/v2"
+
+	"go.inout.gg/shield/internal/tid"
+)
+
+func TestPolicyReportsAllReasons(t *testing.T) {
+	t.Parallel()
+
+	//nolint:exhaustruct
+	policy := &Policy{
+		RequiredChars: PasswordRequiredChars{"0123456789"},
+		MinLength:     12,
+		Verifiers: []PasswordVerifier{
+			must.Must(NewStrengthVerifier(NewStrengthConfig())),
+		},
+	}
+
+	var verr *PasswordVerificationError
+	require.ErrorAs(t, policy.Verify("password"), &verr)
+	assert.Equal(
+		t,
+		[]Reason{ReasonPasswordToShort, ReasonMissingRequiredChars, ReasonTooWeak},
+		verr.Reasons,
+	)
+	assert.NotEmpty(t, verr.Error())
+}
+
+func TestVerifierMaxLength(t *testing.T) {
+	t.Parallel()
+
+	v := must.Must(New(NewConfig(func(c *Config) { c.MaxLength = 16 })))
+
+	tests := map[string]Reason{
+		"short":                   ReasonPasswordToShort,
+		"a-way-too-long-password": ReasonPasswordTooLong,
+	}
+
+	for password, reason := range tests {
+		var verr *PasswordVerificationError
+		require.ErrorAs(t, v.Verify(password), &verr, password)
+		assert.Contains(t, verr.Reasons, reason, password)
+	}
+
+	require.NoError(t, v.Verify("just-right"))
+}
+
+func TestStaticPolicyResolver(t *testing.T) {
+	t.Parallel()
+
+	workspaceID := tid.MustWorkspaceID()
+
+	//nolint:exhaustruct
+	resolver := &StaticPolicyResolver{
+		Default:    &Policy{MinLength: 8},
+		Workspaces: map[typeid.TypeID]*Policy{workspaceID: {MinLength: 16}},
+	}
+
+	p, err := resolver.ResolvePolicy(context.Background(), workspaceID)
+	require.NoError(t, err)
+	assert.Equal(t, 16, p.MinLength)
+
+	p, err = resolver.ResolvePolicy(context.Background(), typeid.TypeID{})
+	require.NoError(t, err)
+	assert.Equal(t, 8, p.MinLength)
+}
@@ -0,0 +1,347 @@
+package shieldpasswordverifier
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+var _ UserPasswordVerifier = (*strengthVerifier)(nil)
+
+const (
+	// DefaultMinStrengthScore is the minimal score accepted by the strength
+	// verifier by default.
+	DefaultMinStrengthScore = 3
+
+	// MaxStrengthScore is the score of the strongest passwords.
+	MaxStrengthScore = 4
+
+	// maxAnalyzedLength is the maximal length of a password analyzed as
+	// a whole, longer passwords are analyzed in chunks of this length.
+	maxAnalyzedLength = 100
+
+	// guessesPerSecond is the assumed attacker speed of an offline attack
+	// against a slow password hash.
+	guessesPerSecond = 1e4
+
+	// minUserWordLength is the minimal length of a user word that is
+	// rejected when found in the password.
+	minUserWordLength = 3
+)
+
+const (
+	ReasonTooWeak          Reason = "Password is too easy to guess"
+	ReasonContainsUserInfo Reason = "Password contains personal information"
+)
+
+// Strength is an estimated strength of a password.
+type Strength struct {
+	// Guesses is the estimated number of guesses needed to crack
+	// the password.
+	Guesses float64
+
+	// Score is a number from 0 (too guessable) to 4 (very unguessable).
+	Score int
+
+	// CrackTime is the estimated time needed to crack the password in
+	// an offline attack against a slow password hash.
+	CrackTime time.Duration
+}
+
+// EstimateStrength estimates the strength of the password by searching for
+// common patterns: dictionary words (including reversed and l33t spelled
+// ones), keyboard walks, repeats, sequences and dates.
+//
+// userInputs are user-specific words, e.g., the user's email or name,
+// that are treated as the most common dictionary words.
+func EstimateStrength(password string, userInputs ...string) Strength {
+	return estimateStrength(password, []map[string]int{
+		defaultDictionary,
+		newRankedDictionary(userInputs),
+	})
+}
+
+func estimateStrength(password string, dicts []map[string]int) Strength {
+	runes := []rune(password)
+
+	var guesses float64
+
+	if len(runes) <= maxAnalyzedLength {
+		guesses = estimateGuesses(runes, dicts)
+	} else if base, count := repeatedBase(runes); count > 1 {
+		// A long repeat is as guessable as its base times the number of
+		// repetitions.
+		guesses = estimateGuesses(base, dicts) * float64(count)
+	} else {
+		// Long passwords are analyzed in chunks, so that patterns are
+		// detected over the whole password rather than only in
+		// its beginning.
+		guesses = 1
+		for chunk := range slices.Chunk(runes, maxAnalyzedLength) {
+			guesses *= estimateGuesses(chunk, dicts)
+		}
+	}
+
+	return Strength{
+		Guesses:   guesses,
+		Score:     score(guesses),
+		CrackTime: crackTime(guesses),
+	}
+}
+
+// repeatedBase returns the shortest base that password is a repetition of
+// and the number of repetitions, if the base is not longer than
+// maxAnalyzedLength.
+func repeatedBase(password []rune) ([]rune, int) {
+	n := len(password)
+
+	// prefix[i] is the length of the longest proper prefix of password[:i+1]
+	// that is also its suffix.
+	prefix := make([]int, n)
+	for i := 1; i < n; i++ {
+		k := prefix[i-1]
+		for k > 0 && password[i] != password[k] {
+			k = prefix[k-1]
+		}
+
+		if password[i] == password[k] {
+			k++
+		}
+
+		prefix[i] = k
+	}
+
+	period := n - prefix[n-1]
+	if n%period != 0 || period > maxAnalyzedLength {
+		return password, 1
+	}
+
+	return password[:period], n / period
+}
+
+// estimateGuesses finds the most guessable sequence of non-overlapping
+// matches covering the password and returns its number of guesses.
+//
+// For a sequence of l matches the number of guesses is
+//
+//	l! * prod(match guesses) + 10000^(l-1)
+//
+// the factorial accounts for the order of the matches, the additive term
+// penalizes sequences with many matches.
+func estimateGuesses(password []rune, dicts []map[string]int) float64 {
+	n := len(password)
+	if n == 0 {
+		return 1
+	}
+
+	matches := findMatches(password, dicts)
+
+	byEnd := make([][]match, n)
+	for _, m := range matches {
+		byEnd[m.j] = append(byEnd[m.j], m)
+	}
+
+	// best[k][l] is the minimal log10 product of guesses of l matches
+	// covering password[:k+1].
+	best := make([][]float64, n)
+	for k := range best {
+		best[k] = make([]float64, n+1)
+		for l := range best[k] {
+			best[k][l] = math.Inf(1)
+		}
+	}
+
+	for k := range n {
+		candidates := byEnd[k]
+		for i := 0; i <= k; i++ {
+			candidates = append(candidates, match{
+				pattern: patternBruteforce,
+				token:   string(password[i : k+1]),
+				i:       i,
+				j:       k,
+				guesses: math.Pow(bruteforceCardinality, float64(k-i+1)),
+			})
+		}
+
+		for _, m := range candidates {
+			g := math.Log10(matchGuesses(m))
+
+			if m.i == 0 {
+				best[k][1] = math.Min(best[k][1], g)
+				continue
+			}
+
+			for l, prev := range best[m.i-1] {
+				if l+1 <= n && !math.IsInf(prev, 1) {
+					best[k][l+1] = math.Min(best[k][l+1], prev+g)
+				}
+			}
+		}
+	}
+
+	minimal := math.Inf(1)
+
+	for l, product := range best[n-1] {
+		if math.IsInf(product, 1) {
+			continue
+		}
+
+		lgFactorial, _ := math.Lgamma(float64(l + 1))
+		a := lgFactorial/math.Ln10 + product
+		b := 4 * float64(l-1)
+
+		// log10(10^a + 10^b)
+		total := math.Max(a, b) + math.Log10(1+math.Pow(10, -math.Abs(a-b)))
+		minimal = math.Min(minimal, total)
+	}
+
+	return math.Pow(10, minimal)
+}
+
+func findMatches(password []rune, dicts []map[string]int) []match {
+	var matches []match
+
+	matches = append(matches, dictionaryMatches(password, dicts)...)
+	matches = append(matches, spatialMatches(password)...)
+	matches = append(matches, sequenceMatches(password)...)
+	matches = append(matches, dateMatches(password)...)
+	matches = append(matches, repeatMatches(password, func(base []rune) float64 {
+		return estimateGuesses(base, dicts)
+	})...)
+
+	return matches
+}
+
+// matchGuesses returns guesses of m, bounded from below, so that short
+// matches are not preferred over bruteforcing.
+func matchGuesses(m match) float64 {
+	if m.pattern == patternBruteforce {
+		return m.guesses
+	}
+
+	minGuesses := float64(minSubmatchGuessesN)
+	if m.j == m.i {
+		minGuesses = minSubmatchGuesses1
+	}
+
+	return math.Max(m.guesses, minGuesses)
+}
+
+func score(guesses float64) int {
+	const delta = 5
+
+	switch {
+	case guesses < 1e3+delta:
+		return 0
+	case guesses < 1e6+delta:
+		return 1
+	case guesses < 1e8+delta:
+		return 2
+	case guesses < 1e10+delta:
+		return 3
+	default:
+		return MaxStrengthScore
+	}
+}
+
+func crackTime(guesses float64) time.Duration {
+	seconds := guesses / guessesPerSecond
+	if seconds >= float64(math.MaxInt64)/float64(time.Second) {
+		return time.Duration(math.MaxInt64)
+	}
+
+	return time.Duration(seconds * float64(time.Second))
+}
+
+type StrengthConfig struct {
+	// Dictionary is a list of additional common words, e.g., the name of
+	// the service, ordered from the most to the least common.
+	Dictionary []string // optional
+
+	// MinScore is the minimal accepted strength score from 0 to 4.
+	MinScore int // optional
+}
+
+// NewStrengthConfig creates a new StrengthConfig with defaults.
+//
+// cfgs modifiers can be used to optionally override the defaults.
+func NewStrengthConfig(cfgs ...func(*StrengthConfig)) *StrengthConfig {
+	//nolint:exhaustruct
+	config := &StrengthConfig{}
+	for _, f := range cfgs {
+		f(config)
+	}
+
+	config.defaults()
+
+	return config
+}
+
+func (c *StrengthConfig) defaults() {
+	if c.MinScore == 0 {
+		c.MinScore = DefaultMinStrengthScore
+	}
+
+	c.MinScore = min(c.MinScore, MaxStrengthScore)
+}
+
+type strengthVerifier struct {
+	config     *StrengthConfig
+	dictionary map[string]int
+}
+
+// NewStrengthVerifier creates a new PasswordVerifier rejecting passwords
+// with the estimated strength score below config.MinScore.
+//
+// The returned verifier takes the user's personal information into account
+// when used via VerifyForUser.
+func NewStrengthVerifier(config *StrengthConfig) (UserPasswordVerifier, error) {
+	if config == nil {
+		config = NewStrengthConfig()
+	}
+
+	config.defaults()
+
+	return &strengthVerifier{
+		config:     config,
+		dictionary: newRankedDictionary(config.Dictionary),
+	}, nil
+}
+
+// Verify verifies the strength of the password.
+func (v *strengthVerifier) Verify(password string) error {
+	//nolint:exhaustruct
+	return v.VerifyForUser(password, UserContext{})
+}
+
+// VerifyForUser verifies the strength of the password, treating the user's
+// personal information as easily guessable words.
+func (v *strengthVerifier) VerifyForUser(password string, user UserContext) error {
+	var reasons []Reason
+
+	words := user.words()
+	lower := strings.ToLower(password)
+
+	for _, w := range words {
+		if len(w) >= minUserWordLength && strings.Contains(lower, w) {
+			reasons = append(reasons, ReasonContainsUserInfo)
+			break
+		}
+	}
+
+	strength := estimateStrength(password, []map[string]int{
+		defaultDictionary,
+		v.dictionary,
+		newRankedDictionary(words),
+	})
+	if strength.Score < v.config.MinScore {
+		reasons = append(reasons, ReasonTooWeak)
+	}
+
+	if len(reasons) > 0 {
+		return newPasswordVerificationError(reasons)
+	}
+
+	return nil
+}
@@ -0,0 +1,695 @@
+package shieldpasswordverifier
+
+import (
+	_ "embed"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// matchPattern is a kind of a guessable pattern found in a password.
+type matchPattern string
+
+const (
+	patternDictionary matchPattern = "dictionary"
+	patternSpatial    matchPattern = "spatial"
+	patternRepeat     matchPattern = "repeat"
+	patternSequence   matchPattern = "sequence"
+	patternDate       matchPattern = "date"
+	patternBruteforce matchPattern = "bruteforce"
+)
+
+const (
+	bruteforceCardinality = 10
+	minSubmatchGuesses1   = 10
+	minSubmatchGuessesN   = 50
+	minYearSpace          = 20
+	maxSequenceDelta      = 5
+	minMatchLength        = 3
+	maxDictionaryWordLen  = 32
+)
+
+// match is a pattern occupying password[i:j+1] (in runes).
+type match struct {
+	pattern matchPattern
+	token   string
+	i, j    int
+	guesses float64
+}
+
+//go:embed dictionary.txt
+var dictionaryFile string
+
+// defaultDictionary maps common passwords and words to their frequency rank.
+//
+//nolint:gochecknoglobals
+var defaultDictionary = newRankedDictionary(strings.Fields(dictionaryFile))
+
+func newRankedDictionary(words []string) map[string]int {
+	dict := make(map[string]int, len(words))
+
+	for i, w := range words {
+		w = strings.ToLower(w)
+		if _, ok := dict[w]; !ok {
+			dict[w] = i + 1
+		}
+	}
+
+	return dict
+}
+
+//nolint:gochecknoglobals
+var l33tTable = map[rune][]rune{
+	'4': {'a'},
+	'@': {'a'},
+	'8': {'b'},
+	'(': {'c'},
+	'{': {'c'},
+	'[': {'c'},
+	'<': {'c'},
+	'3': {'e'},
+	'6': {'g'},
+	'9': {'g'},
+	'1': {'i', 'l'},
+	'!': {'i'},
+	'|': {'i', 'l'},
+	'7': {'l', 't'},
+	'0': {'o'},
+	'$': {'s'},
+	'5': {'s'},
+	'+': {'t'},
+	'%': {'x'},
+	'2': {'z'},
+}
+
+// dictionaryMatches finds dictionary words, including reversed and l33t
+// spelled ones.
+func dictionaryMatches(password []rune, dicts []map[string]int) []match {
+	var matches []match
+
+	lower := []rune(strings.ToLower(string(password)))
+	n := len(lower)
+
+	for i := range n {
+		for j := i + minMatchLength - 1; j < min(n, i+maxDictionaryWordLen); j++ {
+			token := string(password[i : j+1])
+			word := string(lower[i : j+1])
+			variations := uppercaseVariations(token)
+
+			if rank, ok := lookup(dicts, word); ok {
+				matches = append(matches, match{
+					pattern: patternDictionary,
+					token:   token,
+					i:       i,
+					j:       j,
+					guesses: float64(rank) * variations,
+				})
+			}
+
+			if rank, ok := lookup(dicts, reverse(word)); ok {
+				matches = append(matches, match{
+					pattern: patternDictionary,
+					token:   token,
+					i:       i,
+					j:       j,
+					guesses: float64(rank) * variations * 2,
+				})
+			}
+
+			for _, sub := range unl33t(lower[i : j+1]) {
+				if rank, ok := lookup(dicts, sub.word); ok {
+					matches = append(matches, match{
+						pattern: patternDictionary,
+						token:   token,
+						i:       i,
+						j:       j,
+						guesses: float64(rank) * variations * l33tVariations(sub.substitutions),
+					})
+				}
+			}
+		}
+	}
+
+	return matches
+}
+
+func lookup(dicts []map[string]int, word string) (int, bool) {
+	best, found := 0, false
+
+	for _, dict := range dicts {
+		if rank, ok := dict[word]; ok && (!found || rank < best) {
+			best, found = rank, true
+		}
+	}
+
+	return best, found
+}
+
+// l33tSubstitution is a de-l33ted word with the number of substituted
+// characters.
+type l33tSubstitution struct {
+	word          string
+	substitutions int
+}
+
+// unl33t returns possible de-l33ted spellings of the word.
+//
+// The number of variants is bounded to keep the matching cheap.
+func unl33t(word []rune) []l33tSubstitution {
+	const maxVariants = 16
+
+	variants := []l33tSubstitution{{word: "", substitutions: 0}}
+
+	for _, r := range word {
+		subs, ok := l33tTable[r]
+		if !ok {
+			for k := range variants {
+				variants[k].word += string(r)
+			}
+
+			continue
+		}
+
+		next := make([]l33tSubstitution, 0, len(variants)*len(subs))
+
+		for _, v := range variants {
+			for _, s := range subs {
+				if len(next) == maxVariants {
+					break
+				}
+
+				next = append(next, l33tSubstitution{
+					word:          v.word + string(s),
+					substitutions: v.substitutions + 1,
+				})
+			}
+		}
+
+		variants = next
+	}
+
+	return slices.DeleteFunc(variants, func(v l33tSubstitution) bool {
+		return v.substitutions == 0
+	})
+}
+
+// uppercaseVariations estimates the number of capitalization variants
+// an attacker would try to guess the token.
+func uppercaseVariations(token string) float64 {
+	var upper, lower int
+
+	for _, r := range token {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+
+	if upper == 0 {
+		return 1
+	}
+
+	runes := []rune(token)
+
+	// Common capitalizations: first letter, last letter or all letters.
+	if lower == 0 ||
+		(upper == 1 && (unicode.IsUpper(runes[0]) || unicode.IsUpper(runes[len(runes)-1]))) {
+		return 2
+	}
+
+	var variations float64
+	for k := 1; k <= min(upper, lower); k++ {
+		variations += binomial(upper+lower, k)
+	}
+
+	return variations
+}
+
+func l33tVariations(substitutions int) float64 {
+	return math.Max(2, math.Pow(2, float64(substitutions)))
+}
+
+// keyboard is a QWERTY layout, each row is shifted by half a key relative to
+// the row above it.
+//
+//nolint:gochecknoglobals
+var keyboard = newKeyboardGraph(
+	[]string{"`1234567890-=", "qwertyuiop[]\\", "asdfghjkl;'", "zxcvbnm,./"},
+	[]string{"~!@#$%^&*()_+", "QWERTYUIOP{}|", "ASDFGHJKL:\"", "ZXCVBNM<>?"},
+	[]int{0, 1, 1, 1},
+)
+
+type keyPosition struct {
+	x       float64
+	y       int
+	shifted bool
+}
+
+type keyboardGraph struct {
+	keys          map[rune]keyPosition
+	averageDegree float64
+}
+
+func newKeyboardGraph(rows, shiftedRows []string, offsets []int) keyboardGraph {
+	g := keyboardGraph{keys: make(map[rune]keyPosition), averageDegree: 0}
+
+	for y, row := range rows {
+		for c, r := range []rune(row) {
+			x := float64(c+offsets[y]) + float64(y)*0.5
+			g.keys[r] = keyPosition{x: x, y: y, shifted: false}
+			g.keys[[]rune(shiftedRows[y])[c]] = keyPosition{x: x, y: y, shifted: true}
+		}
+	}
+
+	var degrees int
+
+	for _, row := range rows {
+		for _, r := range row {
+			for _, other := range rows {
+				for _, o := range other {
+					if g.adjacent(r, o) {
+						degrees++
+					}
+				}
+			}
+		}
+	}
+
+	g.averageDegree = float64(degrees) / float64(len(g.keys)/2)
+
+	return g
+}
+
+// direction returns the direction from key a to key b, or false if
+// the keys are not adjacent.
+func (g keyboardGraph) direction(a, b rune) (int, bool) {
+	pa, oka := g.keys[a]
+	pb, okb := g.keys[b]
+
+	if !oka || !okb {
+		return 0, false
+	}
+
+	dx, dy := pb.x-pa.x, pb.y-pa.y
+
+	switch {
+	case dy == 0 && dx == 1:
+		return 1, true
+	case dy == 0 && dx == -1:
+		return 2, true
+	case dy == 1 && dx == 0.5:
+		return 3, true
+	case dy == 1 && dx == -0.5:
+		return 4, true
+	case dy == -1 && dx == 0.5:
+		return 5, true
+	case dy == -1 && dx == -0.5:
+		return 6, true
+	}
+
+	return 0, false
+}
+
+func (g keyboardGraph) adjacent(a, b rune) bool {
+	_, ok := g.direction(a, b)
+	return ok
+}
+
+// spatialMatches finds keyboard walks, e.g., qwerty or zaq1.
+func spatialMatches(password []rune) []match {
+	var matches []match
+
+	n := len(password)
+
+	for i := 0; i < n-1; {
+		j, turns, shifted := i, 0, 0
+		lastDirection := -1
+
+		if keyboard.keys[password[i]].shifted {
+			shifted++
+		}
+
+		for j+1 < n {
+			dir, ok := keyboard.direction(password[j], password[j+1])
+			if !ok {
+				break
+			}
+
+			if dir != lastDirection {
+				turns++
+				lastDirection = dir
+			}
+
+			if keyboard.keys[password[j+1]].shifted {
+				shifted++
+			}
+
+			j++
+		}
+
+		if j-i+1 >= minMatchLength {
+			matches = append(matches, match{
+				pattern: patternSpatial,
+				token:   string(password[i : j+1]),
+				i:       i,
+				j:       j,
+				guesses: spatialGuesses(j-i+1, turns, shifted),
+			})
+		}
+
+		i = max(j, i+1)
+	}
+
+	return matches
+}
+
+func spatialGuesses(length, turns, shifted int) float64 {
+	starts := float64(len(keyboard.keys))
+	degree := keyboard.averageDegree
+
+	var guesses float64
+
+	for l := 2; l <= length; l++ {
+		for t := 1; t <= min(turns, l-1); t++ {
+			guesses += binomial(l-1, t-1) * starts * math.Pow(degree, float64(t))
+		}
+	}
+
+	if shifted > 0 {
+		unshifted := length - shifted
+		if unshifted == 0 {
+			guesses *= 2
+		} else {
+			var variations float64
+			for k := 1; k <= min(shifted, unshifted); k++ {
+				variations += binomial(length, k)
+			}
+
+			guesses *= variations
+		}
+	}
+
+	return guesses
+}
+
+// repeatMatches finds repeated substrings, e.g., aaa or abcabc.
+func repeatMatches(password []rune, estimate func([]rune) float64) []match {
+	var matches []match
+
+	n := len(password)
+
+	for i := 0; i < n-1; {
+		bestEnd, bestBase := i, 0
+
+		for base := 1; base <= (n-i)/2; base++ {
+			end := i + base
+			for end+base <= n && string(password[end:end+base]) == string(password[i:i+base]) {
+				end += base
+			}
+
+			if end-1 > bestEnd {
+				bestEnd, bestBase = end-1, base
+			}
+		}
+
+		if bestBase == 0 || bestEnd-i+1 < minMatchLength {
+			i++
+			continue
+		}
+
+		count := float64((bestEnd - i + 1) / bestBase)
+
+		matches = append(matches, match{
+			pattern: patternRepeat,
+			token:   string(password[i : bestEnd+1]),
+			i:       i,
+			j:       bestEnd,
+			guesses: estimate(password[i:i+bestBase]) * count,
+		})
+
+		i = bestEnd + 1
+	}
+
+	return matches
+}
+
+// sequenceMatches finds sequences of characters with a constant step,
+// e.g., abcd, 13579 or zyx.
+func sequenceMatches(password []rune) []match {
+	var matches []match
+
+	n := len(password)
+
+	for i := 0; i < n-1; {
+		delta := int(password[i+1]) - int(password[i])
+		j := i + 1
+
+		if delta != 0 && abs(delta) <= maxSequenceDelta && sameClass(password[i], password[j]) {
+			for j+1 < n &&
+				int(password[j+1])-int(password[j]) == delta &&
+				sameClass(password[j], password[j+1]) {
+				j++
+			}
+		} else {
+			i++
+			continue
+		}
+
+		if j-i+1 >= minMatchLength {
+			matches = append(matches, match{
+				pattern: patternSequence,
+				token:   string(password[i : j+1]),
+				i:       i,
+				j:       j,
+				guesses: sequenceGuesses(password[i:j+1], delta),
+			})
+		}
+
+		i = j
+	}
+
+	return matches
+}
+
+func sameClass(a, b rune) bool {
+	return (unicode.IsDigit(a) && unicode.IsDigit(b)) ||
+		(unicode.IsLower(a) && unicode.IsLower(b)) ||
+		(unicode.IsUpper(a) && unicode.IsUpper(b))
+}
+
+func sequenceGuesses(token []rune, delta int) float64 {
+	var base float64
+
+	switch first := token[0]; {
+	case strings.ContainsRune("aAzZ019", first):
+		base = 4
+	case unicode.IsDigit(first):
+		base = 10
+	default:
+		base = 26
+	}
+
+	if delta < 0 {
+		base *= 2
+	}
+
+	return base * float64(len(token)) * float64(abs(delta))
+}
+
+// dateMatches finds years and dates, e.g., 1987, 13.05.1987 or 19870513.
+func dateMatches(password []rune) []match {
+	var matches []match
+
+	n := len(password)
+
+	for i := range n {
+		for j := i + 3; j < min(n, i+10); j++ {
+			token := string(password[i : j+1])
+
+			guesses, ok := dateGuesses(token)
+			if !ok {
+				continue
+			}
+
+			matches = append(matches, match{
+				pattern: patternDate,
+				token:   token,
+				i:       i,
+				j:       j,
+				guesses: guesses,
+			})
+		}
+	}
+
+	return matches
+}
+
+func dateGuesses(token string) (float64, bool) {
+	digits, separators := splitDate(token)
+	if digits == nil {
+		return 0, false
+	}
+
+	if len(digits) == 1 && separators == 0 {
+		if len(digits[0]) != 4 {
+			return parseCompactDate(digits[0])
+		}
+
+		year, err := strconv.Atoi(digits[0])
+		if err != nil || !isYear(year) {
+			return 0, false
+		}
+
+		return yearSpace(year), true
+	}
+
+	if len(digits) != 3 || separators != 2 {
+		return 0, false
+	}
+
+	year, ok := parseDate(digits)
+	if !ok {
+		return 0, false
+	}
+
+	// An attacker would try a few common separators.
+	return 365 * yearSpace(year) * 4, true
+}
+
+// splitDate splits the token into digit groups separated by a single kind
+// of separator.
+func splitDate(token string) ([]string, int) {
+	var sep rune
+
+	separators := 0
+
+	for _, r := range token {
+		switch {
+		case unicode.IsDigit(r):
+		case strings.ContainsRune("/\\_.- ", r) && (sep == 0 || sep == r):
+			sep = r
+			separators++
+		default:
+			return nil, 0
+		}
+	}
+
+	if sep == 0 {
+		return []string{token}, 0
+	}
+
+	return strings.Split(token, string(sep)), separators
+}
+
+// parseCompactDate parses dates without separators, e.g., 130587 or
+// 19870513.
+func parseCompactDate(s string) (float64, bool) {
+	var splits [][3]int
+
+	switch len(s) {
+	case 6:
+		splits = [][3]int{{2, 2, 2}}
+	case 8:
+		splits = [][3]int{{2, 2, 4}, {4, 2, 2}}
+	default:
+		return 0, false
+	}
+
+	for _, split := range splits {
+		parts := []string{
+			s[:split[0]],
+			s[split[0] : split[0]+split[1]],
+			s[split[0]+split[1]:],
+		}
+
+		if year, ok := parseDate(parts); ok {
+			return 365 * yearSpace(year), true
+		}
+	}
+
+	return 0, false
+}
+
+// parseDate parses day, month and year in any common order.
+func parseDate(parts []string) (int, bool) {
+	nums := make([]int, len(parts))
+
+	for i, p := range parts {
+		if len(p) == 0 || len(p) > 4 {
+			return 0, false
+		}
+
+		v, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, false
+		}
+
+		nums[i] = v
+	}
+
+	// year-month-day, day-month-year, month-day-year
+	orders := [][3]int{{0, 1, 2}, {2, 1, 0}, {2, 0, 1}}
+	for _, o := range orders {
+		year, month, day := nums[o[0]], nums[o[1]], nums[o[2]]
+		if len(parts[o[0]]) == 2 {
+			year = twoDigitYear(year)
+		} else if len(parts[o[0]]) != 4 {
+			continue
+		}
+
+		if isYear(year) && month >= 1 && month <= 12 && day >= 1 && day <= 31 {
+			return year, true
+		}
+	}
+
+	return 0, false
+}
+
+func twoDigitYear(y int) int {
+	if y > 50 {
+		return 1900 + y
+	}
+
+	return 2000 + y
+}
+
+func isYear(y int) bool { return y >= 1900 && y <= time.Now().Year()+25 }
+
+func yearSpace(year int) float64 {
+	return math.Max(float64(abs(year-time.Now().Year())), minYearSpace)
+}
+
+func binomial(n, k int) float64 {
+	if k > n {
+		return 0
+	}
+
+	r := 1.0
+	for d := 1; d <= k; d++ {
+		r = r * float64(n-k+d) / float64(d)
+	}
+
+	return r
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+
+	return string(r)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
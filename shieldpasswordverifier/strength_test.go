@@ -0,0 +1,66 @@
+package shieldpasswordverifier
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateStrength(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		password string
+		maxScore int
+		minScore int
+	}{
+		{"password", 0, 0},
+		{"P@ssw0rd", 1, 0},
+		{"qwertyuiop", 1, 0},
+		{"aaaaaaaaaaaa", 1, 0},
+		{"abcdefgh", 1, 0},
+		{"13.05.1987", 2, 0},
+		{"correct horse battery staple", 4, 4},
+		{"rWibMFACxAUGZmxhVncy", 4, 4},
+		{strings.Repeat("x", 200), 1, 0},
+		{strings.Repeat("password", 30), 2, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			t.Parallel()
+
+			s := EstimateStrength(tt.password)
+			assert.GreaterOrEqual(t, s.Score, tt.minScore, "guesses %g", s.Guesses)
+			assert.LessOrEqual(t, s.Score, tt.maxScore, "guesses %g", s.Guesses)
+		})
+	}
+}
+
+func TestStrengthVerifierForUser(t *testing.T) {
+	t.Parallel()
+
+	v, err := NewStrengthVerifier(NewStrengthConfig())
+	require.NoError(t, err)
+
+	//nolint:exhaustruct
+	user := UserContext{Email: "jdoe1987@example.com"}
+
+	err = VerifyForUser(v, "Tr0ub4dor&jdoe1987!", user)
+
+	var verr *PasswordVerificationError
+	require.ErrorAs(t, err, &verr)
+	assert.Contains(t, verr.Reasons, ReasonContainsUserInfo)
+
+	require.NoError(t, VerifyForUser(v, "correct horse battery staple", user))
+
+	// The email domain is not personal information.
+	//nolint:exhaustruct
+	err = VerifyForUser(v, "MyGmailPassword!!2", UserContext{Email: "a@gmail.com"})
+	if errors.As(err, &verr) {
+		assert.NotContains(t, verr.Reasons, ReasonContainsUserInfo)
+	}
+}
@@ -0,0 +1,62 @@
+package shieldpasswordverifier
+
+import "strings"
+
+// UserContext is information about the user whose password is verified.
+//
+// It allows verifiers to reject passwords derived from the user's personal
+// information.
+type UserContext struct {
+	Email string
+	Name  string
+
+	// Inputs are additional user-specific words, e.g., a username or
+	// a company name.
+	Inputs []string
+}
+
+// words returns lower-cased words derived from the user context.
+func (u UserContext) words() []string {
+	words := make([]string, 0, len(u.Inputs)+4)
+
+	// Only the local part of the email is personal, the domain is often
+	// shared with many users, e.g., a public mail provider.
+	if local, _, ok := strings.Cut(u.Email, "@"); ok {
+		words = append(words, local)
+		words = append(words, strings.FieldsFunc(local, isSeparator)...)
+	} else if u.Email != "" {
+		words = append(words, u.Email)
+	}
+
+	words = append(words, strings.FieldsFunc(u.Name, isSeparator)...)
+	words = append(words, u.Inputs...)
+
+	for i, w := range words {
+		words[i] = strings.ToLower(w)
+	}
+
+	return words
+}
+
+func isSeparator(r rune) bool {
+	return strings.ContainsRune(" ._-+", r)
+}
+
+// UserPasswordVerifier is a PasswordVerifier that takes the user's
+// personal information into account.
+type UserPasswordVerifier interface {
+	PasswordVerifier
+
+	// VerifyForUser verifies the strength of the password of the given user.
+	VerifyForUser(password string, user UserContext) error
+}
+
+// VerifyForUser verifies the password with v, passing the user context if
+// v is a UserPasswordVerifier.
+func VerifyForUser(v PasswordVerifier, password string, user UserContext) error {
+	if uv, ok := v.(UserPasswordVerifier); ok {
+		return uv.VerifyForUser(password, user)
+	}
+
+	return v.Verify(password)
+}
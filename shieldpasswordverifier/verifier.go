@@ -13,6 +13,7 @@ type Reason string
 
 const (
 	ReasonPasswordToShort      Reason = "Password is too short"
+	ReasonPasswordTooLong      Reason = "Password is too long"
 	ReasonMissingRequiredChars Reason = "Password is missing required characters"
 )
 
@@ -25,9 +26,26 @@ func (e *PasswordVerificationError) Error() string {
 	return e.message
 }
 
+func newPasswordVerificationError(reasons []Reason) *PasswordVerificationError {
+	messages := make([]string, len(reasons))
+	for i, r := range reasons {
+		messages[i] = string(r)
+	}
+
+	return &PasswordVerificationError{
+		message: strings.Join(messages, ", "),
+		Reasons: reasons,
+	}
+}
+
 type Config struct {
 	RequiredChars PasswordRequiredChars
 	MinLength     int
+
+	// MaxLength is the maximal length of the password.
+	//
+	// If zero, the length is not limited.
+	MaxLength int // optional
 }
 
 // NewConfig creates a new Config with defaults.
@@ -75,26 +93,29 @@ func New(config *Config) (PasswordVerifier, error) {
 }
 
 // Verify verifies the strongness password.
+//
+// All failed checks are reported in the returned
+// *PasswordVerificationError.
 func (v *passwordVerifier) Verify(password string) error {
 	var reasons []Reason
 
-	var messages []string
-
 	if len(password) < v.config.MinLength {
 		reasons = append(reasons, ReasonPasswordToShort)
 	}
 
+	if v.config.MaxLength > 0 && len(password) > v.config.MaxLength {
+		reasons = append(reasons, ReasonPasswordTooLong)
+	}
+
 	for _, requiredCharsPart := range v.config.RequiredChars {
 		if !strings.ContainsAny(password, requiredCharsPart) {
 			reasons = append(reasons, ReasonMissingRequiredChars)
+			break
 		}
+	}
 
-		if len(reasons) > 0 {
-			return &PasswordVerificationError{
-				message: strings.Join(messages, ", "),
-				Reasons: reasons,
-			}
-		}
+	if len(reasons) > 0 {
+		return newPasswordVerificationError(reasons)
 	}
 
 	return nil
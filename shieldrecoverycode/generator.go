@@ -0,0 +1,174 @@
+package shieldrecoverycode
+
+import (
+	"cmp"
+	"crypto/rand"
+	"fmt"
+	"strings"
+
+	"go.inout.gg/foundations/debug"
+)
+
+var _ Generator = (*generator)(nil)
+
+const (
+	// DefaultAlphabet is a base32 alphabet without ambiguous characters,
+	// i.e., 0, 1, I and O.
+	DefaultAlphabet  = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+	DefaultSeparator = "-"
+	DefaultGroupSize = 4
+)
+
+//nolint:gochecknoglobals
+var DefaultGenerator = NewGenerator(nil)
+
+// Generator provides methods to create a set of unique recovery codes used
+// for 2FA authentication recovery.
+type Generator interface {
+	// Generate creates cnt recovery codes of l characters each,
+	// formatted for display.
+	Generate(cnt, l int) ([]string, error)
+
+	// Normalize converts a user-provided code into the canonical form,
+	// which is the one that is hashed, e.g., by removing separators.
+	Normalize(code string) string
+}
+
+// GeneratorConfig is the configuration for the recovery code generator.
+type GeneratorConfig struct {
+	// Alphabet is the set of characters codes consist of.
+	//
+	// Defaults to DefaultAlphabet.
+	Alphabet string // optional
+
+	// Separator is inserted between groups of characters.
+	//
+	// Defaults to DefaultSeparator.
+	Separator string // optional
+
+	// GroupSize is the number of characters in a group, e.g., 4 for
+	// XXXX-XXXX. Set to a negative value to disable grouping.
+	//
+	// Defaults to DefaultGroupSize.
+	GroupSize int // optional
+}
+
+func (c *GeneratorConfig) defaults() {
+	c.Alphabet = cmp.Or(c.Alphabet, DefaultAlphabet)
+	c.Separator = cmp.Or(c.Separator, DefaultSeparator)
+	c.GroupSize = cmp.Or(c.GroupSize, DefaultGroupSize)
+}
+
+func (c *GeneratorConfig) assert() {
+	debug.Assert(
+		len(c.Alphabet) >= 2 && len(c.Alphabet) <= 256,
+		"Alphabet must contain between 2 and 256 characters",
+	)
+	debug.Assert(
+		!strings.ContainsAny(c.Alphabet, c.Separator),
+		"Alphabet must not contain Separator",
+	)
+}
+
+type generator struct {
+	config *GeneratorConfig
+}
+
+// NewGenerator creates a new generator producing codes, such as
+// XXXX-XXXX-XXXX-XXXX.
+//
+// If config is nil, the default config is used.
+func NewGenerator(config *GeneratorConfig) Generator {
+	if config == nil {
+		//nolint:exhaustruct
+		config = &GeneratorConfig{}
+	}
+
+	config.defaults()
+	config.assert()
+
+	return &generator{config}
+}
+
+// Generate creates count number of secure random recovery codes.
+// Each code is length characters long, not counting separators.
+func (g *generator) Generate(count, length int) ([]string, error) {
+	codes := make([]string, count)
+
+	for i := range count {
+		code, err := g.generate(length)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"shield/recovery_code: failed to generate recovery code: %w",
+				err,
+			)
+		}
+
+		codes[i] = g.format(code)
+	}
+
+	return codes, nil
+}
+
+// Normalize removes separators and whitespace, and upper-cases the code
+// if the alphabet has no lower-case characters.
+func (g *generator) Normalize(code string) string {
+	code = strings.ReplaceAll(code, g.config.Separator, "")
+	code = strings.Join(strings.Fields(code), "")
+
+	if strings.ToUpper(g.config.Alphabet) == g.config.Alphabet {
+		code = strings.ToUpper(code)
+	}
+
+	return code
+}
+
+// generate returns a random string of length l.
+//
+// Bytes that would bias the distribution are rejected.
+func (g *generator) generate(l int) (string, error) {
+	alphabet := g.config.Alphabet
+	limit := 256 - 256%len(alphabet)
+
+	var (
+		b   strings.Builder
+		buf = make([]byte, l)
+	)
+
+	b.Grow(l)
+
+	for b.Len() < l {
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("shield/recovery_code: failed to read random bytes: %w", err)
+		}
+
+		for _, c := range buf {
+			if int(c) >= limit {
+				continue
+			}
+
+			b.WriteByte(alphabet[int(c)%len(alphabet)])
+
+			if b.Len() == l {
+				break
+			}
+		}
+	}
+
+	return b.String(), nil
+}
+
+// format splits the code into groups.
+func (g *generator) format(code string) string {
+	size := g.config.GroupSize
+	if size <= 0 || len(code) <= size {
+		return code
+	}
+
+	groups := make([]string, 0, (len(code)+size-1)/size)
+	for i := 0; i < len(code); i += size {
+		groups = append(groups, code[i:min(i+size, len(code))])
+	}
+
+	return strings.Join(groups, g.config.Separator)
+}
@@ -0,0 +1,29 @@
+package shieldrecoverycode
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerator(t *testing.T) {
+	t.Parallel()
+
+	g := NewGenerator(nil)
+
+	codes, err := g.Generate(8, 16)
+	require.NoError(t, err)
+	assert.Len(t, codes, 8)
+
+	for _, code := range codes {
+		assert.Len(t, code, 19)
+		assert.Len(t, strings.Split(code, "-"), 4)
+
+		normalized := g.Normalize(code)
+		assert.Len(t, normalized, 16)
+		assert.Equal(t, normalized, g.Normalize(strings.ToLower(code)))
+		assert.Empty(t, strings.Trim(normalized, DefaultAlphabet))
+	}
+}
@@ -3,65 +3,55 @@ package shieldrecoverycode
 import (
 	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.inout.gg/foundations/dbsql"
 	"go.inout.gg/foundations/debug"
 	"go.jetify.com/typeid/v2"
 
 	"go.inout.gg/shield"
 	"go.inout.gg/shield/internal/dbsqlc"
-	"go.inout.gg/shield/internal/random"
+	"go.inout.gg/shield/internal/sliceutil"
 	"go.inout.gg/shield/internal/tid"
 	"go.inout.gg/shield/shieldpassword"
 )
 
-var _ Generator = (*generator)(nil)
-
 const (
 	DefaultRecoveryCodeTotalCount = 16
 	DefaultRecoveryCodeLength     = 16
 )
 
-//nolint:gochecknoglobals
-var DefaultGenerator Generator = &generator{}
-
-// Generator provides methods to create a set of unique recovery codes used
-// for 2FA authentication recovery.
-type Generator interface {
-	Generate(cnt, l int) ([]string, error)
-}
-
-type generator struct{}
-
-// Generate creates count number of secure random recovery codes.
-// Each code is length bytes long and encoded as a hex string.
-func (g *generator) Generate(count, length int) ([]string, error) {
-	codes := make([]string, count)
+// ErrRecoveryCodeIncorrect is returned when the recovery code doesn't match
+// any of the user's usable recovery codes.
+var ErrRecoveryCodeIncorrect = errors.New(
+	"shield/recovery_code: recovery code incorrect",
+)
 
-	for i := range count {
-		code, err := random.SecureHexString(length)
-		if err != nil {
-			return nil, fmt.Errorf(
-				"shieldrecoverycode: failed to generate recovery code: %w",
-				err,
-			)
-		}
+type Config struct {
+	Logger *slog.Logger
 
-		codes[i] = code
-	}
+	// RecoveryCodeHasher hashes recovery codes.
+	//
+	// Defaults to a hasher using PasswordHasher.
+	RecoveryCodeHasher RecoveryCodeHasher
 
-	return codes, nil
-}
+	// PasswordHasher is used to hash recovery codes, unless
+	// RecoveryCodeHasher is set.
+	//
+	// Defaults to shieldpassword.DefaultPasswordHasher.
+	PasswordHasher shieldpassword.PasswordHasher
 
-type Config struct {
-	Logger                 *slog.Logger
-	PasswordHasher         shieldpassword.PasswordHasher
 	Generator              Generator
 	RecoveryCodeTotalCount int
-	RecoveryCodeLength     int
+
+	// RecoveryCodeLength is the number of characters in a recovery code,
+	// not counting separators.
+	RecoveryCodeLength int
 }
 
 func NewConfig(opts ...func(*Config)) *Config {
@@ -82,6 +72,10 @@ func (c *Config) defaults() {
 		c.PasswordHasher,
 		shieldpassword.DefaultPasswordHasher,
 	)
+	if c.RecoveryCodeHasher == nil {
+		c.RecoveryCodeHasher = NewPasswordRecoveryCodeHasher(c.PasswordHasher)
+	}
+
 	c.Logger = cmp.Or(c.Logger, shield.DefaultLogger)
 	c.RecoveryCodeTotalCount = cmp.Or(
 		c.RecoveryCodeTotalCount,
@@ -100,6 +94,10 @@ func (c *Config) assert() {
 		c.PasswordHasher != nil,
 		"expected PasswordHasher to be defined",
 	)
+	debug.Assert(
+		c.RecoveryCodeHasher != nil,
+		"expected RecoveryCodeHasher to be defined",
+	)
 	debug.Assert(c.Generator != nil, "expected Generator to be defined")
 }
 
@@ -119,48 +117,54 @@ func New(pool *pgxpool.Pool, config *Config) *Handler {
 	return &h
 }
 
-func (h *Handler) Generate() ([]string, error) {
+// Generate creates a new set of recovery codes.
+//
+// It returns both the plaintext codes to be shown to the user and
+// their hashes to be stored.
+func (h *Handler) Generate() ([]string, []HashedRecoveryCode, error) {
 	codes, err := h.config.Generator.Generate(
 		h.config.RecoveryCodeTotalCount,
 		h.config.RecoveryCodeLength,
 	)
 	if err != nil {
-		return nil, fmt.Errorf(
+		return nil, nil, fmt.Errorf(
 			"shieldrecoverycode: failed to generate recovery codes: %w",
 			err,
 		)
 	}
 
-	hashedCodes := make([]string, len(codes))
+	hashedCodes := make([]HashedRecoveryCode, len(codes))
 
 	for i, code := range codes {
-		hashedCode, err := h.config.PasswordHasher.Hash(code)
+		hashedCode, err := h.config.RecoveryCodeHasher.Hash(
+			h.config.Generator.Normalize(code),
+		)
 		if err != nil {
-			return nil, fmt.Errorf(
-				"shieldrecoverycode: failed to hash recovery code: %w",
-				err,
-			)
+			return nil, nil, err
 		}
 
 		hashedCodes[i] = hashedCode
 	}
 
-	return hashedCodes, nil
+	return codes, hashedCodes, nil
 }
 
 // CreateRecoveryCodes generates a new set of recovery codes.
+//
+// The plaintext codes are returned, so they can be shown to the user.
+// Only their hashes are stored, so it's the only time they are available.
 func (h *Handler) CreateRecoveryCodes(
 	ctx context.Context,
 	userID typeid.TypeID,
-) error {
-	codes, err := h.Generate()
+) ([]string, error) {
+	codes, hashedCodes, err := h.Generate()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	tx, err := h.pool.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf(
+		return nil, fmt.Errorf(
 			"shield/recovery_code: failed to begin transaction: %w",
 			err,
 		)
@@ -168,34 +172,40 @@ func (h *Handler) CreateRecoveryCodes(
 
 	defer func() { _ = tx.Rollback(ctx) }()
 
-	if err := h.CreateRecoveryCodesInTx(ctx, userID, codes, tx); err != nil {
-		return err
+	if err := h.CreateRecoveryCodesInTx(ctx, userID, hashedCodes, tx); err != nil {
+		return nil, err
 	}
 
 	if err := tx.Commit(ctx); err != nil {
-		return fmt.Errorf(
+		return nil, fmt.Errorf(
 			"shield/recovery_code: failed to commit transaction: %w",
 			err,
 		)
 	}
 
-	return nil
+	return codes, nil
 }
 
+// ReplaceRecoveryCodes evicts the user's recovery codes and generates
+// a new set.
+//
 // userID is the ID of the user to update recovery codes for.
+//
+// The plaintext codes are returned, so they can be shown to the user.
+// Only their hashes are stored, so it's the only time they are available.
 func (h *Handler) ReplaceRecoveryCodes(
 	ctx context.Context,
 	userID typeid.TypeID,
 	replacedBy *typeid.TypeID,
-) error {
-	codes, err := h.Generate()
+) ([]string, error) {
+	codes, hashedCodes, err := h.Generate()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	tx, err := h.pool.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf(
+		return nil, fmt.Errorf(
 			"shield/recovery_code: failed to begin transaction: %w",
 			err,
 		)
@@ -203,32 +213,34 @@ func (h *Handler) ReplaceRecoveryCodes(
 
 	defer func() { _ = tx.Rollback(ctx) }()
 
-	if err := h.ReplaceRecoveryCodesInTx(ctx, userID, replacedBy, codes, tx); err != nil {
-		return err
+	if err := h.ReplaceRecoveryCodesInTx(ctx, userID, replacedBy, hashedCodes, tx); err != nil {
+		return nil, err
 	}
 
 	if err := tx.Commit(ctx); err != nil {
-		return fmt.Errorf(
+		return nil, fmt.Errorf(
 			"shield/recovery_code: failed to commit transaction: %w",
 			err,
 		)
 	}
 
-	return nil
+	return codes, nil
 }
 
+// ReplaceRecoveryCodesInTx evicts the user's recovery codes and stores
+// hashedCodes as the new ones.
 func (h *Handler) ReplaceRecoveryCodesInTx(
 	ctx context.Context,
 	userID typeid.TypeID,
 	replacedBy *typeid.TypeID,
-	codes []string,
+	hashedCodes []HashedRecoveryCode,
 	tx pgx.Tx,
 ) error {
 	if err := h.EvictRecoveryCodesInTx(ctx, userID, replacedBy, tx); err != nil {
 		return err
 	}
 
-	if err := h.CreateRecoveryCodesInTx(ctx, userID, codes, tx); err != nil {
+	if err := h.CreateRecoveryCodesInTx(ctx, userID, hashedCodes, tx); err != nil {
 		return err
 	}
 
@@ -255,19 +267,26 @@ func (h *Handler) EvictRecoveryCodesInTx(
 	return nil
 }
 
+// CreateRecoveryCodesInTx stores hashedCodes as the user's recovery codes.
 func (h *Handler) CreateRecoveryCodesInTx(
 	ctx context.Context,
 	userID typeid.TypeID,
-	codes []string,
+	hashedCodes []HashedRecoveryCode,
 	tx pgx.Tx,
 ) error {
-	rows := make([]dbsqlc.CreateRecoveryCodeBatchParams, len(codes))
-	for i, code := range codes {
+	rows := make([]dbsqlc.CreateRecoveryCodeBatchParams, len(hashedCodes))
+	for i, code := range hashedCodes {
+		var lookup *string
+		if code.Lookup != "" {
+			lookup = &code.Lookup
+		}
+
 		rows[i] = dbsqlc.CreateRecoveryCodeBatchParams{
-			ID:               tid.MustRecoveryKeyID(),
-			IsConsumable:     true,
-			RecoveryCodeHash: code,
-			UserID:           userID,
+			ID:                 tid.MustRecoveryKeyID(),
+			IsConsumable:       true,
+			RecoveryCodeHash:   code.Hash,
+			RecoveryCodeLookup: lookup,
+			UserID:             userID,
 		}
 	}
 
@@ -281,6 +300,173 @@ func (h *Handler) CreateRecoveryCodesInTx(
 	return nil
 }
 
+// ConsumeRecoveryCode checks the code against the user's recovery codes
+// that are neither evicted nor consumed, and marks the matched code as
+// consumed.
+//
+// If the configured RecoveryCodeHasher supports lookups, the code is found
+// with a single query, otherwise it's verified against every usable code.
+//
+// The code is consumed with a conditional update, so it can't be used twice
+// even by concurrent requests.
+//
+// Codes issued by the previous generator, i.e., lower-case hex codes
+// hashed as is, are accepted as well.
+//
+// ConsumeRecoveryCode can be used as a second factor verifier, e.g.,
+// shieldmfa.VerifierFunc(h.ConsumeRecoveryCode).
+func (h *Handler) ConsumeRecoveryCode(
+	ctx context.Context,
+	userID typeid.TypeID,
+	code string,
+) error {
+	normalized := h.config.Generator.Normalize(code)
+
+	err := h.consumeRecoveryCode(ctx, userID, normalized)
+	if !errors.Is(err, ErrRecoveryCodeIncorrect) {
+		return err
+	}
+
+	// Legacy codes were hashed without normalization.
+	if legacy := strings.TrimSpace(code); legacy != normalized {
+		return h.consumeRecoveryCode(ctx, userID, legacy)
+	}
+
+	return err
+}
+
+// consumeRecoveryCode consumes the user's recovery code matching the code
+// as is.
+func (h *Handler) consumeRecoveryCode(
+	ctx context.Context,
+	userID typeid.TypeID,
+	code string,
+) error {
+	codes, err := h.findUsableRecoveryCodes(ctx, userID, code)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range codes {
+		ok, err := h.config.RecoveryCodeHasher.Verify(c.RecoveryCodeHash, code)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			continue
+		}
+
+		// Non-consumable codes are reusable.
+		if !c.IsConsumable {
+			return nil
+		}
+
+		n, err := dbsqlc.New().ConsumeRecoveryCode(ctx, h.pool, c.ID)
+		if err != nil {
+			return fmt.Errorf(
+				"shield/recovery_code: failed to consume recovery code: %w",
+				err,
+			)
+		}
+
+		// The code has been consumed concurrently.
+		if n == 0 {
+			return ErrRecoveryCodeIncorrect
+		}
+
+		return nil
+	}
+
+	return ErrRecoveryCodeIncorrect
+}
+
+// findUsableRecoveryCodes returns the user's recovery codes that
+// the code should be verified against.
+func (h *Handler) findUsableRecoveryCodes(
+	ctx context.Context,
+	userID typeid.TypeID,
+	code string,
+) ([]dbsqlc.FindUsableRecoveryCodesByUserIDRow, error) {
+	q := dbsqlc.New()
+
+	lookup := h.config.RecoveryCodeHasher.Lookup(code)
+	if lookup == "" {
+		codes, err := q.FindUsableRecoveryCodesByUserID(ctx, h.pool, userID)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"shield/recovery_code: failed to find recovery codes: %w",
+				err,
+			)
+		}
+
+		return codes, nil
+	}
+
+	c, err := q.FindUsableRecoveryCodeByLookup(
+		ctx,
+		h.pool,
+		dbsqlc.FindUsableRecoveryCodeByLookupParams{
+			UserID:             userID,
+			RecoveryCodeLookup: &lookup,
+		},
+	)
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			return h.findUsableLegacyRecoveryCodes(ctx, userID)
+		}
+
+		return nil, fmt.Errorf(
+			"shield/recovery_code: failed to find recovery code: %w",
+			err,
+		)
+	}
+
+	return []dbsqlc.FindUsableRecoveryCodesByUserIDRow{
+		dbsqlc.FindUsableRecoveryCodesByUserIDRow(c),
+	}, nil
+}
+
+// findUsableLegacyRecoveryCodes returns the user's recovery codes stored
+// without a lookup key, e.g., issued before switching to a hasher supporting
+// lookups.
+func (h *Handler) findUsableLegacyRecoveryCodes(
+	ctx context.Context,
+	userID typeid.TypeID,
+) ([]dbsqlc.FindUsableRecoveryCodesByUserIDRow, error) {
+	codes, err := dbsqlc.New().FindUsableLegacyRecoveryCodesByUserID(ctx, h.pool, userID)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"shield/recovery_code: failed to find recovery codes: %w",
+			err,
+		)
+	}
+
+	return sliceutil.Map(
+		codes,
+		func(c dbsqlc.FindUsableLegacyRecoveryCodesByUserIDRow) dbsqlc.FindUsableRecoveryCodesByUserIDRow {
+			return dbsqlc.FindUsableRecoveryCodesByUserIDRow(c)
+		},
+	), nil
+}
+
+// RemainingRecoveryCodes returns the number of the user's recovery codes
+// that can still be consumed.
+func (h *Handler) RemainingRecoveryCodes(
+	ctx context.Context,
+	userID typeid.TypeID,
+) (int, error) {
+	count, err := dbsqlc.New().CountRemainingRecoveryCodes(ctx, h.pool, userID)
+	if err != nil {
+		return 0, fmt.Errorf(
+			"shield/recovery_code: failed to count recovery codes: %w",
+			err,
+		)
+	}
+
+	return int(count), nil
+}
+
 func (h *Handler) assert() {
 	h.config.assert()
 	debug.Assert(h.pool != nil, "expected pool to be defined")
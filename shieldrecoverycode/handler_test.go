@@ -0,0 +1,192 @@
+package shieldrecoverycode
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"go.inout.gg/shield/internal/random"
+	"go.inout.gg/shield/internal/testutil"
+	"go.inout.gg/shield/shieldpassword"
+)
+
+//nolint:gochecknoglobals
+var testHMACKey = []byte(strings.Repeat("k", 32))
+
+// newHandler returns a handler issuing 4 codes hashed with the hasher.
+func newHandler(t *testing.T, pool *pgxpool.Pool, hasher RecoveryCodeHasher) *Handler {
+	t.Helper()
+
+	return New(pool, NewConfig(func(c *Config) {
+		c.RecoveryCodeHasher = hasher
+		c.RecoveryCodeTotalCount = 4
+	}))
+}
+
+func TestConsumeRecoveryCode(t *testing.T) {
+	t.Parallel()
+
+	hashers := map[string]RecoveryCodeHasher{
+		"hmac":     NewHMACRecoveryCodeHasher(testHMACKey, nil),
+		"password": NewPasswordRecoveryCodeHasher(shieldpassword.NewBcryptPasswordHasher(bcrypt.MinCost)),
+	}
+
+	for name, hasher := range hashers {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			t.Run("single use", func(t *testing.T) {
+				t.Parallel()
+
+				pool := testutil.NewPool(t)
+				h := newHandler(t, pool, hasher)
+				user := testutil.CreateUser(t, pool, testutil.Email(), true)
+
+				codes, err := h.CreateRecoveryCodes(t.Context(), user.ID)
+				require.NoError(t, err)
+				require.Len(t, codes, 4)
+
+				require.NoError(t, h.ConsumeRecoveryCode(t.Context(), user.ID, codes[0]))
+				require.ErrorIs(t, h.ConsumeRecoveryCode(t.Context(), user.ID, codes[0]), ErrRecoveryCodeIncorrect)
+
+				// Codes are accepted as typed by users.
+				require.NoError(t, h.ConsumeRecoveryCode(t.Context(), user.ID, " "+strings.ToLower(codes[1])+" "))
+
+				remaining, err := h.RemainingRecoveryCodes(t.Context(), user.ID)
+				require.NoError(t, err)
+				assert.Equal(t, 2, remaining)
+			})
+
+			t.Run("incorrect code", func(t *testing.T) {
+				t.Parallel()
+
+				pool := testutil.NewPool(t)
+				h := newHandler(t, pool, hasher)
+				user := testutil.CreateUser(t, pool, testutil.Email(), true)
+				other := testutil.CreateUser(t, pool, testutil.Email(), true)
+
+				codes, err := h.CreateRecoveryCodes(t.Context(), user.ID)
+				require.NoError(t, err)
+
+				require.ErrorIs(t, h.ConsumeRecoveryCode(t.Context(), user.ID, "2345-6789-ABCD-EFGH"), ErrRecoveryCodeIncorrect)
+				require.ErrorIs(t, h.ConsumeRecoveryCode(t.Context(), other.ID, codes[0]), ErrRecoveryCodeIncorrect)
+
+				remaining, err := h.RemainingRecoveryCodes(t.Context(), user.ID)
+				require.NoError(t, err)
+				assert.Equal(t, 4, remaining)
+			})
+
+			t.Run("replaced codes", func(t *testing.T) {
+				t.Parallel()
+
+				pool := testutil.NewPool(t)
+				h := newHandler(t, pool, hasher)
+				user := testutil.CreateUser(t, pool, testutil.Email(), true)
+
+				oldCodes, err := h.CreateRecoveryCodes(t.Context(), user.ID)
+				require.NoError(t, err)
+
+				codes, err := h.ReplaceRecoveryCodes(t.Context(), user.ID, &user.ID)
+				require.NoError(t, err)
+
+				require.ErrorIs(t, h.ConsumeRecoveryCode(t.Context(), user.ID, oldCodes[0]), ErrRecoveryCodeIncorrect)
+				require.NoError(t, h.ConsumeRecoveryCode(t.Context(), user.ID, codes[0]))
+
+				remaining, err := h.RemainingRecoveryCodes(t.Context(), user.ID)
+				require.NoError(t, err)
+				assert.Equal(t, 3, remaining)
+			})
+
+			t.Run("concurrent redemption", func(t *testing.T) {
+				t.Parallel()
+
+				pool := testutil.NewPool(t)
+				h := newHandler(t, pool, hasher)
+				user := testutil.CreateUser(t, pool, testutil.Email(), true)
+
+				codes, err := h.CreateRecoveryCodes(t.Context(), user.ID)
+				require.NoError(t, err)
+
+				const n = 8
+
+				var wg sync.WaitGroup
+
+				errs := make([]error, n)
+				for i := range n {
+					wg.Go(func() { errs[i] = h.ConsumeRecoveryCode(t.Context(), user.ID, codes[0]) })
+				}
+
+				wg.Wait()
+
+				succeeded := 0
+
+				for _, err := range errs {
+					if err == nil {
+						succeeded++
+						continue
+					}
+
+					require.ErrorIs(t, err, ErrRecoveryCodeIncorrect)
+				}
+
+				assert.Equal(t, 1, succeeded)
+
+				remaining, err := h.RemainingRecoveryCodes(t.Context(), user.ID)
+				require.NoError(t, err)
+				assert.Equal(t, 3, remaining)
+			})
+		})
+	}
+}
+
+func TestConsumeRecoveryCodeLegacy(t *testing.T) {
+	t.Parallel()
+
+	pool := testutil.NewPool(t)
+	hasher := NewPasswordRecoveryCodeHasher(shieldpassword.NewBcryptPasswordHasher(bcrypt.MinCost))
+	h := newHandler(t, pool, hasher)
+	user := testutil.CreateUser(t, pool, testutil.Email(), true)
+
+	// Codes used to be lower-case hex strings hashed as is.
+	code, err := random.SecureHexString(DefaultRecoveryCodeLength)
+	require.NoError(t, err)
+
+	hashedCode, err := hasher.Hash(code)
+	require.NoError(t, err)
+
+	tx, err := pool.Begin(t.Context())
+	require.NoError(t, err)
+	require.NoError(t, h.CreateRecoveryCodesInTx(t.Context(), user.ID, []HashedRecoveryCode{hashedCode}, tx))
+	require.NoError(t, tx.Commit(t.Context()))
+
+	require.NoError(t, h.ConsumeRecoveryCode(t.Context(), user.ID, code))
+	require.ErrorIs(t, h.ConsumeRecoveryCode(t.Context(), user.ID, code), ErrRecoveryCodeIncorrect)
+
+	remaining, err := h.RemainingRecoveryCodes(t.Context(), user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, remaining)
+}
+
+func TestConsumeRecoveryCodeSwitchedHasher(t *testing.T) {
+	t.Parallel()
+
+	pool := testutil.NewPool(t)
+	legacy := shieldpassword.NewBcryptPasswordHasher(bcrypt.MinCost)
+	user := testutil.CreateUser(t, pool, testutil.Email(), true)
+
+	codes, err := newHandler(t, pool, NewPasswordRecoveryCodeHasher(legacy)).CreateRecoveryCodes(t.Context(), user.ID)
+	require.NoError(t, err)
+
+	h := newHandler(t, pool, NewHMACRecoveryCodeHasher(testHMACKey, legacy))
+	require.NoError(t, h.ConsumeRecoveryCode(t.Context(), user.ID, codes[0]))
+	require.ErrorIs(t, h.ConsumeRecoveryCode(t.Context(), user.ID, codes[0]), ErrRecoveryCodeIncorrect)
+
+	remaining, err := h.RemainingRecoveryCodes(t.Context(), user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, remaining)
+}
@@ -0,0 +1,151 @@
+package shieldrecoverycode
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"go.inout.gg/foundations/debug"
+
+	"go.inout.gg/shield/shieldpassword"
+)
+
+var (
+	_ RecoveryCodeHasher = (*passwordRecoveryCodeHasher)(nil)
+	_ RecoveryCodeHasher = (*hmacRecoveryCodeHasher)(nil)
+)
+
+// HashedRecoveryCode is a hashed recovery code ready to be stored.
+type HashedRecoveryCode struct {
+	Hash string
+
+	// Lookup is a deterministic key used to find the code, or an empty
+	// string if the hasher doesn't support lookups.
+	Lookup string
+}
+
+// RecoveryCodeHasher hashes recovery codes.
+//
+// Hashers supporting lookups allow to find a code with a single indexed
+// query, instead of verifying the code against every stored hash.
+//
+// Note that changing the hasher makes the previously issued codes unusable,
+// unless the new hasher is able to verify them, e.g., an HMAC hasher with
+// a legacy password hasher.
+type RecoveryCodeHasher interface {
+	Hash(code string) (HashedRecoveryCode, error)
+	Verify(hashedCode string, code string) (bool, error)
+
+	// Lookup returns the lookup key of the code, or an empty string if
+	// the hasher doesn't support lookups.
+	Lookup(code string) string
+}
+
+type passwordRecoveryCodeHasher struct {
+	hasher shieldpassword.PasswordHasher
+}
+
+// NewPasswordRecoveryCodeHasher creates a recovery code hasher using
+// a password hashing algorithm.
+//
+// It doesn't support lookups, so a code is verified against all of the user's
+// codes. Prefer NewHMACRecoveryCodeHasher, as recovery codes are high-entropy
+// random values and don't need to be protected with a slow hash.
+func NewPasswordRecoveryCodeHasher(
+	hasher shieldpassword.PasswordHasher,
+) RecoveryCodeHasher {
+	debug.Assert(hasher != nil, "hasher must be set")
+	return &passwordRecoveryCodeHasher{hasher}
+}
+
+func (h *passwordRecoveryCodeHasher) Hash(code string) (HashedRecoveryCode, error) {
+	hash, err := h.hasher.Hash(code)
+	if err != nil {
+		return HashedRecoveryCode{Hash: "", Lookup: ""}, fmt.Errorf(
+			"shield/recovery_code: failed to hash recovery code: %w",
+			err,
+		)
+	}
+
+	return HashedRecoveryCode{Hash: hash, Lookup: ""}, nil
+}
+
+func (h *passwordRecoveryCodeHasher) Verify(hashedCode, code string) (bool, error) {
+	ok, err := h.hasher.Verify(hashedCode, code)
+	if err != nil {
+		return false, fmt.Errorf(
+			"shield/recovery_code: failed to verify recovery code: %w",
+			err,
+		)
+	}
+
+	return ok, nil
+}
+
+func (h *passwordRecoveryCodeHasher) Lookup(string) string { return "" }
+
+type hmacRecoveryCodeHasher struct {
+	key    []byte
+	legacy shieldpassword.PasswordHasher
+}
+
+// NewHMACRecoveryCodeHasher creates a recovery code hasher using HMAC-SHA256
+// keyed with key.
+//
+// The key must be kept outside of the database and be at least 32 bytes long.
+//
+// If legacy is set, codes issued with a password hasher, e.g., the default
+// one, are verified with legacy, so they remain usable after switching
+// to HMAC. Pass nil if there are no such codes.
+func NewHMACRecoveryCodeHasher(
+	key []byte,
+	legacy shieldpassword.PasswordHasher,
+) RecoveryCodeHasher {
+	debug.Assert(len(key) >= 32, "key must be at least 32 bytes long")
+	return &hmacRecoveryCodeHasher{key, legacy}
+}
+
+func (h *hmacRecoveryCodeHasher) Hash(code string) (HashedRecoveryCode, error) {
+	hash := h.Lookup(code)
+	return HashedRecoveryCode{Hash: hash, Lookup: hash}, nil
+}
+
+func (h *hmacRecoveryCodeHasher) Verify(hashedCode, code string) (bool, error) {
+	// Password hashes are in the PHC-like format, e.g., "$2a$...",
+	// while HMAC hashes are hex encoded.
+	if strings.HasPrefix(hashedCode, "$") {
+		if h.legacy == nil {
+			return false, nil
+		}
+
+		ok, err := h.legacy.Verify(hashedCode, code)
+		if err != nil {
+			return false, fmt.Errorf(
+				"shield/recovery_code: failed to verify recovery code: %w",
+				err,
+			)
+		}
+
+		return ok, nil
+	}
+
+	expected, err := hex.DecodeString(hashedCode)
+	if err != nil {
+		return false, nil //nolint:nilerr
+	}
+
+	return hmac.Equal(expected, h.sum(code)), nil
+}
+
+func (h *hmacRecoveryCodeHasher) Lookup(code string) string {
+	return hex.EncodeToString(h.sum(code))
+}
+
+func (h *hmacRecoveryCodeHasher) sum(code string) []byte {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write([]byte(code))
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,102 @@
+package shieldrecoverycode
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"go.inout.gg/shield/shieldpassword"
+)
+
+func TestHMACRecoveryCodeHasher(t *testing.T) {
+	t.Parallel()
+
+	t.Run("verify", func(t *testing.T) {
+		t.Parallel()
+
+		hasher := NewHMACRecoveryCodeHasher(testHMACKey, nil)
+
+		hashedCode, err := hasher.Hash("2345-6789-ABCD-EFGH")
+		require.NoError(t, err)
+		assert.Equal(t, hashedCode.Hash, hashedCode.Lookup)
+		assert.Equal(t, hasher.Lookup("2345-6789-ABCD-EFGH"), hashedCode.Lookup)
+
+		ok, err := hasher.Verify(hashedCode.Hash, "2345-6789-ABCD-EFGH")
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = hasher.Verify(hashedCode.Hash, "2345-6789-ABCD-EFGJ")
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("another key", func(t *testing.T) {
+		t.Parallel()
+
+		hasher := NewHMACRecoveryCodeHasher(testHMACKey, nil)
+		other := NewHMACRecoveryCodeHasher([]byte("another key of at least 32 bytes"), nil)
+
+		hashedCode, err := other.Hash("2345-6789-ABCD-EFGH")
+		require.NoError(t, err)
+
+		ok, err := hasher.Verify(hashedCode.Hash, "2345-6789-ABCD-EFGH")
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("malformed hash", func(t *testing.T) {
+		t.Parallel()
+
+		hasher := NewHMACRecoveryCodeHasher(testHMACKey, nil)
+
+		for _, hash := range []string{"", "not hex", "abc"} {
+			ok, err := hasher.Verify(hash, "2345-6789-ABCD-EFGH")
+			require.NoError(t, err)
+			assert.False(t, ok)
+		}
+	})
+
+	t.Run("legacy hash", func(t *testing.T) {
+		t.Parallel()
+
+		legacy := shieldpassword.NewBcryptPasswordHasher(bcrypt.MinCost)
+		hashedCode, err := legacy.Hash("0123456789abcdef")
+		require.NoError(t, err)
+
+		hasher := NewHMACRecoveryCodeHasher(testHMACKey, legacy)
+
+		ok, err := hasher.Verify(hashedCode, "0123456789abcdef")
+		require.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = hasher.Verify(hashedCode, "0123456789abcdee")
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		// Legacy hashes are rejected without a legacy hasher.
+		ok, err = NewHMACRecoveryCodeHasher(testHMACKey, nil).Verify(hashedCode, "0123456789abcdef")
+		require.NoError(t, err)
+		assert.False(t, ok)
+	})
+}
+
+func TestPasswordRecoveryCodeHasher(t *testing.T) {
+	t.Parallel()
+
+	hasher := NewPasswordRecoveryCodeHasher(shieldpassword.NewBcryptPasswordHasher(bcrypt.MinCost))
+
+	hashedCode, err := hasher.Hash("2345-6789-ABCD-EFGH")
+	require.NoError(t, err)
+	assert.Empty(t, hashedCode.Lookup)
+	assert.Empty(t, hasher.Lookup("2345-6789-ABCD-EFGH"))
+
+	ok, err := hasher.Verify(hashedCode.Hash, "2345-6789-ABCD-EFGH")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = hasher.Verify(hashedCode.Hash, "2345-6789-ABCD-EFGJ")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -15,7 +15,17 @@ const (
 	MessageKeyPasswordChange MessageKey = "message_key_password_change"
 
 	// shielduser.
-	MessageKeyEmailChange MessageKey = "message_key_email_change"
+	MessageKeyEmailChange       MessageKey = "message_key_email_change"
+	MessageKeyEmailChangeNotice MessageKey = "message_key_email_change_notice"
+
+	// shieldemailotp.
+	MessageKeyEmailOTP MessageKey = "message_key_email_otp"
+
+	// shieldemailverification.
+	MessageKeyEmailVerification MessageKey = "message_key_email_verification"
+
+	// shieldmagiclink.
+	MessageKeyMagicLink MessageKey = "message_key_magic_link"
 
 	// shieldworkspace.
 	MessageKeyWorkspaceInvite MessageKey = "message_key_workspace_invite"
@@ -259,14 +259,16 @@ func (s *sessionStrategy[U, S]) Authenticate(
 		)
 	}
 
-	if dbSess.IsMfaRequired {
-		return sess, shield.ErrMFARequired
-	}
-
 	sess.ID = dbSess.ID
 	sess.ExpiresAt = dbSess.ExpiresAt
 	sess.UserID = dbSess.UserID
 
+	// The partially issued session is returned along with the error, so that
+	// it can be upgraded via shieldmfa.Handler.
+	if dbSess.IsMfaRequired {
+		return sess, shield.ErrMFARequired
+	}
+
 	if s.config.Hooker != nil {
 		sess, err = s.config.Hooker.OnSessionAuthenticate(ctx, sess, tx)
 		if err != nil {
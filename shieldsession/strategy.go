@@ -35,6 +35,10 @@ type Authenticator[U, S any] interface {
 	//
 	// It returns a session if the user is authenticated, otherwise it returns
 	// a shield.ErrUnauthenticatedUser error.
+	//
+	// If the session is issued partially, a shield.ErrMFARequired error is
+	// returned along with the session, so that its ID can be used to complete
+	// the MFA challenge.
 	Authenticate(http.ResponseWriter, *http.Request) (Session[S], error)
 
 	// ExpireSessions closes all sessions, but one assigned to a the context.
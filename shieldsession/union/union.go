@@ -29,7 +29,8 @@ func New[U any, S any](
 
 // Authenticate tries to authenticate user session with provided authenticators.
 //
-// If all authenticators fail, the error is returned.
+// If all authenticators fail, the error is returned. If one of them has found
+// a partially issued session, the session is returned along with the error.
 func (u unionStrategy[U, S]) Authenticate(
 	w http.ResponseWriter,
 	r *http.Request,
@@ -39,11 +40,15 @@ func (u unionStrategy[U, S]) Authenticate(
 	errs := make([]error, 0)
 
 	for _, authenticator := range u {
-		sess, err := authenticator.Authenticate(w, r)
+		s, err := authenticator.Authenticate(w, r)
 		if err != nil {
+			if errors.Is(err, shield.ErrMFARequired) {
+				sess = s
+			}
+
 			errs = append(errs, err)
 		} else {
-			return sess, nil
+			return s, nil
 		}
 	}
 
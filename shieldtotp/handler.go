@@ -0,0 +1,368 @@
+package shieldtotp
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.inout.gg/foundations/dbsql"
+	"go.inout.gg/foundations/debug"
+	"go.jetify.com/typeid/v2"
+
+	"go.inout.gg/shield"
+	"go.inout.gg/shield/internal/dbsqlc"
+	"go.inout.gg/shield/internal/tid"
+	"go.inout.gg/shield/shieldsession"
+)
+
+const (
+	DefaultDigits       = 6
+	DefaultPeriod       = 30 * time.Second
+	DefaultSkew         = 1
+	DefaultSecretLength = 20
+)
+
+var (
+	// ErrCodeIncorrect is returned when the provided TOTP code is invalid,
+	// expired or has already been used.
+	ErrCodeIncorrect = errors.New("shield/totp: code incorrect")
+
+	// ErrAlreadyEnrolled is returned when the user tries to enroll TOTP
+	// while already having a confirmed TOTP factor.
+	ErrAlreadyEnrolled = errors.New("shield/totp: already enrolled")
+
+	// ErrNotEnrolled is returned when the user has no TOTP factor, or
+	// the factor is not in the expected state.
+	ErrNotEnrolled = errors.New("shield/totp: not enrolled")
+)
+
+// Config is the configuration for the TOTP handler.
+type Config struct {
+	Logger *slog.Logger // optional
+
+	// Issuer is the name of the service shown in authenticator apps.
+	Issuer string // required
+
+	// EncryptionKey is an AES key (16, 24 or 32 bytes long) used to encrypt
+	// TOTP secrets at rest.
+	//
+	// The key must be kept outside of the database.
+	EncryptionKey []byte // required
+
+	// Digits is the number of digits in a code.
+	//
+	// Defaults to DefaultDigits.
+	Digits int // optional
+
+	// Period is the duration of a single time step.
+	//
+	// Defaults to DefaultPeriod.
+	Period time.Duration // optional
+
+	// Skew is the number of time steps before and after the current one
+	// for which codes are still accepted, to tolerate clock drift.
+	//
+	// Defaults to DefaultSkew. Set to a negative value to disable it.
+	Skew int // optional
+
+	// SecretLength is the length of a generated secret in bytes.
+	//
+	// Defaults to DefaultSecretLength.
+	SecretLength int // optional
+}
+
+func (c *Config) defaults() {
+	c.Logger = cmp.Or(c.Logger, shield.DefaultLogger)
+	c.Digits = cmp.Or(c.Digits, DefaultDigits)
+	c.Period = cmp.Or(c.Period, DefaultPeriod)
+	c.Skew = cmp.Or(c.Skew, DefaultSkew)
+	c.Skew = max(c.Skew, 0)
+	c.SecretLength = cmp.Or(c.SecretLength, DefaultSecretLength)
+}
+
+func (c *Config) assert() {
+	debug.Assert(c.Logger != nil, "Logger must be set")
+	debug.Assert(c.Issuer != "", "Issuer must be set")
+	debug.Assert(len(c.EncryptionKey) == 16 ||
+		len(c.EncryptionKey) == 24 ||
+		len(c.EncryptionKey) == 32, "EncryptionKey must be 16, 24 or 32 bytes long")
+	debug.Assert(c.Digits >= 6 && c.Digits <= 8, "Digits must be between 6 and 8")
+	debug.Assert(c.Period >= time.Second, "Period must be at least a second")
+	debug.Assert(c.SecretLength >= 16, "SecretLength must be at least 16 bytes")
+}
+
+// Handler manages the TOTP second factor of users.
+type Handler[S any] struct {
+	pool   *pgxpool.Pool
+	config *Config
+}
+
+func NewHandler[S any](pool *pgxpool.Pool, config *Config) *Handler[S] {
+	config.defaults()
+	config.assert()
+
+	h := Handler[S]{
+		pool:   pool,
+		config: config,
+	}
+
+	debug.Assert(h.pool != nil, "pool must be set")
+
+	return &h
+}
+
+// Enrollment is a started TOTP enrollment.
+//
+// URI is an otpauth:// key URI that is meant to be rendered as a QR code,
+// Secret is its base32 encoded secret for manual entry.
+type Enrollment struct {
+	Secret string
+	URI    string
+}
+
+// HandleEnroll starts TOTP enrollment for the signed-in user.
+//
+// The enrollment must be completed with HandleConfirmEnrollment. Until then
+// the factor is not used. Calling HandleEnroll again before confirmation
+// replaces the secret.
+//
+// The session is expected to be provided via a passed ctx context.
+func (h *Handler[S]) HandleEnroll(ctx context.Context) (*Enrollment, error) {
+	sess, err := shieldsession.FromContext[S](ctx)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"shield/totp: failed to retrieve session from the context: %w",
+			err,
+		)
+	}
+
+	dbUser, err := dbsqlc.New().FindUserByID(ctx, h.pool, sess.UserID)
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			return nil, shield.ErrUserNotFound
+		}
+
+		return nil, fmt.Errorf("shield/totp: failed to find user: %w", err)
+	}
+
+	secret := make([]byte, h.config.SecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("shield/totp: failed to generate secret: %w", err)
+	}
+
+	encryptedSecret, err := encrypt(h.config.EncryptionKey, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := dbsqlc.New().UpsertUnconfirmedUserTOTP(
+		ctx,
+		h.pool,
+		dbsqlc.UpsertUnconfirmedUserTOTPParams{
+			ID:              tid.MustTOTPID(),
+			UserID:          dbUser.ID,
+			EncryptedSecret: encryptedSecret,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("shield/totp: failed to store secret: %w", err)
+	}
+
+	if n == 0 {
+		return nil, ErrAlreadyEnrolled
+	}
+
+	return &Enrollment{
+		Secret: b32.EncodeToString(secret),
+		URI: keyURI(
+			h.config.Issuer,
+			dbUser.Email,
+			secret,
+			h.config.Period,
+			h.config.Digits,
+		),
+	}, nil
+}
+
+// HandleConfirmEnrollment completes TOTP enrollment of the signed-in user
+// with the first code generated by the authenticator app.
+//
+// Once confirmed, TOTP is reported as the user's MFA factor.
+//
+// The session is expected to be provided via a passed ctx context.
+func (h *Handler[S]) HandleConfirmEnrollment(ctx context.Context, code string) error {
+	sess, err := shieldsession.FromContext[S](ctx)
+	if err != nil {
+		return fmt.Errorf(
+			"shield/totp: failed to retrieve session from the context: %w",
+			err,
+		)
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("shield/totp: failed to begin transaction: %w", err)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	q := dbsqlc.New()
+
+	totp, err := q.FindUserTOTPByUserID(ctx, tx, sess.UserID)
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			return ErrNotEnrolled
+		}
+
+		return fmt.Errorf("shield/totp: failed to find TOTP factor: %w", err)
+	}
+
+	if totp.IsConfirmed {
+		return ErrAlreadyEnrolled
+	}
+
+	s, err := h.validate(totp, code)
+	if err != nil {
+		return err
+	}
+
+	n, err := q.ConfirmUserTOTP(ctx, tx, dbsqlc.ConfirmUserTOTPParams{
+		LastUsedStep: s,
+		UserID:       sess.UserID,
+	})
+	if err != nil {
+		return fmt.Errorf("shield/totp: failed to confirm TOTP factor: %w", err)
+	}
+
+	if n == 0 {
+		return ErrAlreadyEnrolled
+	}
+
+	if err := q.CreateUserMFA(ctx, tx, dbsqlc.CreateUserMFAParams{
+		ID:     tid.MustMFAID(),
+		UserID: sess.UserID,
+		Name:   shield.MFAOTP,
+	}); err != nil {
+		return fmt.Errorf("shield/totp: failed to create MFA factor: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("shield/totp: failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Verify checks the TOTP code of the user with the given userID.
+//
+// Every code can be used only once: a code from the same or an earlier
+// time step than the last accepted one is rejected with ErrCodeIncorrect.
+func (h *Handler[S]) Verify(
+	ctx context.Context,
+	userID typeid.TypeID,
+	code string,
+) error {
+	q := dbsqlc.New()
+
+	totp, err := q.FindUserTOTPByUserID(ctx, h.pool, userID)
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			return ErrNotEnrolled
+		}
+
+		return fmt.Errorf("shield/totp: failed to find TOTP factor: %w", err)
+	}
+
+	if !totp.IsConfirmed {
+		return ErrNotEnrolled
+	}
+
+	s, err := h.validate(totp, code)
+	if err != nil {
+		return err
+	}
+
+	// Advancing the last used step is conditional, so concurrent requests
+	// with the same code can't both succeed.
+	n, err := q.UseUserTOTPStep(ctx, h.pool, dbsqlc.UseUserTOTPStepParams{
+		LastUsedStep: s,
+		UserID:       userID,
+	})
+	if err != nil {
+		return fmt.Errorf("shield/totp: failed to record used code: %w", err)
+	}
+
+	if n == 0 {
+		d("code from step %d has already been used", s)
+		return ErrCodeIncorrect
+	}
+
+	return nil
+}
+
+// HandleDisable removes the TOTP factor of the signed-in user.
+//
+// The session is expected to be provided via a passed ctx context.
+func (h *Handler[S]) HandleDisable(ctx context.Context) error {
+	sess, err := shieldsession.FromContext[S](ctx)
+	if err != nil {
+		return fmt.Errorf(
+			"shield/totp: failed to retrieve session from the context: %w",
+			err,
+		)
+	}
+
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("shield/totp: failed to begin transaction: %w", err)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	q := dbsqlc.New()
+
+	if err := q.DeleteUserTOTP(ctx, tx, sess.UserID); err != nil {
+		return fmt.Errorf("shield/totp: failed to delete TOTP factor: %w", err)
+	}
+
+	if err := q.DeleteUserMFA(ctx, tx, dbsqlc.DeleteUserMFAParams{
+		UserID: sess.UserID,
+		Name:   shield.MFAOTP,
+	}); err != nil {
+		return fmt.Errorf("shield/totp: failed to delete MFA factor: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("shield/totp: failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// validate decrypts the TOTP secret and checks the code, returning
+// the matched time step.
+func (h *Handler[S]) validate(totp dbsqlc.ShieldUserTotp, code string) (int64, error) {
+	secret, err := decrypt(h.config.EncryptionKey, totp.EncryptedSecret)
+	if err != nil {
+		return 0, err
+	}
+
+	s, ok := validateCode(
+		secret,
+		code,
+		time.Now(),
+		h.config.Period,
+		h.config.Skew,
+		h.config.Digits,
+	)
+	if !ok {
+		return 0, ErrCodeIncorrect
+	}
+
+	return s, nil
+}
@@ -0,0 +1,8 @@
+// Package shieldtotp implements a time-based one-time password (TOTP) second
+// factor as described in RFC 6238.
+package shieldtotp
+
+import "go.inout.gg/foundations/debug"
+
+//nolint:gochecknoglobals
+var d = debug.Debuglog("shield/totp")
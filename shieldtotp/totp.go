@@ -0,0 +1,109 @@
+package shieldtotp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1" //nolint:gosec
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+//nolint:gochecknoglobals
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// step returns the TOTP time step for t.
+func step(t time.Time, period time.Duration) int64 {
+	return t.Unix() / int64(period/time.Second)
+}
+
+// generateCode generates a HOTP code (RFC 4226) for the given counter.
+//
+// TOTP uses HMAC-SHA1 as it is the only algorithm supported by the majority
+// of the authenticator apps.
+func generateCode(secret []byte, counter uint64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range digits {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+// validateCode checks code against all time steps within the skew window
+// around t.
+//
+// It returns the matched time step on success.
+func validateCode(
+	secret []byte,
+	code string,
+	t time.Time,
+	period time.Duration,
+	skew, digits int,
+) (int64, bool) {
+	if len(code) != digits {
+		return 0, false
+	}
+
+	current := step(t, period)
+
+	// Compare all steps to keep the validation time independent of
+	// which step matched.
+	var (
+		matched int64
+		ok      bool
+	)
+
+	for i := -skew; i <= skew; i++ {
+		s := current + int64(i)
+		if s < 0 {
+			continue
+		}
+
+		expected := generateCode(secret, uint64(s), digits)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			matched, ok = s, true
+		}
+	}
+
+	return matched, ok
+}
+
+// keyURI builds an otpauth:// key URI understood by authenticator apps.
+//
+// See: https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+func keyURI(
+	issuer, accountName string,
+	secret []byte,
+	period time.Duration,
+	digits int,
+) string {
+	query := url.Values{}
+	query.Set("secret", b32.EncodeToString(secret))
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(digits))
+	query.Set("period", strconv.Itoa(int(period/time.Second)))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + accountName,
+		RawQuery: query.Encode(),
+	}
+
+	return u.String()
+}
@@ -0,0 +1,52 @@
+package shieldtotp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateCode(t *testing.T) {
+	t.Parallel()
+
+	// Test vectors from RFC 6238, Appendix B.
+	secret := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		s := step(time.Unix(tt.unix, 0), DefaultPeriod)
+		assert.Equal(t, tt.code, generateCode(secret, uint64(s), 8))
+	}
+}
+
+func TestValidateCode(t *testing.T) {
+	t.Parallel()
+
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1111111109, 0)
+	current := step(now, DefaultPeriod)
+
+	code := generateCode(secret, uint64(current-1), DefaultDigits)
+
+	s, ok := validateCode(secret, code, now, DefaultPeriod, 1, DefaultDigits)
+	assert.True(t, ok)
+	assert.Equal(t, current-1, s)
+
+	_, ok = validateCode(secret, code, now, DefaultPeriod, 0, DefaultDigits)
+	assert.False(t, ok)
+
+	_, ok = validateCode(secret, code[1:], now, DefaultPeriod, 1, DefaultDigits)
+	assert.False(t, ok)
+}
@@ -1,35 +1,150 @@
 package shielduser
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.inout.gg/foundations/dbsql"
+	"go.inout.gg/foundations/debug"
+	"go.jetify.com/typeid/v2"
 
+	"go.inout.gg/shield"
 	"go.inout.gg/shield/internal/dbsqlc"
+	"go.inout.gg/shield/internal/random"
+	"go.inout.gg/shield/internal/tid"
 	"go.inout.gg/shield/shieldsender"
 	"go.inout.gg/shield/shieldsession"
 )
 
+const (
+	DefaultTokenLength     = 32
+	DefaultExpiresIn       = 24 * time.Hour
+	DefaultRevertExpiresIn = 7 * 24 * time.Hour
+)
+
+var (
+	ErrEmailAlreadyTaken = errors.New("shielduser: email already taken")
+	ErrEmailUnchanged    = errors.New("shielduser: email unchanged")
+
+	// ErrEmailChangeTokenInvalid is returned when the confirmation or revert
+	// token doesn't exist, has expired, has already been used or the user
+	// email has changed since the token was sent.
+	ErrEmailChangeTokenInvalid = errors.New("shielduser: email change token invalid")
+
+	// ErrEmailRecentlyChanged is returned when a new email change is
+	// requested while the previous confirmed change can still be reverted.
+	ErrEmailRecentlyChanged = errors.New("shielduser: email recently changed")
+)
+
+// EmailChangeMessagePayload is the payload of the message sent to the new
+// email address to confirm the change.
+type EmailChangeMessagePayload struct {
+	ExpiresAt time.Time
+	OldEmail  string
+	NewEmail  string
+	Token     string
+}
+
+// EmailChangeNoticeMessagePayload is the payload of the message sent to
+// the old email address to notify about the change.
+//
+// RevertToken allows the owner of the old address to cancel the change or
+// revert it once confirmed, until ExpiresAt.
+type EmailChangeNoticeMessagePayload struct {
+	ExpiresAt   time.Time
+	NewEmail    string
+	RevertToken string
+}
+
+// Config is the configuration for the user handler.
+type Config struct {
+	Logger *slog.Logger // optional
+
+	// TokenLength is the number of random bytes in confirmation and revert
+	// tokens.
+	//
+	// Defaults to DefaultTokenLength.
+	TokenLength int // optional
+
+	// ExpiresIn sets for how long an email change can be confirmed.
+	//
+	// Defaults to DefaultExpiresIn.
+	ExpiresIn time.Duration // optional
+
+	// RevertExpiresIn sets for how long an email change can be reverted
+	// from the old address.
+	//
+	// Defaults to DefaultRevertExpiresIn.
+	RevertExpiresIn time.Duration // optional
+}
+
+func (c *Config) defaults() {
+	c.Logger = cmp.Or(c.Logger, shield.DefaultLogger)
+	c.TokenLength = cmp.Or(c.TokenLength, DefaultTokenLength)
+	c.ExpiresIn = cmp.Or(c.ExpiresIn, DefaultExpiresIn)
+	c.RevertExpiresIn = cmp.Or(c.RevertExpiresIn, DefaultRevertExpiresIn)
+}
+
+func (c *Config) assert() {
+	debug.Assert(c.Logger != nil, "Logger must be set")
+	debug.Assert(c.TokenLength >= 16, "TokenLength must be at least 16")
+	debug.Assert(c.ExpiresIn > 0, "ExpiresIn must be positive")
+	debug.Assert(
+		c.RevertExpiresIn >= c.ExpiresIn,
+		"RevertExpiresIn must not be shorter than ExpiresIn",
+	)
+}
+
 type Handler[S any] struct {
 	pool   *pgxpool.Pool
 	sender shieldsender.Sender
+	config *Config
 }
 
 func NewHandler[S any](
 	pool *pgxpool.Pool,
 	sender shieldsender.Sender,
+	config *Config,
 ) *Handler[S] {
-	return &Handler[S]{
+	if config == nil {
+		//nolint:exhaustruct
+		config = &Config{}
+	}
+
+	config.defaults()
+	config.assert()
+
+	h := Handler[S]{
 		pool:   pool,
 		sender: sender,
+		config: config,
 	}
+
+	debug.Assert(h.pool != nil, "pool must be set")
+	debug.Assert(h.sender != nil, "sender must be set")
+
+	return &h
 }
 
-// HandleChangeEmail updates the email address associated with a user's account.
+// HandleChangeEmail requests a change of the email address associated with
+// a user's account.
+//
+// The change is not applied immediately. The old address is notified with
+// a revert token, and then a confirmation token is sent to the new address.
+// A previously requested change that hasn't been confirmed is replaced.
+// If sending either message fails, the change is discarded.
+//
+// While a confirmed change can still be reverted, ErrEmailRecentlyChanged is
+// returned, so that a hijacked session can't chain changes to lock the owner
+// of the original address out of reverting the first one.
 //
 // It requires a session to be present in the context, otherwise it fails.
-func (h Handler[S]) HandleChangeEmail(ctx context.Context, email string) error {
+func (h *Handler[S]) HandleChangeEmail(ctx context.Context, email string) error {
 	sess, err := shieldsession.FromContext[S](ctx)
 	if err != nil {
 		return fmt.Errorf(
@@ -38,6 +153,125 @@ func (h Handler[S]) HandleChangeEmail(ctx context.Context, email string) error {
 		)
 	}
 
+	q := dbsqlc.New()
+
+	user, err := q.FindUserByID(ctx, h.pool, sess.UserID)
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			return shield.ErrUserNotFound
+		}
+
+		return fmt.Errorf("shielduser: failed to find user: %w", err)
+	}
+
+	if user.Email == email {
+		return ErrEmailUnchanged
+	}
+
+	if _, err := q.FindUserByEmail(ctx, h.pool, email); err == nil {
+		return ErrEmailAlreadyTaken
+	} else if !dbsql.IsNotFoundError(err) {
+		return fmt.Errorf("shielduser: failed to find user: %w", err)
+	}
+
+	confirmTokStr, err := random.SecureHexString(h.config.TokenLength)
+	if err != nil {
+		return fmt.Errorf("shielduser: failed to generate token: %w", err)
+	}
+
+	revertTokStr, err := random.SecureHexString(h.config.TokenLength)
+	if err != nil {
+		return fmt.Errorf("shielduser: failed to generate token: %w", err)
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(h.config.ExpiresIn)
+	revertExpiresAt := now.Add(h.config.RevertExpiresIn)
+
+	changeID := tid.MustEmailChangeID()
+	n, err := q.UpsertPendingEmailChange(ctx, h.pool, dbsqlc.UpsertPendingEmailChangeParams{
+		ID:               changeID,
+		UserID:           user.ID,
+		OldEmail:         user.Email,
+		NewEmail:         email,
+		ConfirmTokenHash: random.HashToken(confirmTokStr),
+		RevertTokenHash:  random.HashToken(revertTokStr),
+		ExpiresAt:        expiresAt,
+		RevertExpiresAt:  revertExpiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("shielduser: failed to store email change: %w", err)
+	}
+
+	if n == 0 {
+		return ErrEmailRecentlyChanged
+	}
+
+	// The old address is notified first, so that a change can't be confirmed
+	// without its owner being able to revert it. If any message fails to be
+	// sent, the change is discarded and has to be requested again.
+	if err := h.sender.Send(ctx, shieldsender.Message{
+		Key:   shieldsender.MessageKeyEmailChangeNotice,
+		Email: user.Email,
+		Payload: EmailChangeNoticeMessagePayload{
+			ExpiresAt:   revertExpiresAt,
+			NewEmail:    email,
+			RevertToken: revertTokStr,
+		},
+	}); err != nil {
+		h.discardEmailChange(ctx, changeID)
+
+		return fmt.Errorf(
+			"shielduser: failed to send email change notice message: %w",
+			err,
+		)
+	}
+
+	if err := h.sender.Send(ctx, shieldsender.Message{
+		Key:   shieldsender.MessageKeyEmailChange,
+		Email: email,
+		Payload: EmailChangeMessagePayload{
+			ExpiresAt: expiresAt,
+			OldEmail:  user.Email,
+			NewEmail:  email,
+			Token:     confirmTokStr,
+		},
+	}); err != nil {
+		h.discardEmailChange(ctx, changeID)
+
+		return fmt.Errorf(
+			"shielduser: failed to send email change message: %w",
+			err,
+		)
+	}
+
+	return nil
+}
+
+// discardEmailChange deletes the pending email change with the given
+// changeID, e.g., when the messages about it failed to be sent.
+func (h *Handler[S]) discardEmailChange(ctx context.Context, changeID typeid.TypeID) {
+	// The request context might be canceled already.
+	ctx = context.WithoutCancel(ctx)
+
+	if err := dbsqlc.New().DeletePendingEmailChangeByID(ctx, h.pool, changeID); err != nil {
+		h.config.Logger.ErrorContext(
+			ctx,
+			"Failed to discard email change",
+			slog.String("email_change_id", changeID.String()),
+			slog.Any("error", err),
+		)
+	}
+}
+
+// HandleConfirmEmailChange applies the email change confirmed with
+// the token tokStr sent to the new address.
+//
+// The user email and the password credential key are changed. As the token
+// was delivered to the new address, the new email is marked as verified.
+//
+// No session is required, as the token can be opened on another device.
+func (h *Handler[S]) HandleConfirmEmailChange(ctx context.Context, tokStr string) error {
 	tx, err := h.pool.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf(
@@ -46,23 +280,44 @@ func (h Handler[S]) HandleChangeEmail(ctx context.Context, email string) error {
 		)
 	}
 
-	defer func() {
-		_ = tx.Rollback(ctx)
-	}()
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	q := dbsqlc.New()
+
+	change, err := q.ConfirmEmailChange(ctx, tx, random.HashToken(tokStr))
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			return ErrEmailChangeTokenInvalid
+		}
+
+		return fmt.Errorf("shielduser: failed to confirm email change: %w", err)
+	}
+
+	n, err := q.ChangeUserEmailByID(ctx, tx, dbsqlc.ChangeUserEmailByIDParams{
+		ID:              change.UserID,
+		OldEmail:        change.OldEmail,
+		NewEmail:        change.NewEmail,
+		IsEmailVerified: true,
+	})
+	if err != nil {
+		if dbsql.IsUniqueViolationError(err) {
+			return ErrEmailAlreadyTaken
+		}
 
-	if err = dbsqlc.New().ChangeUserEmailByID(ctx, tx, dbsqlc.ChangeUserEmailByIDParams{
-		ID:    sess.UserID,
-		Email: email,
-	}); err != nil {
 		return fmt.Errorf(
 			"shielduser: failed to change user email: %w",
 			err,
 		)
 	}
 
-	if err = dbsqlc.New().ChangePasswordCredentialEmailByUserID(ctx, tx, dbsqlc.ChangePasswordCredentialEmailByUserIDParams{
-		UserID: sess.UserID,
-		Email:  email,
+	if n == 0 {
+		d("email of user=%v has changed since the change was requested", change.UserID)
+		return ErrEmailChangeTokenInvalid
+	}
+
+	if err := q.ChangePasswordCredentialEmailByUserID(ctx, tx, dbsqlc.ChangePasswordCredentialEmailByUserIDParams{
+		UserID: change.UserID,
+		Email:  change.NewEmail,
 	}); err != nil {
 		return fmt.Errorf(
 			"shielduser: failed to change password credential email: %w",
@@ -70,23 +325,125 @@ func (h Handler[S]) HandleChangeEmail(ctx context.Context, email string) error {
 		)
 	}
 
-	if err = tx.Commit(ctx); err != nil {
+	if err := tx.Commit(ctx); err != nil {
 		return fmt.Errorf(
 			"shielduser: failed to commit transaction: %w",
 			err,
 		)
 	}
 
-	if err = h.sender.Send(ctx, shieldsender.Message{
-		Key:     shieldsender.MessageKeyEmailChange,
-		Email:   email,
-		Payload: nil,
+	return nil
+}
+
+// HandleRevertEmailChange reverts the email change with the token tokStr
+// sent to the old address.
+//
+// A pending change is canceled. A confirmed change is rolled back to
+// the old email, which is marked as verified as the token was delivered to
+// it, and all sessions of the user are expired, as the change might have
+// been requested from a hijacked session.
+//
+// No session is required, as the token can be opened on another device.
+func (h *Handler[S]) HandleRevertEmailChange(ctx context.Context, tokStr string) error {
+	tx, err := h.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf(
+			"shielduser: failed to begin transaction: %w",
+			err,
+		)
+	}
+
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	q := dbsqlc.New()
+
+	change, err := q.RevertEmailChange(ctx, tx, random.HashToken(tokStr))
+	if err != nil {
+		if dbsql.IsNotFoundError(err) {
+			return ErrEmailChangeTokenInvalid
+		}
+
+		return fmt.Errorf("shielduser: failed to revert email change: %w", err)
+	}
+
+	if change.ConfirmedAt != nil {
+		if err := h.rollbackEmailChangeTx(ctx, q, tx, change); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf(
+			"shielduser: failed to commit transaction: %w",
+			err,
+		)
+	}
+
+	return nil
+}
+
+// rollbackEmailChangeTx restores the old email of the confirmed change and
+// expires all sessions of the user.
+func (h *Handler[S]) rollbackEmailChangeTx(
+	ctx context.Context,
+	q *dbsqlc.Queries,
+	tx dbsqlc.DBTX,
+	change dbsqlc.ShieldUserEmailChange,
+) error {
+	n, err := q.ChangeUserEmailByID(ctx, tx, dbsqlc.ChangeUserEmailByIDParams{
+		ID:              change.UserID,
+		OldEmail:        change.NewEmail,
+		NewEmail:        change.OldEmail,
+		IsEmailVerified: true,
+	})
+	if err != nil {
+		if dbsql.IsUniqueViolationError(err) {
+			return ErrEmailAlreadyTaken
+		}
+
+		return fmt.Errorf(
+			"shielduser: failed to change user email: %w",
+			err,
+		)
+	}
+
+	if n == 0 {
+		d("email of user=%v has changed since the change was confirmed", change.UserID)
+		return ErrEmailChangeTokenInvalid
+	}
+
+	if err := q.ChangePasswordCredentialEmailByUserID(ctx, tx, dbsqlc.ChangePasswordCredentialEmailByUserIDParams{
+		UserID: change.UserID,
+		Email:  change.OldEmail,
 	}); err != nil {
 		return fmt.Errorf(
-			"shielduser: failed to send email change message: %w",
+			"shielduser: failed to change password credential email: %w",
+			err,
+		)
+	}
+
+	if _, err := q.ExpireAllSessionsByUserID(ctx, tx, dbsqlc.ExpireAllSessionsByUserIDParams{
+		UserID:    change.UserID,
+		EvictedBy: &change.UserID,
+	}); err != nil {
+		return fmt.Errorf(
+			"shielduser: failed to expire sessions: %w",
 			err,
 		)
 	}
 
 	return nil
 }
+
+// HandleDeleteExpiredEmailChanges deletes email changes that can no longer
+// be confirmed or reverted.
+//
+// It's intended to be run periodically.
+func (h *Handler[S]) HandleDeleteExpiredEmailChanges(ctx context.Context) (int64, error) {
+	n, err := dbsqlc.New().DeleteExpiredEmailChanges(ctx, h.pool)
+	if err != nil {
+		return 0, fmt.Errorf("shielduser: failed to delete expired email changes: %w", err)
+	}
+
+	return n, nil
+}
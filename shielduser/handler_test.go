@@ -0,0 +1,216 @@
+package shielduser
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"go.inout.gg/shield/internal/dbsqlc"
+	"go.inout.gg/shield/internal/dbsqlctest"
+	"go.inout.gg/shield/internal/mocks/mocks"
+	"go.inout.gg/shield/internal/testutil"
+	"go.inout.gg/shield/internal/tid"
+	"go.inout.gg/shield/shieldsender"
+)
+
+// tokens are the tokens sent on an email change request.
+type tokens struct {
+	confirm string
+	revert  string
+}
+
+// newHandler returns a handler along with a function requesting a change
+// of the user email to newEmail and returning the sent tokens.
+func newHandler(
+	t *testing.T,
+	pool *pgxpool.Pool,
+) (*Handler[struct{}], *mocks.MockSender, func(dbsqlctest.ShieldUser, string) tokens) {
+	t.Helper()
+
+	sender := mocks.NewMockSender(gomock.NewController(t))
+	h := NewHandler[struct{}](pool, sender, nil)
+
+	changeEmail := func(user dbsqlctest.ShieldUser, newEmail string) tokens {
+		t.Helper()
+
+		var toks tokens
+
+		gomock.InOrder(
+			sender.EXPECT().
+				Send(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, msg shieldsender.Message) error {
+					assert.Equal(t, shieldsender.MessageKeyEmailChangeNotice, msg.Key)
+
+					payload, ok := msg.Payload.(EmailChangeNoticeMessagePayload)
+					require.True(t, ok)
+					assert.Equal(t, newEmail, payload.NewEmail)
+
+					toks.revert = payload.RevertToken
+
+					return nil
+				}),
+			sender.EXPECT().
+				Send(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ context.Context, msg shieldsender.Message) error {
+					assert.Equal(t, shieldsender.MessageKeyEmailChange, msg.Key)
+					assert.Equal(t, newEmail, msg.Email)
+
+					payload, ok := msg.Payload.(EmailChangeMessagePayload)
+					require.True(t, ok)
+
+					toks.confirm = payload.Token
+
+					return nil
+				}),
+		)
+
+		ctx := testutil.SessionContext[struct{}](t, user.ID)
+		require.NoError(t, h.HandleChangeEmail(ctx, newEmail))
+
+		return toks
+	}
+
+	return h, sender, changeEmail
+}
+
+// findUser returns the current state of the user.
+func findUser(t *testing.T, pool *pgxpool.Pool, user dbsqlctest.ShieldUser) dbsqlctest.ShieldUser {
+	t.Helper()
+
+	user, err := dbsqlctest.New().TestFindUserByID(t.Context(), pool, user.ID)
+	require.NoError(t, err)
+
+	return user
+}
+
+func TestHandleChangeEmail(t *testing.T) {
+	t.Parallel()
+
+	t.Run("replaces pending change", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		h, _, changeEmail := newHandler(t, pool)
+		user := testutil.CreateUser(t, pool, testutil.Email(), true)
+
+		oldToks := changeEmail(user, testutil.Email())
+		newEmail := testutil.Email()
+		toks := changeEmail(user, newEmail)
+
+		require.ErrorIs(t, h.HandleConfirmEmailChange(t.Context(), oldToks.confirm), ErrEmailChangeTokenInvalid)
+		require.ErrorIs(t, h.HandleRevertEmailChange(t.Context(), oldToks.revert), ErrEmailChangeTokenInvalid)
+
+		require.NoError(t, h.HandleConfirmEmailChange(t.Context(), toks.confirm))
+		assert.Equal(t, newEmail, findUser(t, pool, user).Email)
+	})
+
+	t.Run("notice failure discards change", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		h, sender, _ := newHandler(t, pool)
+		user := testutil.CreateUser(t, pool, testutil.Email(), true)
+
+		// The confirmation is not expected to be sent.
+		sender.EXPECT().
+			Send(gomock.Any(), gomock.Any()).
+			Return(errors.New("failed to send"))
+
+		ctx := testutil.SessionContext[struct{}](t, user.ID)
+		require.Error(t, h.HandleChangeEmail(ctx, testutil.Email()))
+
+		changes, err := dbsqlctest.New().TestFindPendingEmailChangesByUserID(t.Context(), pool, user.ID)
+		require.NoError(t, err)
+		assert.Empty(t, changes)
+	})
+}
+
+func TestHandleConfirmEmailChange(t *testing.T) {
+	t.Parallel()
+
+	t.Run("email taken before confirmation", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		h, _, changeEmail := newHandler(t, pool)
+		user := testutil.CreateUser(t, pool, testutil.Email(), true)
+
+		newEmail := testutil.Email()
+		toks := changeEmail(user, newEmail)
+		testutil.CreateUser(t, pool, newEmail, true)
+
+		require.ErrorIs(t, h.HandleConfirmEmailChange(t.Context(), toks.confirm), ErrEmailAlreadyTaken)
+		assert.Equal(t, user.Email, findUser(t, pool, user).Email)
+	})
+}
+
+func TestHandleRevertEmailChange(t *testing.T) {
+	t.Parallel()
+
+	t.Run("confirmed change", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		h, _, changeEmail := newHandler(t, pool)
+		user := testutil.CreateUser(t, pool, testutil.Email(), true)
+
+		_, err := dbsqlc.New().CreateUserSession(t.Context(), pool, dbsqlc.CreateUserSessionParams{
+			ID:            tid.MustSessionID(),
+			UserID:        user.ID,
+			ExpiresAt:     time.Now().Add(time.Hour),
+			IsMfaRequired: false,
+		})
+		require.NoError(t, err)
+
+		newEmail := testutil.Email()
+		toks := changeEmail(user, newEmail)
+
+		require.NoError(t, h.HandleConfirmEmailChange(t.Context(), toks.confirm))
+		assert.Equal(t, newEmail, findUser(t, pool, user).Email)
+
+		require.NoError(t, h.HandleRevertEmailChange(t.Context(), toks.revert))
+
+		reverted := findUser(t, pool, user)
+		assert.Equal(t, user.Email, reverted.Email)
+		assert.True(t, reverted.IsEmailVerified)
+
+		sessions, err := dbsqlc.New().AllActiveSessions(t.Context(), pool, user.ID)
+		require.NoError(t, err)
+		assert.Empty(t, sessions)
+
+		require.ErrorIs(t, h.HandleRevertEmailChange(t.Context(), toks.revert), ErrEmailChangeTokenInvalid)
+	})
+
+	t.Run("chained change", func(t *testing.T) {
+		t.Parallel()
+
+		pool := testutil.NewPool(t)
+		h, _, changeEmail := newHandler(t, pool)
+		user := testutil.CreateUser(t, pool, testutil.Email(), true)
+
+		firstEmail := testutil.Email()
+		firstToks := changeEmail(user, firstEmail)
+		require.NoError(t, h.HandleConfirmEmailChange(t.Context(), firstToks.confirm))
+
+		// A hijacked session can't move the account further away from
+		// the owner of the original address.
+		ctx := testutil.SessionContext[struct{}](t, user.ID)
+		require.ErrorIs(t, h.HandleChangeEmail(ctx, testutil.Email()), ErrEmailRecentlyChanged)
+		assert.Equal(t, firstEmail, findUser(t, pool, user).Email)
+
+		require.NoError(t, h.HandleRevertEmailChange(t.Context(), firstToks.revert))
+		assert.Equal(t, user.Email, findUser(t, pool, user).Email)
+
+		// Once reverted, the email can be changed again.
+		newEmail := testutil.Email()
+		toks := changeEmail(user, newEmail)
+		require.NoError(t, h.HandleConfirmEmailChange(t.Context(), toks.confirm))
+		assert.Equal(t, newEmail, findUser(t, pool, user).Email)
+	})
+}
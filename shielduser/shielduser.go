@@ -0,0 +1,12 @@
+// Package shielduser manages user accounts.
+//
+// Email changes are applied in two phases: a confirmation token is sent to
+// the new address and a revert token is sent to the old one. The change is
+// only applied once confirmed from the new address and can be reverted
+// from the old address for a while after that.
+package shielduser
+
+import "go.inout.gg/foundations/debug"
+
+//nolint:gochecknoglobals
+var d = debug.Debuglog("shield/user")
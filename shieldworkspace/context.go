@@ -0,0 +1,27 @@
+package shieldworkspace
+
+import (
+	"context"
+
+	"go.jetify.com/typeid/v2"
+)
+
+type ctxKey struct{}
+
+//nolint:gochecknoglobals
+var kCtxKey = ctxKey{}
+
+// WithWorkspaceID returns a copy of ctx carrying the ID of the workspace
+// the request is performed in.
+//
+// Modules use it to apply workspace-specific settings, e.g., password
+// policies.
+func WithWorkspaceID(ctx context.Context, workspaceID typeid.TypeID) context.Context {
+	return context.WithValue(ctx, kCtxKey, workspaceID)
+}
+
+// WorkspaceIDFromContext returns the workspace ID set with WithWorkspaceID.
+func WorkspaceIDFromContext(ctx context.Context) (typeid.TypeID, bool) {
+	id, ok := ctx.Value(kCtxKey).(typeid.TypeID)
+	return id, ok
+}